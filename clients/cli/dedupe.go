@@ -26,3 +26,41 @@ func (d *ddCache) ExistsOrAdd(id string) bool {
     return false
 }
 
+
+// appliedLog remembers the content hash of recently applied clips, so a
+// recall can tell whether the clipboard still holds that clip.
+type appliedLog struct {
+    cap   int
+    order []string
+    hash  map[string]string
+}
+
+func newAppliedLog(capacity int) *appliedLog {
+    return &appliedLog{cap: capacity, hash: make(map[string]string, capacity)}
+}
+
+func (a *appliedLog) Add(msgID, hash string) {
+    if a.cap <= 0 || msgID == "" { return }
+    if _, ok := a.hash[msgID]; !ok {
+        a.order = append(a.order, msgID)
+    }
+    a.hash[msgID] = hash
+    if len(a.order) > a.cap {
+        delete(a.hash, a.order[0])
+        a.order = a.order[1:]
+    }
+}
+
+// Take returns and forgets the hash applied for msgID.
+func (a *appliedLog) Take(msgID string) (string, bool) {
+    h, ok := a.hash[msgID]
+    if !ok { return "", false }
+    delete(a.hash, msgID)
+    for i, id := range a.order {
+        if id == msgID {
+            a.order = append(a.order[:i], a.order[i+1:]...)
+            break
+        }
+    }
+    return h, true
+}
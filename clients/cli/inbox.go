@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"clip-sync/server/pkg/types"
+)
+
+// offerLabel is the one-line summary of an offer, without its content.
+func offerLabel(o *types.Offer) string {
+	if o.Clip == nil {
+		return o.ID
+	}
+	return fmt.Sprintf("%s %s (%d bytes)", o.ID, o.Clip.Mime, o.Clip.Size)
+}
+
+// printOffer reports offer and offer_result envelopes; it returns false
+// for any other envelope.
+func printOffer(env types.Envelope) bool {
+	if env.Offer == nil {
+		return false
+	}
+	switch env.Type {
+	case "offer":
+		fmt.Printf("[offer from %s] %s\n", env.Offer.From, offerLabel(env.Offer))
+	case "offer_result":
+		fmt.Printf("[offer to %s] %s %s\n", env.Offer.To, env.Offer.ID, env.Offer.Status)
+	default:
+		return false
+	}
+	return true
+}
+
+// runInbox lists the pending offers of the user.
+func runInbox(ctx context.Context, httpBase, token string) error {
+	var offers []types.Offer
+	if err := doJSON(ctx, strings.TrimRight(httpBase, "/"), token, http.MethodGet, "/api/inbox", nil, &offers); err != nil {
+		return err
+	}
+	if len(offers) == 0 {
+		fmt.Println("inbox is empty")
+	}
+	for i := range offers {
+		fmt.Printf("[offer from %s] %s\n", offers[i].From, offerLabel(&offers[i]))
+	}
+	return nil
+}
+
+// runAnswer accepts or rejects offer id from device. Accepting prints the
+// clip like listen does; nothing is applied to the clipboard.
+func runAnswer(ctx context.Context, httpBase, token, device, id string, accept bool) error {
+	action := "reject"
+	if accept {
+		action = "accept"
+	}
+	path := "/api/inbox/" + url.PathEscape(id) + "/" + action + "?device=" + url.QueryEscape(device)
+	if !accept {
+		return doJSON(ctx, strings.TrimRight(httpBase, "/"), token, http.MethodPost, path, nil, nil)
+	}
+	var env types.Envelope
+	if err := doJSON(ctx, strings.TrimRight(httpBase, "/"), token, http.MethodPost, path, nil, &env); err != nil {
+		return err
+	}
+	if env.Clip != nil {
+		printClip(env.User+"/"+env.From, env.Clip)
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+    "compress/gzip"
     "context"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
     "encoding/json"
+    "errors"
     "flag"
     "fmt"
     "io"
@@ -49,23 +54,26 @@ func computeBackoff(attempt int) time.Duration {
     return d
 }
 
-func dialAndHello(ctx context.Context, addr, token, device string) (*websocket.Conn, error) {
+func dialAndHello(ctx context.Context, addr, token, device string) (conn, error) {
 	c, _, err := websocket.Dial(ctx, addr, nil)
 	if err != nil {
 		return nil, err
 	}
 	hello := types.Envelope{
 		Type:  "hello",
-		Hello: &types.Hello{Token: token, UserID: token, DeviceID: device},
+		Hello: &types.Hello{Token: token, UserID: token, DeviceID: device, Channels: subChannels},
 	}
 	if err := wsjson.Write(ctx, c, hello); err != nil {
 		c.Close(websocket.StatusNormalClosure, "")
 		return nil, err
 	}
-	return c, nil
+	return &wsConn{c: c}, nil
 }
 
+// httpBaseFromWS maps the WebSocket endpoint to the server's HTTP root
+// (the /ws path is dropped: /upload, /relay and /api live beside it).
 func httpBaseFromWS(wsAddr string) string {
+	wsAddr = strings.TrimSuffix(strings.TrimRight(wsAddr, "/"), "/ws")
 	if strings.HasPrefix(wsAddr, "wss://") {
 		return "https://" + strings.TrimPrefix(wsAddr, "wss://")
 	}
@@ -75,73 +83,259 @@ func httpBaseFromWS(wsAddr string) string {
 	return "http://" + wsAddr
 }
 
-func uploadFile(ctx context.Context, httpBase, path, contentType string) (uploadURL string, size int, err error) {
+func uploadFile(ctx context.Context, httpBase, token, path, contentType string, burn bool) (uploadURL string, size int, sum string, err error) {
+	// the digest goes in a header, so hash the file before streaming it
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return "", 0, "", err
+	}
 	f, err := os.Open(path)
 	if err != nil {
-		return "", 0, err
+		return "", 0, "", err
 	}
 	defer f.Close()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(httpBase, "/")+"/upload", f)
+	var body io.Reader = f
+	gz := gzipUploads && types.Compressible(contentType)
+	if gz {
+		body = gzipStream(f)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimRight(httpBase, "/")+"/upload", body)
 	if err != nil {
-		return "", 0, err
+		return "", 0, "", err
 	}
 	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest)+":")
+	if gz {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if burn {
+		req.Header.Set("X-Clip-Burn", "1")
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", 0, err
+		return "", 0, "", err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		b, _ := io.ReadAll(resp.Body)
-		return "", 0, fmt.Errorf("upload failed: status=%d body=%s", resp.StatusCode, string(b))
+		return "", 0, "", fmt.Errorf("upload failed: status=%d body=%s", resp.StatusCode, string(b))
 	}
 
 	var out struct {
 		UploadURL string `json:"upload_url"`
 		Size      int    `json:"size"`
+		SHA256    string `json:"sha256"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return "", 0, err
+		return "", 0, "", err
+	}
+	if out.SHA256 == "" {
+		out.SHA256 = hex.EncodeToString(digest) // older servers don't echo it
+	}
+	return out.UploadURL, out.Size, out.SHA256, nil
+}
+
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
 	}
-	return out.UploadURL, out.Size, nil
+	return h.Sum(nil), nil
+}
+
+// verifySHA256 reports whether data matches the clip's hex digest; clips
+// without one are accepted as-is.
+func verifySHA256(data []byte, want string) bool {
+	if want == "" {
+		return true
+	}
+	sum := sha256.Sum256(data)
+	return strings.EqualFold(hex.EncodeToString(sum[:]), want)
+}
+
+// gzipUploads: comprimir el cuerpo de /upload (Content-Encoding: gzip).
+var gzipUploads = true
+
+// gzipStream comprime r al vuelo; el cuerpo no se carga entero en memoria.
+func gzipStream(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, r)
+		if err == nil {
+			err = zw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
 }
 
 /* ---------- modes ---------- */
 
-func runListen(ctx context.Context, c *websocket.Conn) error {
+func runListen(ctx context.Context, c conn, wsAddr, token string) error {
+	base := httpBaseFromWS(wsAddr)
 	for {
-		var env types.Envelope
-		if err := wsjson.Read(ctx, c, &env); err != nil {
+		env, err := c.Read(ctx)
+		if err != nil {
 			return err
 		}
+		from := fromLabel(env)
+		if env.Type == "recall" && env.Recall != nil {
+			fmt.Printf("[from %s] recalled %s\n", from, env.Recall.MsgID)
+			continue
+		}
+		if env.Type == "notice" && env.Notice != nil {
+			fmt.Printf("[notice] %s\n", env.Notice.Text)
+			continue
+		}
+		if printOffer(env) {
+			continue
+		}
 		if env.Type != "clip" || env.Clip == nil {
 			continue
 		}
-		cl := env.Clip
-		if len(cl.Data) > 0 {
-			if strings.HasPrefix(cl.Mime, "text/") {
-				fmt.Printf("[from %s] %s\n", env.From, string(cl.Data))
-			} else {
-				fmt.Printf("[from %s] %s (%d bytes inline)\n", env.From, cl.Mime, len(cl.Data))
-			}
-		} else if cl.UploadURL != "" {
-			fmt.Printf("[from %s] large clip: %s (%d bytes)\n", env.From, cl.UploadURL, cl.Size)
+		printClip(from, env.Clip)
+		if saveDir != "" && len(env.Clip.Data) == 0 && env.Clip.UploadURL != "" {
+			go saveClipFile(ctx, base, token, from, env.Clip)
+		}
+	}
+}
+
+// printClip prints a received clip: text inline, otherwise its size and URL.
+func printClip(from string, cl *types.Clip) {
+	if len(cl.Data) > 0 {
+		if strings.HasPrefix(cl.Mime, "text/") {
+			fmt.Printf("[from %s] %s\n", from, string(cl.Data))
+		} else {
+			fmt.Printf("[from %s] %s (%d bytes inline)\n", from, cl.Mime, len(cl.Data))
+		}
+	} else if cl.UploadURL != "" {
+		fmt.Printf("[from %s] large clip: %s (%d bytes)\n", from, cl.UploadURL, cl.Size)
+	}
+	if cl.ThumbURL != "" {
+		fmt.Printf("[from %s] preview: %s\n", from, cl.ThumbURL)
+	}
+}
+
+// saveDir: where listen and recv store file clips; "" = only print them.
+// Downloading them right away is what lets a relay (--relay) reach this
+// device live instead of through the server's stored copy.
+var saveDir string
+
+// saveClipFile downloads cl into saveDir as <msg_id><ext>, verifying its
+// checksum; a partial or mismatched download is removed.
+func saveClipFile(ctx context.Context, httpBase, token, from string, cl *types.Clip) {
+	path, err := downloadTo(ctx, httpBase, token, cl, saveDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "download of %s from %s failed: %v\n", cl.MsgID, from, err)
+		return
+	}
+	fmt.Printf("[from %s] saved %s\n", from, path)
+}
+
+func downloadTo(ctx context.Context, httpBase, token string, cl *types.Clip, dir string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(httpBase, "/")+cl.UploadURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	sum := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, sum), resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if cl.SHA256 != "" && !strings.EqualFold(hex.EncodeToString(sum.Sum(nil)), cl.SHA256) {
+		return "", errors.New("checksum mismatch")
+	}
+	path := filepath.Join(dir, clipFileName(cl))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// clipFileName names a saved clip after its msg_id, with an extension for
+// its MIME type when one is known.
+func clipFileName(cl *types.Clip) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 {
+			return '_'
 		}
+		return r
+	}, cl.MsgID)
+	if name == "" || name == "." || name == ".." {
+		name = "clip-" + time.Now().UTC().Format("20060102T150405.000")
 	}
+	ext := ""
+	for e, m := range extMime {
+		if m == cl.Mime && (ext == "" || e < ext) {
+			ext = e
+		}
+	}
+	if exts, _ := mime.ExtensionsByType(cl.Mime); ext == "" && len(exts) > 0 {
+		ext = exts[0]
+	}
+	return name + ext
+}
+
+// fromLabel names the sender: the device, or "#channel user/device" for
+// clips that came through a shared channel.
+func fromLabel(env types.Envelope) string {
+	ch := ""
+	if env.Clip != nil {
+		ch = env.Clip.Channel
+	} else if env.Recall != nil {
+		ch = env.Recall.Channel
+	}
+	if ch == "" {
+		return env.From
+	}
+	return "#" + ch + " " + env.User + "/" + env.From
 }
 
 // runRecvApply listens and applies incoming text clips to the OS clipboard.
-func runRecvApply(ctx context.Context, c *websocket.Conn, wsAddr string, markRemote func(hash string), verbose bool) error {
+func runRecvApply(ctx context.Context, c conn, wsAddr, token string, markRemote func(hash string), verbose bool) error {
     base := httpBaseFromWS(wsAddr)
     dd := newDD(512)
+    applied := newAppliedLog(512)
     for {
-        var env types.Envelope
-        if err := wsjson.Read(ctx, c, &env); err != nil {
+        env, err := c.Read(ctx)
+        if err != nil {
             return err
         }
+        if env.Type == "recall" && env.Recall != nil {
+            applyRecall(applied, env.Recall.MsgID, env.From, verbose)
+            continue
+        }
+        if env.Type == "notice" && env.Notice != nil {
+            fmt.Fprintln(os.Stderr, "server notice:", env.Notice.Text)
+            continue
+        }
         if env.Type != "clip" || env.Clip == nil {
             continue
         }
@@ -154,6 +348,7 @@ func runRecvApply(ctx context.Context, c *websocket.Conn, wsAddr string, markRem
             } else if cl.UploadURL != "" {
                 u := strings.TrimRight(base, "/") + cl.UploadURL
                 req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+                req.Header.Set("Authorization", "Bearer "+token)
                 resp, err := http.DefaultClient.Do(req)
                 if err != nil {
                     fmt.Fprintln(os.Stderr, "download failed:", err)
@@ -170,6 +365,10 @@ func runRecvApply(ctx context.Context, c *websocket.Conn, wsAddr string, markRem
             if len(data) == 0 {
                 continue
             }
+            if !verifySHA256(data, cl.SHA256) {
+                fmt.Fprintf(os.Stderr, "checksum mismatch for %s from %s; not applied\n", cl.MsgID, env.From)
+                continue
+            }
             if verbose {
                 fmt.Printf("[recv] applying to clipboard: from=%s bytes=%d backend=%s\n", env.From, len(data), clipboardWriteBackend())
             }
@@ -178,6 +377,7 @@ func runRecvApply(ctx context.Context, c *websocket.Conn, wsAddr string, markRem
                 continue
             }
             markRemote(hashBytes(data))
+            applied.Add(cl.MsgID, hashBytes(data))
             if verbose {
                 // read-back validation
                 if rb, err := getClipboardText(); err == nil {
@@ -191,6 +391,8 @@ func runRecvApply(ctx context.Context, c *websocket.Conn, wsAddr string, markRem
             } else {
                 fmt.Println("clipboard updated from", env.From)
             }
+        } else if saveDir != "" && cl.UploadURL != "" {
+            go saveClipFile(ctx, base, token, env.From, cl)
         } else {
             // non-text: skip for v1
             if verbose {
@@ -201,7 +403,7 @@ func runRecvApply(ctx context.Context, c *websocket.Conn, wsAddr string, markRem
 }
 
 // runWatchLoop polls the clipboard and sends updates. Uses lastRemote to avoid echo.
-func runWatchLoop(ctx context.Context, c *websocket.Conn, wsAddr string, interval time.Duration, lastRemote func() string, clearRemote func(), verbose bool) error {
+func runWatchLoop(ctx context.Context, c conn, wsAddr, token string, interval time.Duration, lastRemote func() string, clearRemote func(), verbose bool) error {
     ticker := time.NewTicker(interval)
     defer ticker.Stop()
     var lastLocal string
@@ -246,7 +448,7 @@ func runWatchLoop(ctx context.Context, c *websocket.Conn, wsAddr string, interva
                 if verbose {
                     fmt.Printf("[watch] sending large via upload bytes=%d hash=%s tmp=%s\n", len(data), msgID, tmpPath)
                 }
-                if err := runSendFileWithMsgID(ctx, c, wsAddr, tmpPath, "text/plain", msgID); err != nil {
+                if err := runSendFileWithMsgID(ctx, c, wsAddr, token, tmpPath, "text/plain", msgID); err != nil {
                     fmt.Fprintln(os.Stderr, "send file failed:", err)
                 }
                 _ = os.Remove(tmpPath)
@@ -256,25 +458,78 @@ func runWatchLoop(ctx context.Context, c *websocket.Conn, wsAddr string, interva
     }
 }
 
-func runSendText(ctx context.Context, c *websocket.Conn, text string) error {
+// runSendText sends text inline and returns its msg_id (needed to recall it).
+func runSendText(ctx context.Context, c conn, text string, burn bool) (string, error) {
 	data := []byte(text)
 	if len(data) > types.MaxInlineBytes {
-		return fmt.Errorf("text payload is %d bytes; exceeds MaxInlineBytes=%d — use --file",
+		return "", fmt.Errorf("text payload is %d bytes; exceeds MaxInlineBytes=%d — use --file",
 			len(data), types.MaxInlineBytes)
 	}
 	env := types.Envelope{
 		Type: "clip",
 		Clip: &types.Clip{
-			MsgID: "m-" + time.Now().UTC().Format("20060102T150405.000Z0700"),
-			Mime:  "text/plain",
-			Size:  len(data),
-			Data:  data,
+			MsgID:   "m-" + time.Now().UTC().Format("20060102T150405.000Z0700"),
+			Mime:    "text/plain",
+			Size:    len(data),
+			Data:    data,
+			Burn:    burn,
+			Channel: sendChannel,
+			To:      sendTo,
 		},
 	}
-	return wsjson.Write(ctx, c, env)
+	return env.Clip.MsgID, c.Write(ctx, env)
+}
+
+// runRecall asks the server to take back msgID on every device.
+func runRecall(ctx context.Context, c conn, msgID string) error {
+	return c.Write(ctx, types.Envelope{Type: "recall", Recall: &types.Recall{MsgID: msgID, Channel: sendChannel}})
+}
+
+// deleteBlob removes an uploaded blob; url may be the upload_url path or
+// a full URL.
+func deleteBlob(ctx context.Context, httpBase, token, url string) error {
+	if strings.HasPrefix(url, "/") {
+		url = strings.TrimRight(httpBase, "/") + url
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("delete failed: status=%d", resp.StatusCode)
+	}
+	return nil
 }
 
-func runSendTextWithMsgID(ctx context.Context, c *websocket.Conn, text, msgID string) error {
+// applyRecall forgets a recalled clip and clears the clipboard if it still
+// holds that clip's content.
+func applyRecall(applied *appliedLog, msgID, from string, verbose bool) {
+	h, ok := applied.Take(msgID)
+	if !ok {
+		if verbose {
+			fmt.Printf("[recv] recall of unknown clip %s from %s\n", msgID, from)
+		}
+		return
+	}
+	cur, err := getClipboardText()
+	if err != nil || hashString(cur) != h {
+		fmt.Printf("clip %s recalled by %s (clipboard already changed)\n", msgID, from)
+		return
+	}
+	if err := setClipboardText(""); err != nil {
+		fmt.Fprintln(os.Stderr, "clear clipboard failed:", err)
+		return
+	}
+	fmt.Printf("clipboard cleared: %s recalled by %s\n", msgID, from)
+}
+
+func runSendTextWithMsgID(ctx context.Context, c conn, text, msgID string) error {
     data := []byte(text)
     if len(data) > types.MaxInlineBytes {
         return fmt.Errorf("text payload is %d bytes; exceeds MaxInlineBytes=%d — use --file",
@@ -284,16 +539,18 @@ func runSendTextWithMsgID(ctx context.Context, c *websocket.Conn, text, msgID st
     env := types.Envelope{
         Type: "clip",
         Clip: &types.Clip{
-            MsgID: msgID,
-            Mime:  "text/plain",
-            Size:  len(data),
-            Data:  data,
+            MsgID:   msgID,
+            Mime:    "text/plain",
+            Size:    len(data),
+            Data:    data,
+            Channel: sendChannel,
+            To:      sendTo,
         },
     }
-    return wsjson.Write(ctx, c, env)
+    return c.Write(ctx, env)
 }
 
-func runSendFile(ctx context.Context, c *websocket.Conn, wsAddr, path, mimeType string) error {
+func runSendFile(ctx context.Context, c conn, wsAddr, token, path, mimeType string, burn bool) error {
     base := httpBaseFromWS(wsAddr)
     upCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
     defer cancel()
@@ -301,7 +558,14 @@ func runSendFile(ctx context.Context, c *websocket.Conn, wsAddr, path, mimeType
 	if mimeType == "" {
 		mimeType = detectMime(path, "application/octet-stream")
 	}
-	uploadURL, size, err := uploadFile(upCtx, base, path, mimeType)
+	if relayUploads && !burn {
+		err := runSendFileRelay(ctx, c, base, token, path, mimeType)
+		if !errors.Is(err, errRelayUnavailable) {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "relay unavailable on this server; uploading instead")
+	}
+	uploadURL, size, sum, err := uploadFile(upCtx, base, token, path, mimeType, burn)
 	if err != nil {
 		return err
 	}
@@ -313,21 +577,133 @@ func runSendFile(ctx context.Context, c *websocket.Conn, wsAddr, path, mimeType
 			Mime:      mimeType,
 			Size:      size,
 			UploadURL: uploadURL,
+			Burn:      burn,
+			SHA256:    sum,
+			Channel:   sendChannel,
+			To:        sendTo,
+		},
+	}
+	if err := c.Write(ctx, env); err != nil {
+		return err
+	}
+	fmt.Printf("sent file: %s (%d bytes) url=%s msg_id=%s\n", path, size, uploadURL, env.Clip.MsgID)
+	return nil
+}
+
+// relayUploads: stream --file through the server to online devices
+// instead of uploading it first (the server stores it only as a fallback).
+var relayUploads bool
+
+// errRelayUnavailable: the server refused to relay (e.g. it scans uploads),
+// so the file has to go through a normal upload.
+var errRelayUnavailable = errors.New("relay unavailable")
+
+// subChannels: shared channels to receive besides the user's own clips.
+var subChannels []string
+
+// sendChannel: shared channel that send and recall address ("" = own devices).
+var sendChannel string
+
+// sendTo: user whose inbox send addresses; the clip waits there as an offer
+// until one of their devices accepts or rejects it.
+var sendTo string
+
+// runSendFileRelay reserves a relay, announces the clip and then streams
+// the file; receivers download it while it is still being sent.
+func runSendFileRelay(ctx context.Context, c conn, httpBase, token, path, mimeType string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimRight(httpBase, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/relay", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", mimeType)
+	req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest)+":")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	var rsv struct {
+		UploadURL string `json:"upload_url"`
+		RelayURL  string `json:"relay_url"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&rsv)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusConflict {
+		return errRelayUnavailable
+	}
+	if resp.StatusCode != http.StatusOK || err != nil {
+		return fmt.Errorf("relay reserve failed: status=%d", resp.StatusCode)
+	}
+
+	env := types.Envelope{
+		Type: "clip",
+		Clip: &types.Clip{
+			MsgID:     "m-" + time.Now().UTC().Format("20060102T150405.000Z0700"),
+			Mime:      mimeType,
+			Size:      int(fi.Size()),
+			UploadURL: rsv.UploadURL,
+			SHA256:    hex.EncodeToString(digest),
+			Channel:   sendChannel,
+			To:        sendTo,
 		},
 	}
-	if err := wsjson.Write(ctx, c, env); err != nil {
+	if err := c.Write(ctx, env); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var body io.Reader = f
+	gz := gzipUploads && types.Compressible(mimeType)
+	if gz {
+		body = gzipStream(f)
+	}
+	// no timeout: the transfer runs at the pace of the receivers
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, base+rsv.RelayURL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if gz {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
 		return err
 	}
-	fmt.Printf("sent file: %s (%d bytes) url=%s\n", path, size, uploadURL)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("relay failed: status=%d body=%s", resp.StatusCode, string(b))
+	}
+	var out struct {
+		Relayed int  `json:"relayed"`
+		Stored  bool `json:"stored"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	fmt.Printf("relayed file: %s (%d bytes) to %d device(s), stored=%v msg_id=%s\n", path, fi.Size(), out.Relayed, out.Stored, env.Clip.MsgID)
 	return nil
 }
 
-func runSendFileWithMsgID(ctx context.Context, c *websocket.Conn, wsAddr, path, mimeType, msgID string) error {
+func runSendFileWithMsgID(ctx context.Context, c conn, wsAddr, token, path, mimeType, msgID string) error {
     base := httpBaseFromWS(wsAddr)
     upCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
     defer cancel()
     if mimeType == "" { mimeType = detectMime(path, "application/octet-stream") }
-    uploadURL, size, err := uploadFile(upCtx, base, path, mimeType)
+    uploadURL, size, sum, err := uploadFile(upCtx, base, token, path, mimeType, false)
     if err != nil { return err }
     if msgID == "" { msgID = "m-" + time.Now().UTC().Format("20060102T150405.000Z0700") }
     env := types.Envelope{
@@ -337,9 +713,12 @@ func runSendFileWithMsgID(ctx context.Context, c *websocket.Conn, wsAddr, path,
             Mime:      mimeType,
             Size:      size,
             UploadURL: uploadURL,
+            SHA256:    sum,
+            Channel:   sendChannel,
+            To:        sendTo,
         },
     }
-    if err := wsjson.Write(ctx, c, env); err != nil { return err }
+    if err := c.Write(ctx, env); err != nil { return err }
     fmt.Printf("sent file: %s (%d bytes) url=%s\n", path, size, uploadURL)
     return nil
 }
@@ -350,19 +729,44 @@ func main() {
     addr := flag.String("addr", "ws://localhost:8080/ws", "WebSocket endpoint")
     token := flag.String("token", "u1", "user token (MVP: token == userID)")
     device := flag.String("device", "A", "device id (unique per device)")
-    mode := flag.String("mode", "listen", "listen|send|recv|watch|sync")
+    mode := flag.String("mode", "listen", "listen|send|recv|watch|sync|recall|delete|inbox|accept|reject")
     text := flag.String("text", "", "text to send (send mode). If empty, read from stdin")
     file := flag.String("file", "", "path to file to send (uses HTTP /upload)")
     mime := flag.String("mime", "", "mime type for --file (auto-detect if empty)")
     poll := flag.Int("poll-ms", 400, "clipboard poll interval for watch/sync")
     verbose := flag.Bool("v", false, "verbose logging (debug)")
+    flag.BoolVar(&gzipUploads, "gzip", true, "gzip-compress uploads of compressible types")
+    burn := flag.Bool("burn", false, "send mode: burn-after-read (receivers fetch once, server deletes it)")
+    flag.BoolVar(&relayUploads, "relay", false, "send mode: stream --file to online devices without storing it first")
+    msgIDFlag := flag.String("msg-id", "", "recall mode: msg_id of the clip to take back")
+    urlFlag := flag.String("url", "", "delete mode: upload_url of the blob to delete")
+    channels := flag.String("channels", "", "comma-separated shared channels to receive besides your own clips")
+    flag.StringVar(&sendChannel, "channel", "", "send/recall mode: shared channel to address instead of your own devices")
+    flag.StringVar(&sendTo, "to", "", "send mode: user whose inbox gets the clip (they accept or reject it)")
+    offerFlag := flag.String("offer", "", "accept/reject mode: id of the inbox offer")
+    flag.StringVar(&saveDir, "save-dir", "", "listen/recv mode: download clips that arrive as uploads into this directory (recv: non-text only), joining relays live")
+    flag.StringVar(&transportMode, "transport", "auto", "auto|ws|poll: auto falls back to HTTP long-polling when the WebSocket dial fails")
     flag.Parse()
+    for _, ch := range strings.Split(*channels, ",") {
+        if ch = strings.TrimSpace(ch); ch != "" {
+            subChannels = append(subChannels, ch)
+        }
+    }
+    if sendChannel != "" && *burn {
+        fatalf(exitUsage, "--burn cannot be used with --channel")
+    }
+    if sendTo != "" && (*burn || relayUploads || sendChannel != "") {
+        fatalf(exitUsage, "--to cannot be used with --burn, --relay or --channel")
+    }
+    if transportMode != "auto" && transportMode != "ws" && transportMode != "poll" {
+        fatalf(exitUsage, "unknown -transport=%q (use auto|ws|poll)", transportMode)
+    }
 
 	switch *mode {
 	case "listen":
         for attempt := 0; ; attempt++ {
             ct, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-            c, err := dialAndHello(ct, *addr, *token, *device)
+            c, err := dialConn(ct, *addr, *token, *device)
             cancel()
             if err != nil {
                 fmt.Fprintln(os.Stderr, "connect failed:", err)
@@ -371,18 +775,18 @@ func main() {
             }
             fmt.Printf("connected to %s as %s (listening)\n", *addr, *device)
             attempt = 0 // reset after a successful connect
-            if err := runListen(context.Background(), c); err != nil {
+            if err := runListen(context.Background(), c, *addr, *token); err != nil {
                 fmt.Fprintln(os.Stderr, "listen error:", err)
             }
             sleepBackoff(attempt)
         }
 
 	case "send":
-		var c *websocket.Conn
+		var c conn
 		var err error
 		for attempt := 0; attempt < 5; attempt++ {
 			ct, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			c, err = dialAndHello(ct, *addr, *token, *device)
+			c, err = dialConn(ct, *addr, *token, *device)
 			cancel()
 			if err == nil {
 				break
@@ -393,10 +797,10 @@ func main() {
 			fmt.Fprintln(os.Stderr, "connect failed:", err)
 			sleepBackoff(attempt)
 		}
-		defer c.Close(websocket.StatusNormalClosure, "")
+		defer c.Close()
 
 		if *file != "" {
-			if err := runSendFile(context.Background(), c, *addr, *file, *mime); err != nil {
+			if err := runSendFile(context.Background(), c, *addr, *token, *file, *mime, *burn); err != nil {
 				fatalf(exitUpload, "%v", err)
 			}
 			return
@@ -404,10 +808,11 @@ func main() {
 
 		payload := strings.TrimSpace(*text)
 		if payload != "" {
-			if err := runSendText(context.Background(), c, payload); err != nil {
+			msgID, err := runSendText(context.Background(), c, payload, *burn)
+			if err != nil {
 				fatalf(exitSend, "%v", err)
 			}
-			fmt.Println("sent")
+			fmt.Println("sent msg_id=" + msgID)
 			return
 		}
 
@@ -419,17 +824,18 @@ func main() {
 			}
 			if tmpPath != "" {
 				defer os.Remove(tmpPath)
-				if err := runSendFile(context.Background(), c, *addr, tmpPath, mimeType); err != nil {
+				if err := runSendFile(context.Background(), c, *addr, *token, tmpPath, mimeType, *burn); err != nil {
 					fatalf(exitUpload, "%v", err)
 				}
 				return
 			}
 			// small payload fits inline
 			_ = size // already len(data)
-			if err := runSendText(context.Background(), c, string(data)); err != nil {
+			msgID, err := runSendText(context.Background(), c, string(data), *burn)
+			if err != nil {
 				fatalf(exitSend, "%v", err)
 			}
-			fmt.Println("sent")
+			fmt.Println("sent msg_id=" + msgID)
 			return
 		}
 
@@ -438,68 +844,111 @@ func main() {
     default:
         switch *mode {
         case "recv":
-            var c *websocket.Conn
+            var c conn
             var err error
             for attempt := 0; attempt < 5; attempt++ {
                 ct, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-                c, err = dialAndHello(ct, *addr, *token, *device)
+                c, err = dialConn(ct, *addr, *token, *device)
                 cancel()
                 if err == nil { break }
                 if attempt == 4 { fatalf(exitConn, "connect failed: %v", err) }
                 fmt.Fprintln(os.Stderr, "connect failed:", err)
                 sleepBackoff(attempt)
             }
-            defer c.Close(websocket.StatusNormalClosure, "")
+            defer c.Close()
             // recv-only does not need local echo prevention state
             mark := func(string){}
-            if err := runRecvApply(context.Background(), c, *addr, mark, *verbose); err != nil {
+            if err := runRecvApply(context.Background(), c, *addr, *token, mark, *verbose); err != nil {
                 fatalf(exitSend, "%v", err)
             }
         case "watch":
-            var c *websocket.Conn
+            var c conn
             var err error
             for attempt := 0; attempt < 5; attempt++ {
                 ct, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-                c, err = dialAndHello(ct, *addr, *token, *device)
+                c, err = dialConn(ct, *addr, *token, *device)
                 cancel()
                 if err == nil { break }
                 if attempt == 4 { fatalf(exitConn, "connect failed: %v", err) }
                 fmt.Fprintln(os.Stderr, "connect failed:", err)
                 sleepBackoff(attempt)
             }
-            defer c.Close(websocket.StatusNormalClosure, "")
+            defer c.Close()
             var mu sync.Mutex
             lr := ""
             getLR := func() string { mu.Lock(); defer mu.Unlock(); return lr }
             clearLR := func(){ mu.Lock(); lr = ""; mu.Unlock() }
-            if err := runWatchLoop(context.Background(), c, *addr, time.Duration(*poll)*time.Millisecond, getLR, clearLR, *verbose); err != nil {
+            if err := runWatchLoop(context.Background(), c, *addr, *token, time.Duration(*poll)*time.Millisecond, getLR, clearLR, *verbose); err != nil {
                 fatalf(exitSend, "%v", err)
             }
         case "sync":
-            var c *websocket.Conn
+            var c conn
             var err error
             for attempt := 0; attempt < 5; attempt++ {
                 ct, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-                c, err = dialAndHello(ct, *addr, *token, *device)
+                c, err = dialConn(ct, *addr, *token, *device)
                 cancel()
                 if err == nil { break }
                 if attempt == 4 { fatalf(exitConn, "connect failed: %v", err) }
                 fmt.Fprintln(os.Stderr, "connect failed:", err)
                 sleepBackoff(attempt)
             }
-            defer c.Close(websocket.StatusNormalClosure, "")
+            defer c.Close()
             var mu sync.Mutex
             lr := ""
             getLR := func() string { mu.Lock(); defer mu.Unlock(); return lr }
             clearLR := func(){ mu.Lock(); lr = ""; mu.Unlock() }
             mark := func(h string){ mu.Lock(); lr = h; mu.Unlock() }
             ctx := context.Background()
-            go func(){ _ = runRecvApply(ctx, c, *addr, mark, *verbose) }()
-            if err := runWatchLoop(ctx, c, *addr, time.Duration(*poll)*time.Millisecond, getLR, clearLR, *verbose); err != nil {
+            go func(){ _ = runRecvApply(ctx, c, *addr, *token, mark, *verbose) }()
+            if err := runWatchLoop(ctx, c, *addr, *token, time.Duration(*poll)*time.Millisecond, getLR, clearLR, *verbose); err != nil {
                 fatalf(exitSend, "%v", err)
             }
+        case "recall":
+            if *msgIDFlag == "" {
+                fatalf(exitUsage, "recall mode: provide --msg-id")
+            }
+            ct, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+            defer cancel()
+            c, err := dialConn(ct, *addr, *token, *device)
+            if err != nil {
+                fatalf(exitConn, "connect failed: %v", err)
+            }
+            defer c.Close()
+            if err := runRecall(ct, c, *msgIDFlag); err != nil {
+                fatalf(exitSend, "%v", err)
+            }
+            fmt.Println("recalled", *msgIDFlag)
+        case "delete":
+            if *urlFlag == "" {
+                fatalf(exitUsage, "delete mode: provide --url")
+            }
+            ct, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            defer cancel()
+            if err := deleteBlob(ct, httpBaseFromWS(*addr), *token, *urlFlag); err != nil {
+                fatalf(exitUpload, "%v", err)
+            }
+            fmt.Println("deleted", *urlFlag)
+        case "inbox":
+            ct, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            defer cancel()
+            if err := runInbox(ct, httpBaseFromWS(*addr), *token); err != nil {
+                fatalf(exitConn, "%v", err)
+            }
+        case "accept", "reject":
+            if *offerFlag == "" {
+                fatalf(exitUsage, "%s mode: provide --offer", *mode)
+            }
+            ct, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            defer cancel()
+            if err := runAnswer(ct, httpBaseFromWS(*addr), *token, *device, *offerFlag, *mode == "accept"); err != nil {
+                fatalf(exitSend, "%v", err)
+            }
+            if *mode == "reject" {
+                fmt.Println("rejected", *offerFlag)
+            }
         default:
-            fatalf(exitUsage, "unknown -mode=%q (use listen|send|recv|watch|sync)", *mode)
+            fatalf(exitUsage, "unknown -mode=%q (use listen|send|recv|watch|sync|recall|delete|inbox|accept|reject)", *mode)
         }
     }
 }
@@ -1,12 +1,17 @@
 package main
 
 import (
+    "bytes"
+    "compress/gzip"
+    "io"
     "os"
     "os/exec"
     "path/filepath"
     "runtime"
     "testing"
     "time"
+
+    "clip-sync/server/pkg/types"
 )
 
 func TestComputeBackoff(t *testing.T) {
@@ -32,6 +37,15 @@ func TestDetectMime(t *testing.T) {
     if got := detectMime("noext", "application/octet-stream"); got != "application/octet-stream" { t.Fatalf("fallback: %s", got) }
 }
 
+func TestGzipStream(t *testing.T) {
+    src := bytes.Repeat([]byte("log line\n"), 5000)
+    zr, err := gzip.NewReader(gzipStream(bytes.NewReader(src)))
+    if err != nil { t.Fatal(err) }
+    got, err := io.ReadAll(zr)
+    if err != nil || !bytes.Equal(got, src) { t.Fatalf("roundtrip mismatch: err=%v", err) }
+    if types.Compressible("image/png") || !types.Compressible("application/json") { t.Fatal("types.Compressible") }
+}
+
 func TestCLI_UnknownMode_ExitCode(t *testing.T) {
     t.Parallel()
     // build binary
@@ -49,3 +63,42 @@ func TestCLI_UnknownMode_ExitCode(t *testing.T) {
     if err == nil { t.Fatal("expected non-zero exit") }
 }
 
+
+func TestVerifySHA256(t *testing.T) {
+    const hola = "b221d9dbb083a7f33428d7c2a3c3198ae925614d70210e28716ccaa7cd4ddb79"
+    if !verifySHA256([]byte("hola"), hola) || !verifySHA256([]byte("x"), "") {
+        t.Fatal("expected match")
+    }
+    if verifySHA256([]byte("hol4"), hola) {
+        t.Fatal("tampered data must not verify")
+    }
+}
+
+func TestHTTPBaseFromWS(t *testing.T) {
+    for in, want := range map[string]string{
+        "ws://localhost:8080/ws":  "http://localhost:8080",
+        "wss://clip.example/ws/":  "https://clip.example",
+        "ws://localhost:8080":     "http://localhost:8080",
+        "localhost:8080/ws":       "http://localhost:8080",
+    } {
+        if got := httpBaseFromWS(in); got != want {
+            t.Errorf("httpBaseFromWS(%q) = %q, want %q", in, got, want)
+        }
+    }
+}
+
+func TestAppliedLog(t *testing.T) {
+    a := newAppliedLog(2)
+    a.Add("m1", "h1")
+    a.Add("m2", "h2")
+    a.Add("m3", "h3") // evicts m1
+    if _, ok := a.Take("m1"); ok {
+        t.Fatal("m1 should have been evicted")
+    }
+    if h, ok := a.Take("m2"); !ok || h != "h2" {
+        t.Fatalf("m2: %q %v", h, ok)
+    }
+    if _, ok := a.Take("m2"); ok {
+        t.Fatal("Take must forget the entry")
+    }
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+
+	"clip-sync/server/pkg/types"
+)
+
+// conn is a session with the server: a WebSocket, or long-polling over
+// plain HTTP when something in between blocks the WebSocket upgrade.
+type conn interface {
+	Write(ctx context.Context, env types.Envelope) error
+	Read(ctx context.Context) (types.Envelope, error)
+	Close() error
+}
+
+// transportMode: auto (WebSocket, falling back to long-poll), ws or poll.
+var transportMode = "auto"
+
+// dialConn opens a session using transportMode.
+func dialConn(ctx context.Context, addr, token, device string) (conn, error) {
+	switch transportMode {
+	case "ws":
+		return dialAndHello(ctx, addr, token, device)
+	case "poll":
+		return dialPoll(ctx, httpBaseFromWS(addr), token, device)
+	}
+	c, err := dialAndHello(ctx, addr, token, device)
+	if err == nil {
+		return c, nil
+	}
+	p, perr := dialPoll(ctx, httpBaseFromWS(addr), token, device)
+	if perr != nil {
+		return nil, fmt.Errorf("%v (long-poll fallback: %v)", err, perr)
+	}
+	fmt.Fprintf(os.Stderr, "websocket unavailable (%v); using long-polling\n", err)
+	return p, nil
+}
+
+type wsConn struct{ c *websocket.Conn }
+
+func (w *wsConn) Write(ctx context.Context, env types.Envelope) error {
+	return wsjson.Write(ctx, w.c, env)
+}
+
+func (w *wsConn) Read(ctx context.Context) (types.Envelope, error) {
+	var env types.Envelope
+	err := wsjson.Read(ctx, w.c, &env)
+	return env, err
+}
+
+func (w *wsConn) Close() error { return w.c.Close(websocket.StatusNormalClosure, "") }
+
+// pollConn speaks /api/poll: each Read long-polls (acknowledging what the
+// previous one returned) and each Write posts to /api/poll/send.
+type pollConn struct {
+	base, token, device string
+
+	mu      sync.Mutex // guards session and cursor; Read and Write may race
+	session string
+	cursor  int64
+	pending []types.Envelope
+}
+
+type pollReply struct {
+	Session   string           `json:"session"`
+	Cursor    int64            `json:"cursor"`
+	Envelopes []types.Envelope `json:"envelopes"`
+}
+
+func dialPoll(ctx context.Context, base, token, device string) (*pollConn, error) {
+	p := &pollConn{base: strings.TrimRight(base, "/"), token: token, device: device}
+	// a poll that does not wait opens the session, like the WebSocket hello
+	if err := p.poll(ctx, 0); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *pollConn) post(ctx context.Context, method, path string, in, out any) error {
+	return doJSON(ctx, p.base, p.token, method, path, in, out)
+}
+
+// doJSON calls a JSON endpoint of the HTTP API with the bearer token; in
+// and out may be nil.
+func doJSON(ctx context.Context, base, token, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status=%d %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// poll fetches queued envelopes, waiting up to wait seconds for some.
+func (p *pollConn) poll(ctx context.Context, wait int) error {
+	p.mu.Lock()
+	req := map[string]any{"session": p.session, "device_id": p.device, "cursor": p.cursor, "wait": wait, "channels": subChannels}
+	p.mu.Unlock()
+	var r pollReply
+	if err := p.post(ctx, http.MethodPost, "/api/poll", req, &r); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.session, p.cursor = r.Session, r.Cursor
+	p.pending = append(p.pending, r.Envelopes...)
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *pollConn) Read(ctx context.Context) (types.Envelope, error) {
+	for {
+		p.mu.Lock()
+		if len(p.pending) > 0 {
+			env := p.pending[0]
+			p.pending = p.pending[1:]
+			p.mu.Unlock()
+			return env, nil
+		}
+		p.mu.Unlock()
+		if err := p.poll(ctx, 25); err != nil {
+			return types.Envelope{}, err
+		}
+	}
+}
+
+func (p *pollConn) Write(ctx context.Context, env types.Envelope) error {
+	p.mu.Lock()
+	session := p.session
+	p.mu.Unlock()
+	return p.post(ctx, http.MethodPost, "/api/poll/send", map[string]any{"session": session, "envelope": env}, nil)
+}
+
+func (p *pollConn) Close() error {
+	p.mu.Lock()
+	session := p.session
+	p.mu.Unlock()
+	return p.post(context.Background(), http.MethodDelete, "/api/poll/"+session, nil, nil)
+}
@@ -0,0 +1,338 @@
+// clipsync-admin gestiona un servidor clip-sync por su API de
+// administración (/admin/*): usuarios, sesiones, tokens, almacenamiento y
+// métricas, en tabla o en JSON.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"clip-sync/server/internal/auth"
+	"clip-sync/server/internal/httpapi"
+	"clip-sync/server/internal/ws"
+)
+
+const (
+	exitErr   = 1
+	exitUsage = 2
+)
+
+const usage = `usage: clipsync-admin [--server URL] [--token TOKEN] [--json] <command>
+
+commands:
+  users                                   users with connected devices or stored blobs
+  sessions [--user U]                     live connections
+  kick [--reason R] USER [DEVICE]         disconnect a device, or all of a user's devices
+  notice [--user U] [--level L] TEXT      send a system notice to connected devices
+  token mint [--ttl 720h] USER            mint a user token
+  token revoke TOKEN                      revoke a token until it expires
+  token revoked                           list revoked tokens
+  storage                                 storage usage per user
+  storage rebuild                         recompute usage from disk
+  storage blobs (--user U | --all)        list stored blobs
+  storage purge (--user U | --all) [--older-than D]
+                                          delete stored blobs
+  metrics                                 server counters (/healthz)
+
+--server and --token default to CLIPSYNC_ADMIN_URL and CLIPSYNC_ADMIN_TOKEN.
+`
+
+// errUsage: argumentos mal puestos; run ya imprimió el motivo.
+var errUsage = errors.New("usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("clipsync-admin", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	server := fs.String("server", envOr("CLIPSYNC_ADMIN_URL", "http://localhost:8080"), "server base URL")
+	token := fs.String("token", os.Getenv("CLIPSYNC_ADMIN_TOKEN"), "admin token")
+	asJSON := fs.Bool("json", false, "print the raw JSON response")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	c := &client{base: strings.TrimRight(*server, "/"), token: *token, out: stdout, json: *asJSON}
+	if err := c.dispatch(fs.Arg(0), fs.Args()[1:], stderr); err != nil {
+		if errors.Is(err, errUsage) {
+			return exitUsage
+		}
+		fmt.Fprintln(stderr, "clipsync-admin:", err)
+		return exitErr
+	}
+	return 0
+}
+
+type client struct {
+	base, token string
+	out         io.Writer
+	json        bool
+}
+
+func (c *client) dispatch(cmd string, args []string, stderr io.Writer) error {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	user := fs.String("user", "", "user id")
+	all := fs.Bool("all", false, "every user")
+	reason := fs.String("reason", "", "close reason shown to the device")
+	level := fs.String("level", "info", "notice level: info|warning")
+	ttl := fs.Duration("ttl", 0, "token lifetime (default: server default)")
+	olderThan := fs.Duration("older-than", 0, "only blobs older than this")
+	if cmd == "token" || cmd == "storage" {
+		// subcomando de dos palabras: sus flags van detrás
+		if len(args) > 0 {
+			cmd, args = cmd+" "+args[0], args[1:]
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	pos := fs.Args()
+	need := func(min, max int) error {
+		if len(pos) < min || len(pos) > max {
+			fmt.Fprintf(stderr, "clipsync-admin %s: wrong number of arguments\n", cmd)
+			return errUsage
+		}
+		return nil
+	}
+	oneOf := func() error {
+		if (*user == "") == !*all {
+			fmt.Fprintf(stderr, "clipsync-admin %s: give either --user or --all\n", cmd)
+			return errUsage
+		}
+		return nil
+	}
+
+	switch cmd {
+	case "users":
+		var list []struct {
+			User    string   `json:"user"`
+			Devices []string `json:"devices"`
+			httpapi.Usage
+		}
+		return c.call(http.MethodGet, "/admin/users", nil, &list, func(tw *tabwriter.Writer) {
+			fmt.Fprintln(tw, "USER\tDEVICES\tBLOBS\tBYTES")
+			for _, u := range list {
+				fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", u.User, strings.Join(u.Devices, ","), u.Blobs, u.Bytes)
+			}
+		})
+	case "sessions":
+		var list []ws.Session
+		path := "/admin/sessions"
+		if *user != "" {
+			path += "?user=" + url.QueryEscape(*user)
+		}
+		return c.call(http.MethodGet, path, nil, &list, func(tw *tabwriter.Writer) {
+			fmt.Fprintln(tw, "USER\tDEVICE\tTRANSPORT\tREMOTE\tCONNECTED\tIN\tOUT\tDROPS")
+			for _, s := range list {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\n", s.User, s.Device, s.Transport, s.RemoteAddr,
+					s.ConnectedAt.Local().Format(time.DateTime), s.BytesIn, s.BytesOut, s.Drops)
+			}
+		})
+	case "kick":
+		if err := need(1, 2); err != nil {
+			return err
+		}
+		path := "/admin/sessions/" + url.PathEscape(pos[0])
+		if len(pos) == 2 {
+			path += "/" + url.PathEscape(pos[1])
+		}
+		if *reason != "" {
+			path += "?reason=" + url.QueryEscape(*reason)
+		}
+		var resp struct{ Kicked int }
+		return c.call(http.MethodDelete, path, nil, &resp, func(tw *tabwriter.Writer) {
+			fmt.Fprintf(tw, "kicked %d connection(s)\n", resp.Kicked)
+		})
+	case "notice":
+		if err := need(1, 1); err != nil {
+			return err
+		}
+		req := map[string]string{"text": pos[0], "level": *level, "user": *user}
+		var resp struct{ Delivered int }
+		return c.call(http.MethodPost, "/admin/notice", req, &resp, func(tw *tabwriter.Writer) {
+			fmt.Fprintf(tw, "delivered to %d device(s)\n", resp.Delivered)
+		})
+	case "token mint":
+		if err := need(1, 1); err != nil {
+			return err
+		}
+		req := map[string]any{"user": pos[0], "ttl": int64(ttl.Seconds())}
+		var resp struct {
+			Token   string    `json:"token"`
+			Expires time.Time `json:"expires"`
+		}
+		return c.call(http.MethodPost, "/admin/tokens", req, &resp, func(tw *tabwriter.Writer) {
+			// solo el token en la salida estándar, para poder capturarlo
+			fmt.Fprintln(tw, resp.Token)
+			fmt.Fprintf(stderr, "expires %s\n", resp.Expires.Local().Format(time.DateTime))
+		})
+	case "token revoke":
+		if err := need(1, 1); err != nil {
+			return err
+		}
+		var rev auth.Revocation
+		return c.call(http.MethodPost, "/admin/tokens/revoke", map[string]string{"token": pos[0]}, &rev, func(tw *tabwriter.Writer) {
+			fmt.Fprintf(tw, "revoked token of %s\n", rev.User)
+		})
+	case "token revoked":
+		var list []auth.Revocation
+		return c.call(http.MethodGet, "/admin/tokens/revoked", nil, &list, func(tw *tabwriter.Writer) {
+			fmt.Fprintln(tw, "USER\tREVOKED\tEXPIRES\tHASH")
+			for _, r := range list {
+				exp := "never"
+				if r.Expires != 0 {
+					exp = time.Unix(r.Expires, 0).Local().Format(time.DateTime)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%.12s\n", r.User, r.RevokedAt.Local().Format(time.DateTime), exp, r.Hash)
+			}
+		})
+	case "storage", "storage rebuild":
+		method, path := http.MethodGet, "/admin/usage"
+		if cmd == "storage rebuild" {
+			method, path = http.MethodPost, "/admin/usage/rebuild"
+		}
+		var resp struct {
+			Total httpapi.Usage `json:"total"`
+			Users []struct {
+				User string `json:"user"`
+				httpapi.Usage
+			} `json:"users"`
+		}
+		return c.call(method, path, nil, &resp, func(tw *tabwriter.Writer) {
+			fmt.Fprintln(tw, "USER\tBLOBS\tBYTES")
+			for _, u := range resp.Users {
+				fmt.Fprintf(tw, "%s\t%d\t%d\n", orAnon(u.User), u.Blobs, u.Bytes)
+			}
+			fmt.Fprintf(tw, "TOTAL\t%d\t%d\n", resp.Total.Blobs, resp.Total.Bytes)
+		})
+	case "storage blobs":
+		if err := oneOf(); err != nil {
+			return err
+		}
+		q := url.Values{"user": {*user}}
+		if *all {
+			q = url.Values{"all": {"1"}}
+		}
+		var list []httpapi.BlobInfo
+		return c.call(http.MethodGet, "/admin/blobs?"+q.Encode(), nil, &list, func(tw *tabwriter.Writer) {
+			fmt.Fprintln(tw, "ID\tOWNER\tMIME\tBYTES\tCREATED\tFLAGS")
+			for _, b := range list {
+				var flags []string
+				if b.Burn {
+					flags = append(flags, "burn")
+				}
+				if b.Orphan {
+					flags = append(flags, "orphan")
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", b.ID, orAnon(b.Owner), b.Mime, b.Size,
+					b.Created.Local().Format(time.DateTime), strings.Join(flags, ","))
+			}
+		})
+	case "storage purge":
+		if err := oneOf(); err != nil {
+			return err
+		}
+		req := map[string]any{"user": *user, "all": *all, "older_than": int64(olderThan.Seconds())}
+		var freed httpapi.Usage
+		return c.call(http.MethodPost, "/admin/blobs/purge", req, &freed, func(tw *tabwriter.Writer) {
+			fmt.Fprintf(tw, "deleted %d blob(s), %d bytes\n", freed.Blobs, freed.Bytes)
+		})
+	case "metrics":
+		var m map[string]int64
+		return c.call(http.MethodGet, "/healthz", nil, &m, func(tw *tabwriter.Writer) {
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				fmt.Fprintf(tw, "%s\t%d\n", k, m[k])
+			}
+		})
+	default:
+		fmt.Fprintf(stderr, "clipsync-admin: unknown command %q\n", cmd)
+		fs.Usage()
+		return errUsage
+	}
+}
+
+// call hace la petición y, según --json, imprime la respuesta tal cual o
+// la decodifica en out y la pinta con table.
+func (c *client) call(method, path string, in, out any, table func(tw *tabwriter.Writer)) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: status=%d %s", method, path, resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	if c.json {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		_, err := buf.WriteTo(c.out)
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("%s %s: %v", method, path, err)
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func orAnon(user string) string {
+	if user == "" {
+		return "(anonymous)"
+	}
+	return user
+}
+
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
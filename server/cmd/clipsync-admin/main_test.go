@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"clip-sync/server/internal/admin"
+	"clip-sync/server/internal/auth"
+	"clip-sync/server/internal/httpapi"
+	"clip-sync/server/internal/ws"
+)
+
+func TestRun_TablesAndJSON(t *testing.T) {
+	wss := &ws.Server{}
+	sub, _ := wss.Subscribe("ana", "laptop", 0, "sse", "10.0.0.1:5000")
+	defer sub.Close()
+	tokens := &auth.Tokens{Secret: "s3cr3t"}
+	mux := http.NewServeMux()
+	(&admin.Server{Token: "secreto", WS: wss, Tokens: tokens, Uploads: &httpapi.UploadServer{Dir: t.TempDir()}}).Register(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cli := func(args ...string) (int, string, string) {
+		var out, errOut bytes.Buffer
+		code := run(append([]string{"--server", srv.URL, "--token", "secreto"}, args...), &out, &errOut)
+		return code, out.String(), errOut.String()
+	}
+
+	code, out, _ := cli("sessions")
+	if code != 0 || !strings.Contains(out, "laptop") || !strings.Contains(out, "10.0.0.1:5000") {
+		t.Fatalf("sessions: %d %q", code, out)
+	}
+	code, out, _ = cli("--json", "users")
+	if code != 0 || !strings.Contains(out, `"devices": [`) {
+		t.Fatalf("users --json: %d %q", code, out)
+	}
+	code, out, _ = cli("token", "mint", "--ttl", "1h", "ana")
+	tok := strings.TrimSpace(out)
+	if uid, ok := tokens.Verify(tok); code != 0 || !ok || uid != "ana" {
+		t.Fatalf("mint: %d %q", code, out)
+	}
+	if code, _, _ := cli("token", "revoke", tok); code != 0 {
+		t.Fatalf("revoke: %d", code)
+	}
+	if code, out, _ := cli("token", "revoked"); code != 0 || !strings.Contains(out, "ana") {
+		t.Fatalf("revoked: %d %q", code, out)
+	}
+	if code, _, _ := cli("kick", "--reason", "incidente", "ana"); code != 0 || sub.Reason() != "incidente" {
+		t.Fatalf("kick: %d %q", code, sub.Reason())
+	}
+
+	if code, _, _ := cli("storage", "purge"); code != exitUsage {
+		t.Fatalf("purge sin --user ni --all: %d", code)
+	}
+	if code, _, errOut := cli("--token", "malo", "users"); code != exitErr || !strings.Contains(errOut, "401") {
+		t.Fatalf("token malo: %d %q", code, errOut)
+	}
+}
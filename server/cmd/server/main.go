@@ -31,6 +31,25 @@ func main() {
     logLevel := flag.String("log-level", envOr("CLIPSYNC_LOG_LEVEL", "info"), "log level: debug|info|error|off")
     pprofEn := flag.Bool("pprof", envOr("CLIPSYNC_PPROF", "") != "", "enable /debug/pprof endpoints")
     expvarEn := flag.Bool("expvar", envOr("CLIPSYNC_EXPVAR", "") != "", "enable /debug/vars endpoint")
+    channelsFile := flag.String("channels-file", envOr("CLIPSYNC_CHANNELS_FILE", ""), "JSON file persisting shared channels and their members (empty = in memory)")
+    revokedFile := flag.String("revoked-file", envOr("CLIPSYNC_REVOKED_FILE", ""), "JSON file persisting revoked user tokens (empty = in memory)")
+    policySpec := flag.String("policy", envOr("CLIPSYNC_POLICY", ""), "content policy for text clips: builtin, or a JSON rules file (empty = off)")
+    policyAll := flag.Bool("policy-all", envOr("CLIPSYNC_POLICY_ALL", "") != "", "apply the content policy to every user, with no opt-out")
+    policyUsers := flag.String("policy-users-file", envOr("CLIPSYNC_POLICY_USERS_FILE", ""), "JSON file persisting each user's content policy choice (empty = in memory)")
+    webhookURLs := flag.String("webhook-urls", envOr("CLIPSYNC_WEBHOOK_URLS", ""), "comma-separated URLs receiving webhook events (empty = off)")
+    webhookSecret := flag.String("webhook-secret", envOr("CLIPSYNC_WEBHOOK_SECRET", ""), "HMAC secret signing webhook payloads")
+    webhookEvents := flag.String("webhook-events", envOr("CLIPSYNC_WEBHOOK_EVENTS", ""), "comma-separated webhook events to send: clip,device.join,device.leave,upload (empty = all)")
+    webhookQueue := flag.Int("webhook-queue", func() int { if v := os.Getenv("CLIPSYNC_WEBHOOK_QUEUE"); v != "" { if n, err := strconv.Atoi(v); err == nil { return n } }; return 1000 }(), "max pending webhook deliveries; new events are dropped when full")
+    webEn := flag.Bool("web", envOr("CLIPSYNC_WEB", "") != "", "serve the web dashboard under /web/")
+    keyFile := flag.String("upload-key-file", envOr("CLIPSYNC_UPLOAD_KEYFILE", ""), "keyring file enabling encryption at rest (\"<kid> <base64 key>\" per line, first is active)")
+    compress := flag.Bool("upload-compress", envOr("CLIPSYNC_UPLOAD_COMPRESS", "") != "", "store compressible uploads gzip-compressed")
+    sniffPolicy := flag.String("sniff", envOr("CLIPSYNC_SNIFF", "off"), "content sniffing when bytes do not match the declared MIME: off|reject|correct")
+    relayWait := flag.Int("relay-wait", func() int { if v := os.Getenv("CLIPSYNC_RELAY_WAIT"); v != "" { if n, err := strconv.Atoi(v); err == nil { return n } }; return 5 }(), "seconds a relay upload waits for recipients to connect")
+    relayMax := flag.Int("relay-max-bytes", func() int { if v := os.Getenv("CLIPSYNC_RELAY_MAXBYTES"); v != "" { if n, err := strconv.Atoi(v); err == nil { return n } }; return 0 }(), "max bytes streamed through a relay without storing (0 = unlimited)")
+    orphanGrace := flag.Int("orphan-grace", func() int { if v := os.Getenv("CLIPSYNC_ORPHAN_GRACE"); v != "" { if n, err := strconv.Atoi(v); err == nil { return n } }; return 3600 }(), "seconds before an upload no clip refers to is deleted (0 = never)")
+    scanSpec := flag.String("scan", envOr("CLIPSYNC_SCAN", ""), "scan uploads before publishing them: clamd:<unix socket> or command:<program> [args] (file path appended)")
+    scanAction := flag.String("scan-action", envOr("CLIPSYNC_SCAN_ACTION", "reject"), "what to do with flagged uploads: reject|quarantine")
+    rewrap := flag.Bool("rewrap-keys", false, "re-wrap every blob key with the active key of --upload-key-file and exit")
     flag.Parse()
 
     // Pasar flags a env para que NewApp los tome
@@ -39,10 +58,40 @@ func main() {
     _ = os.Setenv("CLIPSYNC_INLINE_MAXBYTES", fmt.Sprintf("%d", *inlineMax))
     _ = os.Setenv("CLIPSYNC_UPLOAD_ALLOWED", *uploadAllowed)
     _ = os.Setenv("CLIPSYNC_LOG_LEVEL", *logLevel)
+    _ = os.Setenv("CLIPSYNC_UPLOAD_KEYFILE", *keyFile)
+    _ = os.Setenv("CLIPSYNC_SNIFF", *sniffPolicy)
+    _ = os.Setenv("CLIPSYNC_RELAY_WAIT", fmt.Sprintf("%d", *relayWait))
+    _ = os.Setenv("CLIPSYNC_RELAY_MAXBYTES", fmt.Sprintf("%d", *relayMax))
+    _ = os.Setenv("CLIPSYNC_ORPHAN_GRACE", fmt.Sprintf("%d", *orphanGrace))
+    _ = os.Setenv("CLIPSYNC_SCAN", *scanSpec)
+    _ = os.Setenv("CLIPSYNC_SCAN_ACTION", *scanAction)
+    _ = os.Setenv("CLIPSYNC_CHANNELS_FILE", *channelsFile)
+    _ = os.Setenv("CLIPSYNC_REVOKED_FILE", *revokedFile)
+    _ = os.Setenv("CLIPSYNC_POLICY", *policySpec)
+    _ = os.Setenv("CLIPSYNC_POLICY_USERS_FILE", *policyUsers)
+    _ = os.Setenv("CLIPSYNC_WEBHOOK_URLS", *webhookURLs)
+    _ = os.Setenv("CLIPSYNC_WEBHOOK_SECRET", *webhookSecret)
+    _ = os.Setenv("CLIPSYNC_WEBHOOK_EVENTS", *webhookEvents)
+    _ = os.Setenv("CLIPSYNC_WEBHOOK_QUEUE", strconv.Itoa(*webhookQueue))
+    if *compress { _ = os.Setenv("CLIPSYNC_UPLOAD_COMPRESS", "1") } else { _ = os.Unsetenv("CLIPSYNC_UPLOAD_COMPRESS") }
     if *pprofEn { _ = os.Setenv("CLIPSYNC_PPROF", "1") } else { _ = os.Unsetenv("CLIPSYNC_PPROF") }
     if *expvarEn { _ = os.Setenv("CLIPSYNC_EXPVAR", "1") } else { _ = os.Unsetenv("CLIPSYNC_EXPVAR") }
+    if *policyAll { _ = os.Setenv("CLIPSYNC_POLICY_ALL", "1") } else { _ = os.Unsetenv("CLIPSYNC_POLICY_ALL") }
+    if *webEn { _ = os.Setenv("CLIPSYNC_WEB", "1") } else { _ = os.Unsetenv("CLIPSYNC_WEB") }
 
-    a := app.NewApp()
+    a, err := app.NewApp()
+    if err != nil {
+        log.Fatalf("config: %v", err)
+    }
+
+    if *rewrap {
+        n, err := a.Uploads.RewrapKeys()
+        if err != nil {
+            log.Fatalf("rewrap keys: %v (%d re-wrapped)", err, n)
+        }
+        log.Printf("re-wrapped %d blob keys", n)
+        return
+    }
 
     srv := &http.Server{
         Addr:    *addr,
@@ -64,7 +113,7 @@ func main() {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
-    a.WSS.Shutdown(ctx)
+    a.Shutdown(ctx)
     if err := srv.Shutdown(ctx); err != nil {
         log.Printf("http shutdown: %v", err)
     }
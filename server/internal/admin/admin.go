@@ -0,0 +1,292 @@
+// Package admin expone endpoints de operación bajo /admin/, protegidos por
+// un token de administrador distinto de los tokens de usuario.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"clip-sync/server/internal/auth"
+	"clip-sync/server/internal/httpapi"
+	"clip-sync/server/internal/ws"
+	"clip-sync/server/pkg/types"
+)
+
+// Server agrupa los handlers de administración.
+type Server struct {
+	Token   string // vacío = API de administración desactivada
+	Uploads *httpapi.UploadServer
+	WS      *ws.Server   // nil = sin endpoints de sesiones
+	Tokens  *auth.Tokens // nil = sin endpoints de tokens
+}
+
+// Register monta las rutas en mux. Sin Token no registra nada: mejor un
+// 404 que una API de administración abierta.
+func (s *Server) Register(mux *http.ServeMux) {
+	if s.Token == "" {
+		return
+	}
+	mux.HandleFunc("GET /admin/usage", s.guard(s.usage))
+	mux.HandleFunc("POST /admin/usage/rebuild", s.guard(s.rebuildUsage))
+	mux.HandleFunc("GET /admin/blobs", s.guard(s.blobs))
+	mux.HandleFunc("POST /admin/blobs/purge", s.guard(s.purge))
+	if s.WS != nil {
+		mux.HandleFunc("GET /admin/sessions", s.guard(s.sessions))
+		mux.HandleFunc("DELETE /admin/sessions/{user}", s.guard(s.kick))
+		mux.HandleFunc("DELETE /admin/sessions/{user}/{device}", s.guard(s.kick))
+		mux.HandleFunc("POST /admin/notice", s.guard(s.notice))
+		mux.HandleFunc("GET /admin/users", s.guard(s.users))
+	}
+	if s.Tokens != nil {
+		mux.HandleFunc("POST /admin/tokens", s.guard(s.mintToken))
+		mux.HandleFunc("GET /admin/tokens/revoked", s.guard(s.revokedTokens))
+		mux.HandleFunc("POST /admin/tokens/revoke", s.guard(s.revokeToken))
+	}
+}
+
+// guard exige el token de administrador (Bearer o ?token=).
+func (s *Server) guard(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tok := httpapi.TokenFromRequest(r)
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(s.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="clip-sync-admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+type userUsage struct {
+	User string `json:"user"` // "" = uploads anónimos
+	httpapi.Usage
+}
+
+type usageResp struct {
+	Total httpapi.Usage `json:"total"`
+	Users []userUsage   `json:"users"` // de más a menos bytes
+}
+
+func (s *Server) usage(w http.ResponseWriter, r *http.Request) {
+	total, users := s.Uploads.UsageSnapshot()
+	resp := usageResp{Total: total, Users: make([]userUsage, 0, len(users))}
+	for uid, u := range users {
+		resp.Users = append(resp.Users, userUsage{User: uid, Usage: u})
+	}
+	sort.Slice(resp.Users, func(i, j int) bool {
+		a, b := resp.Users[i], resp.Users[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.User < b.User
+	})
+	writeJSON(w, resp)
+}
+
+// rebuildUsage recalcula el uso desde disco y devuelve el resultado.
+func (s *Server) rebuildUsage(w http.ResponseWriter, r *http.Request) {
+	if err := s.Uploads.RebuildUsage(); err != nil {
+		http.Error(w, "rebuild failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.usage(w, r)
+}
+
+// sessions lista las conexiones vivas (?user= filtra por usuario).
+func (s *Server) sessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.WS.Sessions(r.URL.Query().Get("user")))
+}
+
+// maxReason: un close frame de WebSocket admite 123 bytes de motivo.
+const maxReason = 123
+
+// kick desconecta un dispositivo, o todos los del usuario, con ?reason=.
+func (s *Server) kick(w http.ResponseWriter, r *http.Request) {
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "kicked by admin"
+	}
+	if len(reason) > maxReason {
+		http.Error(w, "reason too long", http.StatusBadRequest)
+		return
+	}
+	n := s.WS.Kick(r.PathValue("user"), r.PathValue("device"), reason)
+	if n == 0 {
+		http.Error(w, "no such session", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]int{"kicked": n})
+}
+
+type noticeReq struct {
+	User string `json:"user"` // "" = todos los usuarios
+	types.Notice
+}
+
+// notice envía un aviso del sistema a los dispositivos conectados.
+func (s *Server) notice(w http.ResponseWriter, r *http.Request) {
+	var req noticeReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if req.Text == "" {
+		http.Error(w, "text required", http.StatusBadRequest)
+		return
+	}
+	switch req.Level {
+	case "":
+		req.Level = "info"
+	case "info", "warning":
+	default:
+		http.Error(w, "level must be info or warning", http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]int{"delivered": s.WS.Notify(req.User, req.Notice)})
+}
+
+// blobs lista los blobs de ?user= (todos con ?all=1), más nuevos primero.
+func (s *Server) blobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	list, err := s.Uploads.Blobs(q.Get("user"), q.Get("all") == "1")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, list)
+}
+
+type purgeReq struct {
+	User      string `json:"user"`
+	All       bool   `json:"all"`
+	OlderThan int64  `json:"older_than"` // segundos; 0 = todos
+}
+
+// purge borra blobs de un usuario (o de todos con "all") más viejos que
+// older_than y devuelve cuánto liberó.
+func (s *Server) purge(w http.ResponseWriter, r *http.Request) {
+	var req purgeReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	// sin usuario ni "all" explícito no se borra nada: un {} no debe
+	// vaciar el almacenamiento de los anónimos por error
+	if (req.User == "") == !req.All || req.OlderThan < 0 {
+		http.Error(w, "give either user or all", http.StatusBadRequest)
+		return
+	}
+	freed, err := s.Uploads.Purge(req.User, req.All, time.Now().Add(-time.Duration(req.OlderThan)*time.Second))
+	if err != nil {
+		http.Error(w, "purge failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, freed)
+}
+
+type userResp struct {
+	User    string   `json:"user"`
+	Devices []string `json:"devices"` // conectados ahora
+	httpapi.Usage
+}
+
+// users lista los usuarios con dispositivos conectados o blobs guardados.
+func (s *Server) users(w http.ResponseWriter, r *http.Request) {
+	byUser := map[string]*userResp{}
+	get := func(uid string) *userResp {
+		if byUser[uid] == nil {
+			byUser[uid] = &userResp{User: uid, Devices: []string{}}
+		}
+		return byUser[uid]
+	}
+	for _, se := range s.WS.Sessions("") {
+		u := get(se.User)
+		u.Devices = append(u.Devices, se.Device)
+	}
+	if s.Uploads != nil {
+		_, usage := s.Uploads.UsageSnapshot()
+		for uid, us := range usage {
+			get(uid).Usage = us
+		}
+	}
+	out := make([]*userResp, 0, len(byUser))
+	for _, u := range byUser {
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].User < out[j].User })
+	writeJSON(w, out)
+}
+
+// defaultTokenTTL: vida de un token emitido sin "ttl".
+const defaultTokenTTL = 30 * 24 * time.Hour
+
+type tokenReq struct {
+	User  string `json:"user"`
+	TTL   int64  `json:"ttl"` // segundos
+	Token string `json:"token"`
+}
+
+type tokenResp struct {
+	User    string    `json:"user"`
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+// mintToken emite un token de usuario firmado con el secreto del server.
+func (s *Server) mintToken(w http.ResponseWriter, r *http.Request) {
+	var req tokenReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	ttl := defaultTokenTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+	tok, exp, err := s.Tokens.Mint(req.User, ttl)
+	if err != nil {
+		http.Error(w, err.Error(), tokenStatus(err))
+		return
+	}
+	writeJSON(w, tokenResp{User: req.User, Token: tok, Expires: exp.UTC()})
+}
+
+func (s *Server) revokedTokens(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.Tokens.Revoked())
+}
+
+// revokeToken invalida {"token": ...} hasta que caduque. Las conexiones ya
+// abiertas con él siguen hasta que se desconecten (o se las eche).
+func (s *Server) revokeToken(w http.ResponseWriter, r *http.Request) {
+	var req tokenReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	rev, err := s.Tokens.Revoke(req.Token)
+	if err != nil {
+		http.Error(w, err.Error(), tokenStatus(err))
+		return
+	}
+	writeJSON(w, rev)
+}
+
+func tokenStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrNoSecret):
+		return http.StatusConflict
+	case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrInvalidUser):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,146 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"clip-sync/server/internal/auth"
+	"clip-sync/server/internal/httpapi"
+	"clip-sync/server/internal/ws"
+)
+
+func TestUsage_RequiresTokenAndSortsByBytes(t *testing.T) {
+	up := &httpapi.UploadServer{
+		Dir: t.TempDir(), MaxBytes: 1 << 20,
+		Auth: func(tok string) (string, bool) { return tok, tok != "" },
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /upload", up.Upload)
+	(&Server{Token: "secreto", Uploads: up}).Register(mux)
+
+	for uid, body := range map[string]string{"poco": "x", "mucho": strings.Repeat("x", 100)} {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+uid)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("upload %s: %d", uid, rr.Code)
+		}
+	}
+
+	for _, tok := range []string{"", "mucho"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("token %q: status=%d, want 401", tok, rr.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/usage/rebuild?token=secreto", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var resp usageResp
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status=%d err=%v", rr.Code, err)
+	}
+	if resp.Total.Blobs != 2 || len(resp.Users) != 2 || resp.Users[0].User != "mucho" || resp.Users[0].Bytes != 100 {
+		t.Fatalf("resp=%+v", resp)
+	}
+}
+
+func TestRegister_DisabledWithoutToken(t *testing.T) {
+	mux := http.NewServeMux()
+	(&Server{}).Register(mux)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status=%d, want 404", rr.Code)
+	}
+}
+
+func TestSessions_ListNoticeKick(t *testing.T) {
+	wss := &ws.Server{}
+	laptop, _ := wss.Subscribe("u1", "laptop", 0, "sse", "10.0.0.1:5000")
+	phone, _ := wss.Subscribe("u1", "phone", 0, "poll", "10.0.0.2:5000")
+	other, _ := wss.Subscribe("u2", "pc", 0, "sse", "")
+	defer other.Close()
+	mux := http.NewServeMux()
+	(&Server{Token: "secreto", WS: wss}).Register(mux)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secreto")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var list []ws.Session
+	rr := do(http.MethodGet, "/admin/sessions?user=u1", "")
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil || len(list) != 2 {
+		t.Fatalf("sesiones: %d %v %+v", rr.Code, err, list)
+	}
+	if list[0].Device != "laptop" || list[0].Transport != "sse" || list[0].RemoteAddr != "10.0.0.1:5000" {
+		t.Fatalf("sesión: %+v", list[0])
+	}
+
+	if rr := do(http.MethodPost, "/admin/notice", `{"text":"mantenimiento","level":"warning"}`); !strings.Contains(rr.Body.String(), `"delivered":3`) {
+		t.Fatalf("aviso: %d %s", rr.Code, rr.Body)
+	}
+	ev, ok := laptop.TryNext()
+	if !ok || ev.Env.Type != "notice" || ev.Env.Notice.Text != "mantenimiento" {
+		t.Fatalf("no llegó el aviso: %+v", ev)
+	}
+
+	if rr := do(http.MethodDelete, "/admin/sessions/u1/phone?reason=incidente", ""); rr.Code != http.StatusOK {
+		t.Fatalf("kick: %d", rr.Code)
+	}
+	if phone.Reason() != "incidente" {
+		t.Fatalf("motivo=%q", phone.Reason())
+	}
+	if got := wss.Sessions("u1"); len(got) != 1 || got[0].Device != "laptop" {
+		t.Fatalf("tras kick: %+v", got)
+	}
+	if rr := do(http.MethodDelete, "/admin/sessions/u1", ""); rr.Code != http.StatusOK || laptop.Reason() == "" {
+		t.Fatalf("kick usuario: %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/admin/sessions/u1", ""); rr.Code != http.StatusNotFound {
+		t.Fatalf("kick sin sesiones: %d", rr.Code)
+	}
+}
+
+func TestTokens_MintAndRevoke(t *testing.T) {
+	tokens := &auth.Tokens{Secret: "s3cr3t"}
+	mux := http.NewServeMux()
+	(&Server{Token: "secreto", Tokens: tokens}).Register(mux)
+	do := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secreto")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var minted tokenResp
+	rr := do("/admin/tokens", `{"user":"ana","ttl":60}`)
+	if err := json.NewDecoder(rr.Body).Decode(&minted); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("mint: %d %v", rr.Code, err)
+	}
+	if uid, ok := tokens.Verify(minted.Token); !ok || uid != "ana" {
+		t.Fatalf("el token emitido no vale: %q", minted.Token)
+	}
+	if rr := do("/admin/tokens/revoke", `{"token":"`+minted.Token+`"}`); rr.Code != http.StatusOK {
+		t.Fatalf("revoke: %d %s", rr.Code, rr.Body)
+	}
+	if _, ok := tokens.Verify(minted.Token); ok {
+		t.Fatal("el token revocado sigue valiendo")
+	}
+	if rr := do("/admin/tokens/revoke", `{"token":"basura"}`); rr.Code != http.StatusBadRequest {
+		t.Fatalf("revocar basura: %d", rr.Code)
+	}
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"clip-sync/server/internal/channel"
+)
+
+// Gestión de canales compartidos. Quien crea un canal es su owner; los
+// owners añaden miembros con un rol y cualquiera puede salirse. Los clips
+// se mandan al canal con clip.channel por cualquier transporte.
+
+type channelReq struct {
+	Name string `json:"name"`
+}
+
+type memberReq struct {
+	Role string `json:"role"`
+}
+
+type memberResp struct {
+	User string       `json:"user"`
+	Role channel.Role `json:"role"`
+}
+
+type channelResp struct {
+	Channel string       `json:"channel"`
+	Members []memberResp `json:"members"`
+}
+
+// ListChannels atiende GET /api/channels: los canales del usuario y su rol.
+func (s *Server) ListChannels(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	list := s.Channels.List(userID)
+	if list == nil {
+		list = []channel.Membership{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// CreateChannel atiende POST /api/channels {"name": "..."}.
+func (s *Server) CreateChannel(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	var req channelReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if err := s.Channels.Create(req.Name, userID); err != nil {
+		http.Error(w, err.Error(), channelStatus(err))
+		return
+	}
+	s.channelMembers(w, req.Name, userID, http.StatusCreated)
+}
+
+// GetChannel atiende GET /api/channels/{name}: sus miembros, solo para
+// miembros.
+func (s *Server) GetChannel(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	s.channelMembers(w, r.PathValue("name"), userID, http.StatusOK)
+}
+
+// DeleteChannel atiende DELETE /api/channels/{name}; solo owners.
+func (s *Server) DeleteChannel(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Channels.Delete(r.PathValue("name"), userID); err != nil {
+		http.Error(w, err.Error(), channelStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetMember atiende PUT /api/channels/{name}/members/{user} {"role": ...}
+// con role reader, writer u owner; solo owners.
+func (s *Server) SetMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	var req memberReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	role, ok := channel.ParseRole(req.Role)
+	if !ok {
+		http.Error(w, "role must be reader, writer or owner", http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	if err := s.Channels.SetMember(name, userID, r.PathValue("user"), role); err != nil {
+		http.Error(w, err.Error(), channelStatus(err))
+		return
+	}
+	s.channelMembers(w, name, userID, http.StatusOK)
+}
+
+// RemoveMember atiende DELETE /api/channels/{name}/members/{user}: un owner
+// saca a alguien o un miembro se sale.
+func (s *Server) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Channels.RemoveMember(r.PathValue("name"), userID, r.PathValue("user")); err != nil {
+		http.Error(w, err.Error(), channelStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// knownUser es authenticate sin usuarios anónimos: canales y bandejas
+// necesitan saber quién es quién.
+func (s *Server) knownUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID, ok := s.authenticate(w, r)
+	if ok && userID == "" {
+		http.Error(w, "user_id required", http.StatusUnauthorized)
+		return "", false
+	}
+	return userID, ok
+}
+
+func (s *Server) channelMembers(w http.ResponseWriter, name, userID string, status int) {
+	members, err := s.Channels.Members(name, userID)
+	if err != nil {
+		http.Error(w, err.Error(), channelStatus(err))
+		return
+	}
+	resp := channelResp{Channel: name, Members: make([]memberResp, 0, len(members))}
+	for u, role := range members {
+		resp.Members = append(resp.Members, memberResp{User: u, Role: role})
+	}
+	sort.Slice(resp.Members, func(i, j int) bool { return resp.Members[i].User < resp.Members[j].User })
+	writeJSON(w, status, resp)
+}
+
+func channelStatus(err error) int {
+	switch {
+	case errors.Is(err, channel.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, channel.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, channel.ErrExists), errors.Is(err, channel.ErrLastOwner):
+		return http.StatusConflict
+	case errors.Is(err, channel.ErrInvalidName):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,242 @@
+// Package api expone por HTTP lo que hoy exige un WebSocket, para scripts
+// y herramientas que no lo hablan. Todo pasa por el mismo pipeline de
+// ws.Server (validación, dedupe, rate limit, broadcast).
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"clip-sync/server/internal/channel"
+	"clip-sync/server/internal/httpapi"
+	"clip-sync/server/internal/policy"
+	"clip-sync/server/internal/ws"
+	"clip-sync/server/pkg/types"
+)
+
+// DefaultDevice es el device_id de los envíos que no indican uno.
+const DefaultDevice = "api"
+
+type Server struct {
+	// Auth valida el token (mismas credenciales que /ws). nil = anónimo.
+	Auth     func(token string) (string, bool)
+	WS       *ws.Server
+	Uploads  *httpapi.UploadServer
+	Channels *channel.Registry // nil = sin canales compartidos
+	Policy   *policy.Engine    // nil = sin política de contenido
+
+	pollMu sync.Mutex
+	polls  map[string]*pollSession // id -> sesión de long-poll
+}
+
+// Register monta las rutas de la API en mux.
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/clips", s.PostClip)
+	mux.HandleFunc("GET /api/events", s.Events)
+	mux.HandleFunc("POST /api/poll", s.Poll)
+	mux.HandleFunc("POST /api/poll/send", s.PollSend)
+	mux.HandleFunc("DELETE /api/poll/{session}", s.ClosePoll)
+	mux.HandleFunc("GET /api/inbox", s.Inbox)
+	mux.HandleFunc("POST /api/inbox/{id}/accept", s.AcceptOffer)
+	mux.HandleFunc("POST /api/inbox/{id}/reject", s.RejectOffer)
+	if s.Channels != nil {
+		mux.HandleFunc("GET /api/channels", s.ListChannels)
+		mux.HandleFunc("POST /api/channels", s.CreateChannel)
+		mux.HandleFunc("GET /api/channels/{name}", s.GetChannel)
+		mux.HandleFunc("DELETE /api/channels/{name}", s.DeleteChannel)
+		mux.HandleFunc("PUT /api/channels/{name}/members/{user}", s.SetMember)
+		mux.HandleFunc("DELETE /api/channels/{name}/members/{user}", s.RemoveMember)
+	}
+	if s.Policy != nil {
+		mux.HandleFunc("GET /api/policy", s.GetPolicy)
+		mux.HandleFunc("PUT /api/policy", s.SetPolicy)
+	}
+}
+
+// clipReq es el cuerpo JSON de POST /api/clips: texto, datos inline o una
+// referencia a un blob ya subido.
+type clipReq struct {
+	MsgID     string `json:"msg_id"`
+	DeviceID  string `json:"device_id"`
+	Text      string `json:"text"`
+	Data      []byte `json:"data"` // base64
+	Mime      string `json:"mime"`
+	UploadURL string `json:"upload_url"`
+	Size      int    `json:"size"`
+	SHA256    string `json:"sha256"`
+	Burn      bool   `json:"burn"`
+	Channel   string `json:"channel"`
+	To        string `json:"to"`
+}
+
+type clipResp struct {
+	MsgID     string `json:"msg_id"`
+	UploadURL string `json:"upload_url,omitempty"` // si el cuerpo se subió como blob
+}
+
+// authenticate devuelve el userID del request. Sin Auth, como en /ws, el
+// usuario es el que se declara (?user_id=).
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if s.Auth == nil {
+		return r.URL.Query().Get("user_id"), true
+	}
+	uid, ok := s.Auth(httpapi.TokenFromRequest(r))
+	if !ok || uid == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="clip-sync"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return uid, true
+}
+
+func (s *Server) inlineMax() int {
+	if s.WS.MaxInlineBytes > 0 {
+		return s.WS.MaxInlineBytes
+	}
+	return types.MaxInlineBytes
+}
+
+// PostClip atiende POST /api/clips. Con Content-Type application/json el
+// cuerpo es un clipReq; con cualquier otro el cuerpo es el contenido: va
+// inline si cabe y si no se sube como blob. Devuelve el msg_id asignado.
+func (s *Server) PostClip(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	device := firstNonEmpty(r.Header.Get("X-Device-Id"), q.Get("device"), DefaultDevice)
+	clip := &types.Clip{MsgID: firstNonEmpty(r.Header.Get("X-Msg-Id"), q.Get("msg_id")), Channel: q.Get("channel"), To: q.Get("to")}
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var uploaded string
+	if ct == "application/json" {
+		var req clipReq
+		body := http.MaxBytesReader(w, r.Body, int64(2*s.inlineMax()+64<<10)) // base64 + campos
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			} else {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+			}
+			return
+		}
+		device = firstNonEmpty(req.DeviceID, device)
+		clip.MsgID = firstNonEmpty(req.MsgID, clip.MsgID)
+		clip.Burn = req.Burn
+		clip.SHA256 = req.SHA256
+		clip.Channel = firstNonEmpty(req.Channel, clip.Channel)
+		clip.To = firstNonEmpty(req.To, clip.To)
+		switch {
+		case req.UploadURL != "":
+			clip.UploadURL, clip.Size, clip.Mime = req.UploadURL, req.Size, req.Mime
+		case req.Data != nil:
+			clip.Data, clip.Size, clip.Mime = req.Data, len(req.Data), req.Mime
+		default:
+			clip.Data, clip.Size = []byte(req.Text), len(req.Text)
+			clip.Mime = firstNonEmpty(req.Mime, "text/plain")
+		}
+	} else {
+		if ce := r.Header.Get("Content-Encoding"); ce != "" && !strings.EqualFold(ce, "identity") {
+			http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+		clip.Burn = httpapi.IsBurnRequest(r)
+		var ok bool
+		if uploaded, ok = s.rawClip(w, r, userID, ct, clip); !ok {
+			return
+		}
+	}
+	if clip.MsgID == "" {
+		clip.MsgID = newMsgID()
+	}
+
+	if err := s.WS.Submit(userID, device, clip); err != nil {
+		if uploaded != "" {
+			// el clip no salió: el blob no lo referenciará nadie
+			if id, ok := httpapi.BlobID(uploaded); ok {
+				s.Uploads.Delete(userID, id)
+			}
+		}
+		http.Error(w, err.Error(), submitStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clipResp{MsgID: clip.MsgID, UploadURL: uploaded})
+}
+
+// rawClip rellena clip con el cuerpo crudo de r: inline si cabe en
+// MaxInlineBytes y si no como blob nuevo, cuya URL devuelve.
+func (s *Server) rawClip(w http.ResponseWriter, r *http.Request, userID, ct string, clip *types.Clip) (string, bool) {
+	var body io.Reader = r.Body
+	if s.Uploads.MaxBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, s.Uploads.MaxBytes)
+	}
+	head := make([]byte, s.inlineMax()+1)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		httpapi.WriteUploadError(w, err)
+		return "", false
+	}
+	head = head[:n]
+	// curl -d manda x-www-form-urlencoded por defecto: es como no decir nada
+	if ct == "" || ct == "application/x-www-form-urlencoded" {
+		ct = "application/octet-stream"
+		if utf8.Valid(head) {
+			ct = "text/plain"
+		}
+	}
+	if n <= s.inlineMax() {
+		clip.Data, clip.Size, clip.Mime = head, n, ct
+		return "", true
+	}
+	blob, err := s.Uploads.Store(userID, ct, clip.Burn, io.MultiReader(bytes.NewReader(head), body))
+	if err != nil {
+		httpapi.WriteUploadError(w, err)
+		return "", false
+	}
+	clip.UploadURL, clip.Size, clip.Mime, clip.SHA256 = blob.URL, blob.Size, blob.Mime, blob.SHA256
+	return blob.URL, true
+}
+
+func submitStatus(err error) int {
+	switch {
+	case errors.Is(err, ws.ErrDuplicate):
+		return http.StatusConflict
+	case errors.Is(err, ws.ErrRateLimited), errors.Is(err, ws.ErrInboxFull), errors.Is(err, ws.ErrTooManyOffers):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ws.ErrUnknownRecipient):
+		return http.StatusNotFound
+	case errors.Is(err, ws.ErrRejected), errors.Is(err, ws.ErrBlocked):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ws.ErrForbidden):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func newMsgID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "api-" + hex.EncodeToString(b)
+}
+
+func firstNonEmpty(vs ...string) string {
+	for _, v := range vs {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
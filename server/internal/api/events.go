@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"clip-sync/server/internal/ws"
+)
+
+// sseKeepAlive: cada cuánto se manda un comentario para que proxies y
+// balanceadores no corten un stream sin tráfico.
+const sseKeepAlive = 25 * time.Second
+
+// Events atiende GET /api/events: un stream Server-Sent Events con los
+// mismos envelopes que recibe un dispositivo por /ws. El suscriptor cuenta
+// como dispositivo conectado (?device=). Cada clip lleva como id su número
+// de secuencia, así que un EventSource que reconecta con Last-Event-ID
+// recibe lo que se perdió mientras siga en el historial.
+func (s *Server) Events(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	after, _ := strconv.ParseInt(firstNonEmpty(r.Header.Get("Last-Event-ID"), r.URL.Query().Get("last_event_id")), 10, 64)
+	sub, err := s.WS.Subscribe(userID, r.URL.Query().Get("device"), after, "sse", r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer sub.Close()
+	sub.JoinChannels(r.URL.Query()["channel"])
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: no acumular el stream
+	w.WriteHeader(http.StatusOK)
+	fl.Flush()
+
+	for {
+		ctx, cancel := context.WithTimeout(r.Context(), sseKeepAlive)
+		ev, err := sub.Next(ctx)
+		cancel()
+		switch {
+		case err == nil:
+			if err := writeEvent(w, ev); err != nil {
+				return
+			}
+		case errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case errors.Is(err, ws.ErrClosed):
+			// el cliente no debe reconectar sin más si lo echaron
+			fmt.Fprintf(w, "event: close\ndata: %s\n\n", jsonString(sub.Reason()))
+			fl.Flush()
+			return
+		default:
+			return // el cliente se fue
+		}
+		fl.Flush()
+	}
+}
+
+// writeEvent escribe ev como evento SSE: event = tipo del envelope, data =
+// envelope en JSON (una sola línea), id = secuencia si la hay.
+func writeEvent(w http.ResponseWriter, ev ws.Event) error {
+	b, err := json.Marshal(ev.Env)
+	if err != nil {
+		return nil // no debería pasar; se salta el evento
+	}
+	if ev.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", ev.Seq); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Env.Type, b)
+	return err
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"clip-sync/server/internal/ws"
+)
+
+// Bandeja de entrada por HTTP: lo mismo que los envelopes "accept" y
+// "reject" de /ws, para clientes sin WebSocket.
+
+// Inbox atiende GET /api/inbox: las ofertas pendientes del usuario.
+func (s *Server) Inbox(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.WS.Offers(userID))
+}
+
+// AcceptOffer atiende POST /api/inbox/{id}/accept y devuelve el envelope
+// "clip", con URLs firmadas para ?device= (por defecto "api").
+func (s *Server) AcceptOffer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	device := firstNonEmpty(r.URL.Query().Get("device"), DefaultDevice)
+	env, err := s.WS.Accept(userID, device, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), offerStatus(err))
+		return
+	}
+	writeJSON(w, http.StatusOK, env)
+}
+
+// RejectOffer atiende POST /api/inbox/{id}/reject.
+func (s *Server) RejectOffer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	device := firstNonEmpty(r.URL.Query().Get("device"), DefaultDevice)
+	if err := s.WS.Reject(userID, device, r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), offerStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func offerStatus(err error) int {
+	if errors.Is(err, ws.ErrNoOffer) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"clip-sync/server/internal/policy"
+)
+
+// Política de contenido: cada usuario decide si sus clips de texto pasan
+// por los detectores de secretos antes de difundirse.
+
+type policyRule struct {
+	Name   string        `json:"name"`
+	Action policy.Action `json:"action"`
+}
+
+type policyResp struct {
+	Enabled bool         `json:"enabled"`
+	Forced  bool         `json:"forced"` // el operador la impuso a todos
+	Rules   []policyRule `json:"rules"`
+}
+
+type policyReq struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// GetPolicy atiende GET /api/policy: si está activada para el usuario y
+// qué reglas aplica.
+func (s *Server) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	s.writePolicy(w, userID)
+}
+
+// SetPolicy atiende PUT /api/policy {"enabled": true|false}.
+func (s *Server) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.knownUser(w, r)
+	if !ok {
+		return
+	}
+	var req policyReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, `body must be {"enabled": true|false}`, http.StatusBadRequest)
+		return
+	}
+	if err := s.Policy.SetEnabled(userID, *req.Enabled); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, policy.ErrForced) {
+			code = http.StatusForbidden
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	s.writePolicy(w, userID)
+}
+
+func (s *Server) writePolicy(w http.ResponseWriter, userID string) {
+	resp := policyResp{Enabled: s.Policy.Enabled(userID), Forced: s.Policy.Forced, Rules: make([]policyRule, 0, len(s.Policy.Rules))}
+	for _, r := range s.Policy.Rules {
+		resp.Rules = append(resp.Rules, policyRule{Name: r.Name, Action: r.Action})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
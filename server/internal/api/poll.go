@@ -0,0 +1,293 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"clip-sync/server/internal/ws"
+	"clip-sync/server/pkg/types"
+)
+
+// Long-poll: para redes donde un proxy corta el upgrade a WebSocket. Una
+// sesión es un dispositivo suscrito (ws.Subscribe) que sigue conectado
+// entre polls. Cada envelope encolado recibe un cursor creciente; el
+// cliente manda en cada poll el último que recibió y el server descarta lo
+// confirmado, así que una respuesta perdida se vuelve a entregar.
+
+const (
+	defaultPollWait = 25 * time.Second
+	maxPollWait     = 55 * time.Second
+	pollSessionTTL  = time.Minute // sin polls durante este tiempo se da de baja
+)
+
+type pollSession struct {
+	id       string
+	userID   string
+	deviceID string
+	sub      *ws.Subscription
+
+	mu     sync.Mutex // un poll a la vez por sesión
+	queue  []pollItem // entregado pero sin confirmar
+	cursor int64      // último cursor asignado
+
+	// bajo Server.pollMu
+	seen   time.Time
+	active int // polls en curso
+}
+
+type pollItem struct {
+	cursor int64
+	env    types.Envelope
+}
+
+type pollReq struct {
+	Session  string `json:"session"`
+	DeviceID string `json:"device_id"`
+	Cursor   int64  `json:"cursor"`
+	Wait     *int   `json:"wait"` // segundos; nil = 25
+
+	Channels []string `json:"channels"` // al abrir la sesión: canales a recibir
+}
+
+type pollResp struct {
+	Session   string           `json:"session"`
+	Cursor    int64            `json:"cursor"`
+	Envelopes []types.Envelope `json:"envelopes"`
+}
+
+type sendReq struct {
+	Session  string         `json:"session"`
+	Envelope types.Envelope `json:"envelope"`
+}
+
+// Poll atiende POST /api/poll: confirma hasta req.Cursor y devuelve lo
+// encolado, esperando hasta Wait segundos si no hay nada.
+func (s *Server) Poll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var req pollReq
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	wait := defaultPollWait
+	if req.Wait != nil {
+		wait = min(max(time.Duration(*req.Wait)*time.Second, 0), maxPollWait)
+	}
+
+	ps, err := s.pollSession(userID, req, r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if ps.id != req.Session {
+		req.Cursor = 0 // sesión nueva: el cursor del cliente era de otra
+	}
+	defer s.releasePoll(ps)
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.ack(req.Cursor)
+	ps.drain()
+	if len(ps.queue) == 0 && wait > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		ev, err := ps.sub.Next(ctx)
+		cancel()
+		switch {
+		case err == nil:
+			ps.push(ev)
+			ps.drain()
+		case errors.Is(err, ws.ErrClosed):
+			s.dropPoll(ps)
+			http.Error(w, "session closed: "+ps.sub.Reason(), http.StatusGone)
+			return
+		}
+	}
+
+	resp := pollResp{Session: ps.id, Cursor: ps.cursor, Envelopes: make([]types.Envelope, 0, len(ps.queue))}
+	for _, it := range ps.queue {
+		resp.Envelopes = append(resp.Envelopes, it.env)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// PollSend atiende POST /api/poll/send: un envelope "clip" o "recall" de
+// parte del dispositivo de la sesión.
+func (s *Server) PollSend(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var req sendReq
+	body := http.MaxBytesReader(w, r.Body, int64(2*s.inlineMax()+64<<10))
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	ps := s.lookupPoll(userID, req.Session)
+	if ps == nil {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+	if r.ContentLength > 0 {
+		ps.sub.Received(r.ContentLength)
+	}
+	env := req.Envelope
+	var msgID string
+	var err error
+	switch {
+	case env.Type == "clip" && env.Clip != nil:
+		if env.Clip.MsgID == "" {
+			env.Clip.MsgID = newMsgID()
+		}
+		msgID = env.Clip.MsgID
+		err = s.WS.Submit(userID, ps.deviceID, env.Clip)
+	case env.Type == "recall" && env.Recall != nil:
+		msgID = env.Recall.MsgID
+		err = s.WS.Recall(userID, ps.deviceID, env.Recall.Channel, msgID)
+	default:
+		http.Error(w, "unsupported envelope type", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), submitStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clipResp{MsgID: msgID})
+}
+
+// ClosePoll atiende DELETE /api/poll/{session}: da de baja el dispositivo
+// sin esperar a que caduque.
+func (s *Server) ClosePoll(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	ps := s.lookupPoll(userID, r.PathValue("session"))
+	if ps == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.dropPoll(ps)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pollSession devuelve la sesión de req o crea una nueva si no existe (o
+// caducó), y la marca como en uso para que el janitor no la cierre.
+func (s *Server) pollSession(userID string, req pollReq, remoteAddr string) (*pollSession, error) {
+	s.pollMu.Lock()
+	if ps := s.polls[req.Session]; ps != nil && ps.userID == userID {
+		ps.active++
+		s.pollMu.Unlock()
+		return ps, nil
+	}
+	s.pollMu.Unlock()
+
+	device := firstNonEmpty(req.DeviceID, DefaultDevice)
+	sub, err := s.WS.Subscribe(userID, device, 0, "poll", remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	sub.JoinChannels(req.Channels)
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	ps := &pollSession{id: hex.EncodeToString(b), userID: userID, deviceID: device, sub: sub, active: 1}
+	s.pollMu.Lock()
+	if s.polls == nil {
+		s.polls = make(map[string]*pollSession)
+	}
+	s.polls[ps.id] = ps
+	s.pollMu.Unlock()
+	return ps, nil
+}
+
+func (s *Server) lookupPoll(userID, id string) *pollSession {
+	s.pollMu.Lock()
+	defer s.pollMu.Unlock()
+	ps := s.polls[id]
+	if ps == nil || ps.userID != userID {
+		return nil
+	}
+	ps.seen = time.Now()
+	return ps
+}
+
+func (s *Server) releasePoll(ps *pollSession) {
+	s.pollMu.Lock()
+	ps.active--
+	ps.seen = time.Now()
+	s.pollMu.Unlock()
+}
+
+func (s *Server) dropPoll(ps *pollSession) {
+	s.pollMu.Lock()
+	delete(s.polls, ps.id)
+	s.pollMu.Unlock()
+	ps.sub.Close()
+}
+
+// SweepPolls da de baja las sesiones sin polls desde hace pollSessionTTL.
+func (s *Server) SweepPolls(now time.Time) {
+	s.pollMu.Lock()
+	var stale []*pollSession
+	for id, ps := range s.polls {
+		if ps.active == 0 && now.Sub(ps.seen) > pollSessionTTL {
+			delete(s.polls, id)
+			stale = append(stale, ps)
+		}
+	}
+	s.pollMu.Unlock()
+	for _, ps := range stale {
+		ps.sub.Close()
+	}
+}
+
+// RunJanitor ejecuta SweepPolls periódicamente hasta que ctx termine.
+func (s *Server) RunJanitor(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.SweepPolls(now)
+		}
+	}
+}
+
+// ack descarta lo confirmado por el cliente (bajo ps.mu).
+func (ps *pollSession) ack(cursor int64) {
+	i := 0
+	for i < len(ps.queue) && ps.queue[i].cursor <= cursor {
+		i++
+	}
+	ps.queue = ps.queue[i:]
+}
+
+func (ps *pollSession) push(ev ws.Event) {
+	ps.cursor++
+	ps.queue = append(ps.queue, pollItem{cursor: ps.cursor, env: ev.Env})
+}
+
+// drain pasa a la cola lo que ya esté esperando en la suscripción.
+func (ps *pollSession) drain() {
+	for {
+		ev, ok := ps.sub.TryNext()
+		if !ok {
+			return
+		}
+		ps.push(ev)
+	}
+}
@@ -1,11 +1,12 @@
 package app
 
 import (
-    "crypto/hmac"
-    "crypto/sha256"
-    "encoding/hex"
+    "context"
+    "crypto/rand"
     "encoding/json"
+    "errors"
     "expvar"
+    "fmt"
     "net/http"
     "net/http/pprof"
     "os"
@@ -13,18 +14,34 @@ import (
     "strings"
     "time"
 
+    "clip-sync/server/internal/admin"
+    "clip-sync/server/internal/api"
+    "clip-sync/server/internal/auth"
+    "clip-sync/server/internal/channel"
     "clip-sync/server/internal/httpapi"
     "clip-sync/server/internal/hub"
     "clip-sync/server/internal/logx"
+    "clip-sync/server/internal/policy"
+    "clip-sync/server/internal/scan"
+    "clip-sync/server/internal/sniff"
+    "clip-sync/server/internal/web"
+    "clip-sync/server/internal/webhook"
     "clip-sync/server/internal/ws"
+    "clip-sync/server/pkg/types"
 )
 
 type App struct {
-	Mux *http.ServeMux
-	WSS *ws.Server
+	Mux     *http.ServeMux
+	WSS     *ws.Server
+	Uploads *httpapi.UploadServer
+
+	stop context.CancelFunc
 }
 
-func NewApp() *App {
+// NewApp arma el servidor a partir del entorno. Devuelve error si la
+// configuración no permite arrancar con seguridad (keyfile, antivirus,
+// política, canales, revocaciones o webhooks inválidos).
+func NewApp() (*App, error) {
     mux := http.NewServeMux()
     mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusOK)
@@ -36,37 +53,258 @@ func NewApp() *App {
     if lvl := os.Getenv("CLIPSYNC_LOG_LEVEL"); lvl != "" {
         logx.SetLevel(lvl)
     }
+    // tokens de usuario: HMAC con CLIPSYNC_HMAC_SECRET (o token == userID)
+    // y revocaciones, persistidas con CLIPSYNC_REVOKED_FILE
+    tokens := &auth.Tokens{Secret: os.Getenv("CLIPSYNC_HMAC_SECRET")}
+    if path := envStr("CLIPSYNC_REVOKED_FILE", ""); path != "" {
+        t, err := auth.Load(tokens.Secret, path)
+        if err != nil {
+            // arrancar sin la lista volvería a aceptar tokens revocados
+            return nil, fmt.Errorf("CLIPSYNC_REVOKED_FILE: %w", err)
+        }
+        tokens = t
+    }
+    authToken := tokens.Verify
     wss := &ws.Server{
         Hub: h,
-        Auth: func(token string) (string, bool) {
-            secret := os.Getenv("CLIPSYNC_HMAC_SECRET")
-            if secret == "" {
-                if token == "" {
-                    return "", false
-                }
-                // modo MVP: token == userID
-                return token, true
-            }
-            return verifyHMACToken(token, secret)
-        },
+        Auth:               authToken,
         MaxInlineBytes:     envInt("CLIPSYNC_INLINE_MAXBYTES", 64<<10),
         RateLimitPerSecond: envInt("CLIPSYNC_RATE_LPS", 0),
+        SniffPolicy:        sniff.ParsePolicy(envStr("CLIPSYNC_SNIFF", "off")),
+        HistorySize:        envInt("CLIPSYNC_HISTORY", 50),
+        OfferTTL:           time.Duration(envInt("CLIPSYNC_OFFER_TTL", 86400)) * time.Second,
+        InboxSize:          envInt("CLIPSYNC_INBOX_SIZE", 100),
+        OffersPerSender:    envInt("CLIPSYNC_OFFERS_PER_SENDER", 100),
+        MaxInboxes:         envInt("CLIPSYNC_MAX_INBOXES", 10000),
         Log: func(event string, fields map[string]any) {
             logx.Info(event, fields)
         },
+    }
+    // canales compartidos: en memoria, o persistidos con CLIPSYNC_CHANNELS_FILE
+    channels := &channel.Registry{}
+    if path := envStr("CLIPSYNC_CHANNELS_FILE", ""); path != "" {
+        reg, err := channel.Load(path)
+        if err != nil {
+            // arrancar sin los canales dejaría fuera a sus miembros
+            return nil, fmt.Errorf("CLIPSYNC_CHANNELS_FILE: %w", err)
+        }
+        channels = reg
+    }
+    wss.Channels = channels
+    // política de contenido (opt-in por usuario o impuesta): secretos en clips de texto
+    var pol *policy.Engine
+    if spec := envStr("CLIPSYNC_POLICY", ""); spec != "" {
+        rules := policy.Builtin()
+        if spec != "builtin" {
+            rs, err := policy.Load(spec)
+            if err != nil {
+                // igual que el antivirus: mejor no arrancar que difundir sin revisar
+                return nil, fmt.Errorf("CLIPSYNC_POLICY: %w", err)
+            }
+            rules = rs
+        }
+        pol = &policy.Engine{
+            Rules:  rules,
+            Forced: envInt("CLIPSYNC_POLICY_ALL", 0) != 0,
+            Path:   envStr("CLIPSYNC_POLICY_USERS_FILE", ""),
+            Log: func(event string, fields map[string]any) {
+                logx.Info(event, fields)
+            },
+        }
+        if err := pol.LoadUsers(); err != nil {
+            return nil, fmt.Errorf("CLIPSYNC_POLICY_USERS_FILE: %w", err)
+        }
     }
 	// dedupe: capacidad LRU por usuario desde env (0 = off)
 	wss.SetDedupeCapacity(envInt("CLIPSYNC_DEDUPE", 128))
 
 	mux.Handle("/ws", wss)
 
+    signer := &httpapi.URLSigner{
+        Secret:    urlSecret(),
+        TTL:       time.Duration(envInt("CLIPSYNC_URL_TTL", 600)) * time.Second,
+        SingleUse: envInt("CLIPSYNC_URL_SINGLE_USE", 0) != 0,
+    }
     up := &httpapi.UploadServer{
         Dir:      envStr("CLIPSYNC_UPLOAD_DIR", "./uploads"),
         MaxBytes: int64(envInt("CLIPSYNC_UPLOAD_MAXBYTES", 50<<20)),
         Allowed:  splitCSV(envStr("CLIPSYNC_UPLOAD_ALLOWED", "")),
+        Auth:     authToken,
+        Signer:   signer,
+        BurnTTL:  time.Duration(envInt("CLIPSYNC_BURN_TTL", 600)) * time.Second,
+        Compress: envInt("CLIPSYNC_UPLOAD_COMPRESS", 0) != 0,
+        Sniff:    wss.SniffPolicy,
+
+        RelayWait:     time.Duration(envInt("CLIPSYNC_RELAY_WAIT", 5)) * time.Second,
+        RelayMaxBytes: int64(envInt("CLIPSYNC_RELAY_MAXBYTES", 0)),
+        OrphanGrace:   time.Duration(envInt("CLIPSYNC_ORPHAN_GRACE", 3600)) * time.Second,
+    }
+    if kf := envStr("CLIPSYNC_UPLOAD_KEYFILE", ""); kf != "" {
+        kr, err := httpapi.LoadKeyring(kf)
+        if err != nil {
+            // sin cifrado no se arranca: guardar en claro en silencio sería peor
+            return nil, fmt.Errorf("CLIPSYNC_UPLOAD_KEYFILE: %w", err)
+        }
+        up.Keys = kr
+    }
+    if spec := envStr("CLIPSYNC_SCAN", ""); spec != "" {
+        sc, err := scan.Parse(spec)
+        if err != nil {
+            // igual que el keyfile: mejor no arrancar que publicar sin analizar
+            return nil, fmt.Errorf("CLIPSYNC_SCAN: %w", err)
+        }
+        up.Scanner = sc
+        up.ScanAction = scan.ParseAction(envStr("CLIPSYNC_SCAN_ACTION", "reject"))
+        up.ScanTimeout = time.Duration(envInt("CLIPSYNC_SCAN_TIMEOUT", 60)) * time.Second
+    }
+    // con antivirus solo se difunden clips cuyo blob pasó el análisis; las
+    // URLs ajenas al servidor no son cosa nuestra
+    wss.AcceptClip = func(userID string, clip *types.Clip) bool {
+        id, ok := httpapi.BlobID(clip.UploadURL)
+        return !ok || up.Scanned(id)
+    }
+    // solo se firman URLs de blobs del propio emisor: una firma salta el
+    // control de dueño de /d/{id}
+    wss.PrepareClip = func(userID, deviceID string, clip *types.Clip) {
+        id, ok := httpapi.BlobID(clip.UploadURL)
+        if !ok || !up.Owns(userID, id) {
+            return
+        }
+        // el digest que vale es el calculado al guardar, no el que diga el emisor
+        if sum := up.Digest(id); sum != "" {
+            clip.SHA256 = sum
+        }
+        // un relay no tiene blob del que sacar miniatura
+        if !clip.Burn && httpapi.IsThumbMime(clip.Mime) && !up.Relaying(id) {
+            clip.ThumbURL, _ = signer.SignURL("/d/"+id+"/thumb", deviceID)
+        }
+        clip.UploadURL, clip.ExpiresAt = signer.SignURL(clip.UploadURL, deviceID)
+    }
+    wss.OnDeliver = func(userID string, clip *types.Clip, devices []string) {
+        id, ok := httpapi.BlobID(clip.UploadURL)
+        if !ok {
+            return
+        }
+        up.MarkReferenced(userID, id)
+        if clip.Burn {
+            up.ExpectRecipients(userID, id, devices)
+        }
+        up.ExpectRelay(userID, id, devices)
+    }
+    // la política revisa también los blobs de texto propios hasta 1 MiB; si
+    // hay que redactar se reescribe el blob con la misma URL
+    if pol != nil {
+        const policyBlobMax = 1 << 20
+        wss.ContentPolicy = func(userID string, clip *types.Clip) bool {
+            if !pol.Apply(userID, clip) {
+                return false
+            }
+            id, ok := httpapi.BlobID(clip.UploadURL)
+            if !ok || !strings.HasPrefix(clip.Mime, "text/") || !pol.Enabled(userID) || !up.Owns(userID, id) {
+                return true
+            }
+            text, ok := up.ReadText(id, policyBlobMax)
+            if !ok {
+                return true
+            }
+            out, ok := pol.Text(userID, clip.MsgID, text)
+            if !ok {
+                return false
+            }
+            if out != text {
+                b, err := up.ReplaceText(id, out)
+                if err != nil {
+                    // mejor no difundirlo que difundirlo sin redactar
+                    logx.Error("policy_rewrite", map[string]any{"msg_id": clip.MsgID, "err": err.Error()})
+                    return false
+                }
+                clip.Size = b.Size
+                if clip.SHA256 != "" {
+                    clip.SHA256 = b.SHA256
+                }
+            }
+            return true
+        }
+    }
+    // recall: el blob del clip retirado se borra si es del que lo retira
+    wss.OnRecall = func(userID string, clip *types.Clip) {
+        if id, ok := httpapi.BlobID(clip.UploadURL); ok {
+            up.Delete(userID, id)
+        }
+    }
+    // webhooks (opt-in): clips difundidos, dispositivos y uploads
+    hooks := &webhook.Dispatcher{
+        URLs:      splitCSV(envStr("CLIPSYNC_WEBHOOK_URLS", "")),
+        Secret:    envStr("CLIPSYNC_WEBHOOK_SECRET", ""),
+        Events:    splitCSV(envStr("CLIPSYNC_WEBHOOK_EVENTS", "")),
+        QueueSize: envInt("CLIPSYNC_WEBHOOK_QUEUE", 1000),
+        Log: func(event string, fields map[string]any) {
+            logx.Error(event, fields)
+        },
+    }
+    if len(hooks.URLs) > 0 {
+        if hooks.Secret == "" {
+            // sin firma cualquiera podría hacerse pasar por el servidor ante los receptores
+            return nil, errors.New("CLIPSYNC_WEBHOOK_URLS requires CLIPSYNC_WEBHOOK_SECRET")
+        }
+        for _, ev := range hooks.Events {
+            if !webhook.Known(ev) {
+                return nil, fmt.Errorf("CLIPSYNC_WEBHOOK_EVENTS: unknown event %q", ev)
+            }
+        }
+    }
+    // el uso por usuario se mantiene en memoria: se parte de lo que hay en disco
+    if err := up.RebuildUsage(); err != nil {
+        logx.Error("usage_rebuild", map[string]any{"err": err.Error()})
+    }
+    janitorCtx, stopJanitor := context.WithCancel(context.Background())
+    go up.RunJanitor(janitorCtx, time.Minute)
+
+    if len(hooks.URLs) > 0 {
+        wss.OnClip = func(userID, deviceID string, clip *types.Clip) {
+            cl := *clip
+            if cl.Burn {
+                // burn-after-read: el contenido no sale del servidor
+                cl.Data = nil
+            }
+            hooks.Send(webhook.Event{Type: webhook.EventClip, User: userID, Device: deviceID, Data: cl})
+        }
+        wss.OnConnect = func(userID, deviceID, transport string) {
+            hooks.Send(webhook.Event{Type: webhook.EventDeviceJoin, User: userID, Device: deviceID,
+                Data: map[string]string{"transport": transport}})
+        }
+        wss.OnDisconnect = func(userID, deviceID string) {
+            hooks.Send(webhook.Event{Type: webhook.EventDeviceLeave, User: userID, Device: deviceID})
+        }
+        up.OnStored = func(owner string, b httpapi.Blob, burn bool) {
+            hooks.Send(webhook.Event{Type: webhook.EventUpload, User: owner, Data: map[string]any{
+                "upload_url": b.URL, "size": b.Size, "mime": b.Mime, "sha256": b.SHA256, "burn": burn,
+            }})
+        }
+        go hooks.Run(janitorCtx)
     }
+
     mux.HandleFunc("POST /upload", up.Upload)
     mux.HandleFunc("GET /d/{id}", up.Download)
+    mux.HandleFunc("DELETE /d/{id}", up.DeleteBlob)
+    mux.HandleFunc("GET /d/{id}/thumb", up.Thumbnail)
+    mux.HandleFunc("POST /relay", up.ReserveRelay)
+    mux.HandleFunc("PUT /relay/{id}", up.Relay)
+
+    // API HTTP para quien no habla WebSocket
+    apis := &api.Server{Auth: authToken, WS: wss, Uploads: up, Channels: channels, Policy: pol}
+    apis.Register(mux)
+    go apis.RunJanitor(janitorCtx, 10*time.Second)
+    go wss.RunJanitor(janitorCtx, time.Minute)
+
+    // panel web (opt-in): historial, dispositivos y envío desde el navegador
+    if envInt("CLIPSYNC_WEB", 0) != 0 {
+        (&web.Server{Auth: authToken, WS: wss, Uploads: up}).Register(mux)
+    }
+
+    // API de administración: solo con CLIPSYNC_ADMIN_TOKEN
+    adm := &admin.Server{Token: envStr("CLIPSYNC_ADMIN_TOKEN", ""), Uploads: up, WS: wss, Tokens: tokens}
+    adm.Register(mux)
 
     // debug endpoints (opt-in)
     if envInt("CLIPSYNC_PPROF", 0) != 0 {
@@ -82,14 +320,37 @@ func NewApp() *App {
 
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(wss.MetricsSnapshot())
+		m := wss.MetricsSnapshot()
+		for k, v := range up.MetricsSnapshot() {
+			m[k] = v
+		}
+		if len(hooks.URLs) > 0 {
+			for k, v := range hooks.MetricsSnapshot() {
+				m[k] = v
+			}
+		}
+		_ = json.NewEncoder(w).Encode(m)
 	})
 
-	return &App{Mux: mux, WSS: wss}
+	return &App{Mux: mux, WSS: wss, Uploads: up, stop: stopJanitor}, nil
+}
+
+// Shutdown cierra las sesiones WS y detiene las tareas de fondo.
+func (a *App) Shutdown(ctx context.Context) {
+	a.WSS.Shutdown(ctx)
+	if a.stop != nil {
+		a.stop()
+	}
 }
 
 // Back-compat
-func NewMux() http.Handler { return NewApp().Mux }
+func NewMux() (http.Handler, error) {
+    a, err := NewApp()
+    if err != nil {
+        return nil, err
+    }
+    return a.Mux, nil
+}
 
 func envInt(name string, def int) int {
     v := os.Getenv(name)
@@ -126,30 +387,14 @@ func splitCSV(s string) []string {
     return out
 }
 
-// verifyHMACToken valida tokens con formato: userID:exp_unix:hex(hmac_sha256(secret, userID|exp_unix))
-func verifyHMACToken(token, secret string) (string, bool) {
-    parts := strings.Split(token, ":")
-    if len(parts) != 3 {
-        return "", false
-    }
-    uid, expStr, macHex := parts[0], parts[1], parts[2]
-    if uid == "" || expStr == "" || macHex == "" {
-        return "", false
-    }
-    exp, err := strconv.ParseInt(expStr, 10, 64)
-    if err != nil {
-        return "", false
-    }
-    if time.Now().Unix() > exp {
-        return "", false
-    }
-    payload := uid + "|" + expStr
-    mac := hmac.New(sha256.New, []byte(secret))
-    mac.Write([]byte(payload))
-    sum := mac.Sum(nil)
-    want := hex.EncodeToString(sum)
-    if !hmac.Equal([]byte(macHex), []byte(want)) {
-        return "", false
+// urlSecret reutiliza el secreto HMAC de tokens (o uno dedicado) para firmar
+// URLs de descarga. En modo MVP se genera uno aleatorio por proceso: los
+// enlaces dejan de valer al reiniciar, que es lo esperado.
+func urlSecret() []byte {
+    if v := envStr("CLIPSYNC_URL_SECRET", os.Getenv("CLIPSYNC_HMAC_SECRET")); v != "" {
+        return []byte(v)
     }
-    return uid, true
+    b := make([]byte, 32)
+    _, _ = rand.Read(b)
+    return b
 }
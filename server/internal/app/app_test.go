@@ -1,14 +1,26 @@
 package app
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
+func newTestMux(t *testing.T) http.Handler {
+	t.Helper()
+	mux, err := NewMux()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mux
+}
+
 func TestHealthOK(t *testing.T) {
-	srv := httptest.NewServer(NewMux())
+	srv := httptest.NewServer(newTestMux(t))
 	defer srv.Close()
 
 	resp, err := http.Get(srv.URL + "/health")
@@ -25,3 +37,33 @@ func TestHealthOK(t *testing.T) {
 		t.Fatalf("want ok, got %q", b)
 	}
 }
+
+// Una configuración que no permite arrancar con seguridad es un error, no
+// un panic.
+func TestNewApp_BadConfigIsError(t *testing.T) {
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(bad, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]map[string]string{
+		"keyfile":  {"CLIPSYNC_UPLOAD_KEYFILE": filepath.Join(t.TempDir(), "missing")},
+		"scan":     {"CLIPSYNC_SCAN": "bogus:x"},
+		"policy":   {"CLIPSYNC_POLICY": bad},
+		"channels": {"CLIPSYNC_CHANNELS_FILE": bad},
+		"revoked":  {"CLIPSYNC_REVOKED_FILE": bad},
+		"webhook":  {"CLIPSYNC_WEBHOOK_URLS": "http://127.0.0.1:1/hook"},
+		"events":   {"CLIPSYNC_WEBHOOK_URLS": "http://127.0.0.1:1/hook", "CLIPSYNC_WEBHOOK_SECRET": "s", "CLIPSYNC_WEBHOOK_EVENTS": "nope"},
+	}
+	for name, env := range cases {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+			for k, v := range env {
+				t.Setenv(k, v)
+			}
+			if a, err := NewApp(); err == nil {
+				a.Shutdown(context.Background())
+				t.Fatal("NewApp aceptó una configuración inválida")
+			}
+		})
+	}
+}
@@ -18,7 +18,7 @@ import (
 func TestHealthzMetrics(t *testing.T) {
 	t.Setenv("CLIPSYNC_RATE_LPS", "1")
 
-	srv := httptest.NewServer(NewMux())
+	srv := httptest.NewServer(newTestMux(t))
 	defer srv.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
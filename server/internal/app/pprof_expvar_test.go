@@ -7,7 +7,7 @@ import (
 )
 
 func TestDebugEndpoints_DisabledByDefault(t *testing.T) {
-    srv := httptest.NewServer(NewMux())
+    srv := httptest.NewServer(newTestMux(t))
     defer srv.Close()
 
     for _, path := range []string{"/debug/pprof/", "/debug/vars"} {
@@ -26,7 +26,7 @@ func TestDebugEndpoints_Enabled(t *testing.T) {
     t.Setenv("CLIPSYNC_PPROF", "1")
     t.Setenv("CLIPSYNC_EXPVAR", "1")
 
-    srv := httptest.NewServer(NewMux())
+    srv := httptest.NewServer(newTestMux(t))
     defer srv.Close()
 
     // pprof index
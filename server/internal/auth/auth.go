@@ -0,0 +1,191 @@
+// Package auth emite y valida los tokens de usuario y guarda los revocados.
+//
+// Con secreto, un token es userID:exp_unix:hex(hmac_sha256(secret,
+// userID|exp_unix)). Sin secreto (modo MVP) el token es el propio userID.
+// Un token revocado deja de valer aunque su firma sea buena; la revocación
+// se olvida cuando el token caduca.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"clip-sync/server/internal/fsutil"
+)
+
+var (
+	ErrNoSecret     = errors.New("token minting needs CLIPSYNC_HMAC_SECRET")
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrInvalidUser  = errors.New("invalid user id")
+)
+
+// Revocation es un token revocado. Hash es el sha256 del token: el token
+// en sí no se guarda.
+type Revocation struct {
+	Hash      string    `json:"hash"`
+	User      string    `json:"user"`
+	Expires   int64     `json:"expires,omitempty"` // unix; 0 = no caduca (modo MVP)
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// Tokens valida tokens con Secret y consulta los revocados. El zero value
+// sirve en modo MVP y en memoria.
+type Tokens struct {
+	Secret string
+	Path   string // fichero JSON de revocaciones; "" = solo en memoria
+
+	mu      sync.Mutex
+	revoked map[string]Revocation // hash -> revocación
+}
+
+// Load abre las revocaciones guardadas en path; si no existe empieza vacío.
+func Load(secret, path string) (*Tokens, error) {
+	t := &Tokens{Secret: secret, Path: path}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Revocation
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	t.revoked = make(map[string]Revocation, len(list))
+	for _, r := range list {
+		t.revoked[r.Hash] = r
+	}
+	return t, nil
+}
+
+// Verify devuelve el userID del token si es válido y no está revocado.
+func (t *Tokens) Verify(token string) (string, bool) {
+	uid, _, ok := t.parse(token, time.Now())
+	if !ok {
+		return "", false
+	}
+	t.mu.Lock()
+	_, revoked := t.revoked[hashToken(token)]
+	t.mu.Unlock()
+	return uid, !revoked
+}
+
+// Mint emite un token para userID que caduca dentro de ttl.
+func (t *Tokens) Mint(userID string, ttl time.Duration) (string, time.Time, error) {
+	if t.Secret == "" {
+		return "", time.Time{}, ErrNoSecret
+	}
+	if userID == "" || strings.Contains(userID, ":") {
+		return "", time.Time{}, ErrInvalidUser
+	}
+	exp := time.Now().Add(ttl).Truncate(time.Second)
+	expStr := strconv.FormatInt(exp.Unix(), 10)
+	return userID + ":" + expStr + ":" + t.sign(userID, expStr), exp, nil
+}
+
+// Revoke invalida token hasta que caduque. Revocar uno ya revocado no es
+// un error.
+func (t *Tokens) Revoke(token string) (Revocation, error) {
+	now := time.Now()
+	uid, exp, ok := t.parse(token, now)
+	if !ok {
+		return Revocation{}, ErrInvalidToken
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := hashToken(token)
+	if r, ok := t.revoked[h]; ok {
+		return r, nil
+	}
+	r := Revocation{Hash: h, User: uid, Expires: exp, RevokedAt: now.UTC()}
+	if t.revoked == nil {
+		t.revoked = make(map[string]Revocation)
+	}
+	t.revoked[h] = r
+	t.pruneLocked(now)
+	if err := t.saveLocked(); err != nil {
+		delete(t.revoked, h)
+		return Revocation{}, err
+	}
+	return r, nil
+}
+
+// Revoked devuelve las revocaciones vigentes, de la más reciente a la más
+// antigua.
+func (t *Tokens) Revoked() []Revocation {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pruneLocked(time.Now())
+	out := make([]Revocation, 0, len(t.revoked))
+	for _, r := range t.revoked {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RevokedAt.After(out[j].RevokedAt) })
+	return out
+}
+
+// parse valida firma y caducidad; exp es 0 en modo MVP.
+func (t *Tokens) parse(token string, now time.Time) (uid string, exp int64, ok bool) {
+	if t.Secret == "" {
+		// modo MVP: token == userID
+		return token, 0, token != ""
+	}
+	parts := strings.Split(token, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", 0, false
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > exp {
+		return "", 0, false
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(t.sign(parts[0], parts[1]))) {
+		return "", 0, false
+	}
+	return parts[0], exp, true
+}
+
+func (t *Tokens) sign(uid, expStr string) string {
+	mac := hmac.New(sha256.New, []byte(t.Secret))
+	mac.Write([]byte(uid + "|" + expStr))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pruneLocked olvida las revocaciones de tokens ya caducados.
+func (t *Tokens) pruneLocked(now time.Time) {
+	for h, r := range t.revoked {
+		if r.Expires != 0 && now.Unix() > r.Expires {
+			delete(t.revoked, h)
+		}
+	}
+}
+
+// saveLocked guarda en Path; el llamador tiene t.mu.
+func (t *Tokens) saveLocked() error {
+	if t.Path == "" {
+		return nil
+	}
+	list := make([]Revocation, 0, len(t.revoked))
+	for _, r := range t.revoked {
+		list = append(list, r)
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(t.Path, b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTokens_MintVerifyRevoke(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revoked.json")
+	tk, err := Load("s3cr3t", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, exp, err := tk.Mint("ana", time.Hour)
+	if err != nil || exp.Before(time.Now()) {
+		t.Fatalf("mint: %v %v", exp, err)
+	}
+	if uid, ok := tk.Verify(tok); !ok || uid != "ana" {
+		t.Fatalf("verify: %q %v", uid, ok)
+	}
+	if _, ok := (&Tokens{Secret: "otro"}).Verify(tok); ok {
+		t.Fatal("valió con otro secreto")
+	}
+	old, _, _ := tk.Mint("ana", -time.Minute)
+	if _, ok := tk.Verify(old); ok {
+		t.Fatal("valió un token caducado")
+	}
+	if _, _, err := tk.Mint("a:b", time.Hour); !errors.Is(err, ErrInvalidUser) {
+		t.Fatalf("usuario con ':': %v", err)
+	}
+
+	if _, err := tk.Revoke("basura"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("revocar basura: %v", err)
+	}
+	r, err := tk.Revoke(tok)
+	if err != nil || r.User != "ana" || r.Expires != exp.Unix() {
+		t.Fatalf("revoke: %+v %v", r, err)
+	}
+	if _, ok := tk.Verify(tok); ok {
+		t.Fatal("valió un token revocado")
+	}
+
+	// la revocación sobrevive a un reinicio
+	again, err := Load("s3cr3t", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := again.Verify(tok); ok || len(again.Revoked()) != 1 {
+		t.Fatal("se perdió la revocación")
+	}
+}
+
+func TestTokens_MVP(t *testing.T) {
+	tk := &Tokens{}
+	if uid, ok := tk.Verify("ana"); !ok || uid != "ana" {
+		t.Fatalf("verify: %q %v", uid, ok)
+	}
+	if _, _, err := tk.Mint("ana", time.Hour); !errors.Is(err, ErrNoSecret) {
+		t.Fatalf("mint sin secreto: %v", err)
+	}
+	if _, err := tk.Revoke("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tk.Verify("ana"); ok {
+		t.Fatal("valió un token revocado")
+	}
+}
@@ -0,0 +1,246 @@
+// Package channel lleva los canales compartidos: portapapeles con nombre
+// a los que pertenecen varios usuarios, cada uno con un rol. La difusión
+// la hace ws.Server; aquí solo se decide quién puede leer y escribir.
+package channel
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"clip-sync/server/internal/fsutil"
+)
+
+// Role es el nivel de acceso de un miembro. Cada rol incluye los
+// anteriores: un writer también lee y un owner también escribe.
+type Role int
+
+const (
+	None Role = iota
+	Reader
+	Writer
+	Owner
+)
+
+func (r Role) String() string {
+	switch r {
+	case Reader:
+		return "reader"
+	case Writer:
+		return "writer"
+	case Owner:
+		return "owner"
+	}
+	return "none"
+}
+
+// ParseRole interpreta "reader", "writer" u "owner".
+func ParseRole(s string) (Role, bool) {
+	switch s {
+	case "reader":
+		return Reader, true
+	case "writer":
+		return Writer, true
+	case "owner":
+		return Owner, true
+	}
+	return None, false
+}
+
+func (r Role) MarshalText() ([]byte, error) { return []byte(r.String()), nil }
+
+func (r *Role) UnmarshalText(b []byte) error {
+	role, ok := ParseRole(string(b))
+	if !ok {
+		return errors.New("unknown role " + string(b))
+	}
+	*r = role
+	return nil
+}
+
+var (
+	ErrInvalidName = errors.New("invalid channel name")
+	ErrExists      = errors.New("channel already exists")
+	ErrNotFound    = errors.New("channel not found")
+	ErrForbidden   = errors.New("not allowed in this channel")
+	ErrLastOwner   = errors.New("a channel needs at least one owner")
+)
+
+// mismas reglas que un device_id
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidName indica si name sirve como nombre de canal.
+func ValidName(name string) bool { return nameRe.MatchString(name) }
+
+// Membership es un canal visto por uno de sus miembros.
+type Membership struct {
+	Channel string `json:"channel"`
+	Role    Role   `json:"role"`
+}
+
+// Registry guarda los canales y sus miembros. Con Path, cada cambio se
+// escribe a ese fichero JSON; sin él los canales viven en memoria.
+type Registry struct {
+	Path string
+
+	mu    sync.RWMutex
+	chans map[string]map[string]Role // canal -> userID -> rol
+}
+
+// Load crea un Registry persistido en path, con lo que ya hubiera en él.
+// Un fichero que no existe es un registro vacío.
+func Load(path string) (*Registry, error) {
+	r := &Registry{Path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &r.chans); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Create crea name con owner como único miembro.
+func (r *Registry) Create(name, owner string) error {
+	if !ValidName(name) {
+		return ErrInvalidName
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.chans[name]; ok {
+		return ErrExists
+	}
+	if r.chans == nil {
+		r.chans = make(map[string]map[string]Role)
+	}
+	r.chans[name] = map[string]Role{owner: Owner}
+	return r.saveLocked()
+}
+
+// Delete borra name; solo un owner.
+func (r *Registry) Delete(name, by string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members, ok := r.chans[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if members[by] != Owner {
+		return ErrForbidden
+	}
+	delete(r.chans, name)
+	return r.saveLocked()
+}
+
+// SetMember da a user el rol role en name; solo un owner.
+func (r *Registry) SetMember(name, by, user string, role Role) error {
+	if role == None {
+		return r.RemoveMember(name, by, user)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members, ok := r.chans[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if members[by] != Owner {
+		return ErrForbidden
+	}
+	if members[user] == Owner && role != Owner && owners(members) == 1 {
+		return ErrLastOwner
+	}
+	members[user] = role
+	return r.saveLocked()
+}
+
+// RemoveMember saca a user de name. Puede hacerlo un owner o el propio
+// usuario (salir del canal).
+func (r *Registry) RemoveMember(name, by, user string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members, ok := r.chans[name]
+	if !ok {
+		return ErrNotFound
+	}
+	if by != user && members[by] != Owner {
+		return ErrForbidden
+	}
+	if members[user] == None {
+		return nil
+	}
+	if members[user] == Owner && owners(members) == 1 {
+		return ErrLastOwner
+	}
+	delete(members, user)
+	return r.saveLocked()
+}
+
+// Role devuelve el rol de user en name (None si no es miembro o el canal
+// no existe).
+func (r *Registry) Role(name, user string) Role {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.chans[name][user]
+}
+
+// Members devuelve los miembros de name; solo para sus miembros.
+func (r *Registry) Members(name, by string) (map[string]Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	members, ok := r.chans[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if members[by] == None {
+		// a quien no es miembro no se le dice si el canal existe
+		return nil, ErrNotFound
+	}
+	out := make(map[string]Role, len(members))
+	for u, role := range members {
+		out[u] = role
+	}
+	return out, nil
+}
+
+// List devuelve los canales de user, ordenados por nombre.
+func (r *Registry) List(user string) []Membership {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []Membership
+	for name, members := range r.chans {
+		if role := members[user]; role != None {
+			out = append(out, Membership{Channel: name, Role: role})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Channel < out[j].Channel })
+	return out
+}
+
+func owners(members map[string]Role) int {
+	n := 0
+	for _, role := range members {
+		if role == Owner {
+			n++
+		}
+	}
+	return n
+}
+
+// saveLocked escribe el registro a Path; el llamador tiene r.mu.
+func (r *Registry) saveLocked() error {
+	if r.Path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(r.chans, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(r.Path, b)
+}
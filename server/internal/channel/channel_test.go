@@ -0,0 +1,64 @@
+package channel
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistry_RolesAndACL(t *testing.T) {
+	r := &Registry{}
+	if err := r.Create("on call", "ana"); !errors.Is(err, ErrInvalidName) {
+		t.Fatalf("nombre inválido: %v", err)
+	}
+	if err := r.Create("oncall", "ana"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create("oncall", "bob"); !errors.Is(err, ErrExists) {
+		t.Fatalf("duplicado: %v", err)
+	}
+	if err := r.SetMember("oncall", "bob", "bob", Owner); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("un no miembro se hizo owner: %v", err)
+	}
+	_ = r.SetMember("oncall", "ana", "bob", Writer)
+	_ = r.SetMember("oncall", "ana", "eve", Reader)
+	if err := r.SetMember("oncall", "bob", "eve", Writer); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("un writer cambió roles: %v", err)
+	}
+	if r.Role("oncall", "bob") != Writer || r.Role("oncall", "eve") != Reader || r.Role("oncall", "x") != None {
+		t.Fatal("roles inesperados")
+	}
+	if _, err := r.Members("oncall", "x"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("un no miembro ve los miembros: %v", err)
+	}
+	if err := r.SetMember("oncall", "ana", "ana", Reader); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("el único owner se degradó: %v", err)
+	}
+	if err := r.RemoveMember("oncall", "eve", "eve"); err != nil || r.Role("oncall", "eve") != None {
+		t.Fatalf("salirse: %v", err)
+	}
+	if list := r.List("bob"); len(list) != 1 || list[0].Role != Writer {
+		t.Fatalf("List=%v", list)
+	}
+	if err := r.Delete("oncall", "bob"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("un writer borró el canal: %v", err)
+	}
+}
+
+func TestRegistry_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	r, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = r.Create("oncall", "ana")
+	_ = r.SetMember("oncall", "ana", "bob", Reader)
+
+	again, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Role("oncall", "ana") != Owner || again.Role("oncall", "bob") != Reader {
+		t.Fatalf("tras recargar: %v", again.List("bob"))
+	}
+}
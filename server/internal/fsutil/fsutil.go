@@ -0,0 +1,34 @@
+// Package fsutil reúne utilidades de ficheros compartidas por los
+// registros que se guardan en disco (canales, revocaciones, política,
+// metadatos de blobs).
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WriteFile escribe data en path a través de un temporal en el mismo
+// directorio y un rename, para que un lector (o un reinicio a medias) nunca
+// vea el fichero a medio escribir.
+func WriteFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
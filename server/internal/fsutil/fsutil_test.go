@@ -0,0 +1,27 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile_ReplacesWithoutLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	for _, want := range []string{`{"a":1}`, `{"b":2}`} {
+		if err := WriteFile(path, []byte(want)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := os.ReadFile(path); err != nil || string(got) != want {
+			t.Fatalf("contenido %q (%v), quiero %q", got, err, want)
+		}
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 1 {
+		t.Fatalf("quedaron temporales: %v", ents)
+	}
+
+	if err := WriteFile(filepath.Join(dir, "no", "existe.json"), nil); err == nil {
+		t.Fatal("escribió en un directorio que no existe")
+	}
+}
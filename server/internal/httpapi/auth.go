@@ -0,0 +1,57 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TokenFromRequest extrae las credenciales igual que /ws las acepta:
+// cabecera "Authorization: Bearer <token>" o query "?token=<token>".
+func TokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		if len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			return strings.TrimSpace(h[7:])
+		}
+	}
+	return r.URL.Query().Get("token")
+}
+
+// authenticate devuelve el userID del request. Sin Auth configurado todo
+// request es anónimo (userID vacío) y se acepta.
+func (s *UploadServer) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if s.Auth == nil {
+		return "", true
+	}
+	uid, ok := s.Auth(TokenFromRequest(r))
+	if !ok || uid == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="clip-sync"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	return uid, true
+}
+
+// authorizeDownload acepta una URL firmada válida para subject ("<id>" o
+// "<id>/thumb") o el token del dueño del blob id. Una firma presente pero
+// inválida o expirada no cae al token: 403.
+func (s *UploadServer) authorizeDownload(w http.ResponseWriter, r *http.Request, id, subject string) bool {
+	if q := r.URL.Query(); q.Get("sig") != "" {
+		if s.Signer == nil || !s.Signer.verify(subject, q) {
+			http.Error(w, "invalid or expired link", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+	user, ok := s.authenticate(w, r)
+	if !ok {
+		return false
+	}
+	if s.Auth != nil {
+		// solo dispositivos del dueño; 404 para no revelar que el id existe
+		if owner, ok := s.blobOwner(id); !ok || owner != user {
+			http.NotFound(w, r)
+			return false
+		}
+	}
+	return true
+}
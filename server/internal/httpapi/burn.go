@@ -0,0 +1,135 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultBurnTTL = 10 * time.Minute
+
+// IsBurnRequest: el cliente marca el upload como burn-after-read con
+// la cabecera "X-Clip-Burn: 1" o "?burn=1".
+func IsBurnRequest(r *http.Request) bool {
+	v := r.Header.Get("X-Clip-Burn")
+	if v == "" {
+		v = r.URL.Query().Get("burn")
+	}
+	return v == "1" || strings.EqualFold(v, "true")
+}
+
+func (s *UploadServer) burnTTL() time.Duration {
+	if s.BurnTTL > 0 {
+		return s.BurnTTL
+	}
+	return defaultBurnTTL
+}
+
+// ExpectRecipients fija los dispositivos que deben leer un blob burn antes
+// de borrarlo. Se llama al hacer broadcast del clip, antes de enviarlo.
+// Solo cuenta la primera llamada: reenviar el clip no vuelve a abrirlo a
+// quien ya lo leyó. Para blobs normales o de otro dueño no hace nada.
+func (s *UploadServer) ExpectRecipients(userID, id string, devices []string) {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	m, err := s.loadMeta(id)
+	if err != nil || !m.Burn || m.Armed || m.Owner != userID {
+		return
+	}
+	m.Pending, m.Armed = slices.Clone(devices), true
+	_ = s.saveMeta(id, m)
+}
+
+// consumeBurn registra la lectura de dev. ok=false si dev no es un
+// destinatario pendiente (ya leyó, no era destinatario o caducó);
+// last=true si era el último y el blob debe borrarse tras servirlo.
+func (s *UploadServer) consumeBurn(id, dev string, m *blobMeta) (last, ok bool) {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	if m.burnExpired(time.Now()) {
+		s.removeBlob(id)
+		return false, false
+	}
+	// releer bajo lock: otro request pudo consumir entre tanto
+	cur, err := s.loadMeta(id)
+	if err != nil {
+		return false, false
+	}
+	i := slices.Index(cur.Pending, dev)
+	if dev == "" || i < 0 {
+		return false, false
+	}
+	cur.Pending = slices.Delete(cur.Pending, i, i+1)
+	if err := s.saveMeta(id, cur); err != nil {
+		return false, false
+	}
+	return len(cur.Pending) == 0, true
+}
+
+// removeBlob borra el blob, su miniatura y sus metadatos; ignora los que
+// ya no existen. Si el blob no se pudo borrar deja los metadatos para
+// reintentar y devuelve el error.
+func (s *UploadServer) removeBlob(id string) error {
+	p := filepath.Join(s.Dir, id)
+	owner := ""
+	if m, err := s.loadMeta(id); err == nil {
+		owner = m.Owner
+	}
+	s.usage.mu.Lock()
+	fi, statErr := os.Stat(p)
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		s.usage.mu.Unlock()
+		return err
+	}
+	if statErr == nil {
+		s.usage.add(owner, -1, -fi.Size())
+	}
+	s.usage.mu.Unlock()
+	_ = os.Remove(s.thumbPath(id))
+	_ = os.Remove(s.metaPath(id))
+	return nil
+}
+
+// Sweep borra los blobs burn cuyo TTL venció sin que todos los leyeran,
+// los huérfanos pasado OrphanGrace y las reservas de relay abandonadas.
+func (s *UploadServer) Sweep(now time.Time) {
+	s.sweepRelays(now)
+	ents, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return
+	}
+	for _, e := range ents {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !idRe.MatchString(id) {
+			continue
+		}
+		s.metaMu.Lock()
+		if m, err := s.loadMeta(id); err == nil {
+			switch {
+			case m.burnExpired(now):
+				s.removeBlob(id)
+			case s.orphaned(m, now):
+				s.reclaimOrphan(id, m)
+			}
+		}
+		s.metaMu.Unlock()
+	}
+}
+
+// RunJanitor ejecuta Sweep periódicamente hasta que ctx termine.
+func (s *UploadServer) RunJanitor(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.Sweep(now)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func uploadBurn(t *testing.T, h http.Handler) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader([]byte("pw=hunter2")))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", "Bearer u1")
+	req.Header.Set("X-Clip-Burn", "1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	var up uploadResp
+	if err := json.NewDecoder(rr.Body).Decode(&up); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("upload status=%d err=%v", rr.Code, err)
+	}
+	id, _ := BlobID(up.UploadURL)
+	return id
+}
+
+func TestBurn_DeletedAfterEveryRecipientReads(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+
+	id := uploadBurn(t, h)
+	s.ExpectRecipients("u1", id, []string{"B", "C"})
+
+	get := func(dev string) int {
+		req := httptest.NewRequest(http.MethodGet, "/d/"+id+"?device="+dev, nil)
+		req.Header.Set("Authorization", "Bearer u1")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	steps := []struct {
+		dev  string
+		want int
+	}{
+		{"B", http.StatusOK},
+		{"B", http.StatusNotFound}, // una sola lectura por destinatario
+		{"X", http.StatusNotFound}, // no era destinatario
+		{"C", http.StatusOK},
+	}
+	for _, st := range steps {
+		if code := get(st.dev); code != st.want {
+			t.Fatalf("device %s: status=%d, want %d", st.dev, code, st.want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, id)); !os.IsNotExist(err) {
+		t.Fatalf("el blob debía borrarse tras la última lectura: %v", err)
+	}
+}
+
+// Un segundo broadcast del mismo blob no vuelve a abrirlo a quien ya leyó.
+func TestBurn_ExpectRecipientsOnlyOnce(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+
+	id := uploadBurn(t, h)
+	s.ExpectRecipients("u1", id, []string{"B", "C"})
+	get := func(dev string) int {
+		req := httptest.NewRequest(http.MethodGet, "/d/"+id+"?device="+dev, nil)
+		req.Header.Set("Authorization", "Bearer u1")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := get("B"); code != http.StatusOK {
+		t.Fatalf("B: status=%d", code)
+	}
+	s.ExpectRecipients("u1", id, []string{"B", "C", "X"})
+	if code := get("B"); code != http.StatusNotFound {
+		t.Fatalf("B leyó dos veces: status=%d", code)
+	}
+	if code := get("X"); code != http.StatusNotFound {
+		t.Fatalf("X se añadió tarde: status=%d", code)
+	}
+	if code := get("C"); code != http.StatusOK {
+		t.Fatalf("C: status=%d", code)
+	}
+	if _, err := os.Stat(filepath.Join(dir, id)); !os.IsNotExist(err) {
+		t.Fatalf("el blob debía borrarse tras la última lectura: %v", err)
+	}
+
+	// sin destinatarios al primer broadcast tampoco se rearma
+	id2 := uploadBurn(t, h)
+	s.ExpectRecipients("u1", id2, nil)
+	s.ExpectRecipients("u1", id2, []string{"B"})
+	id = id2
+	if code := get("B"); code != http.StatusNotFound {
+		t.Fatalf("rearmado tras un broadcast vacío: status=%d", code)
+	}
+}
+
+func TestBurn_SweepAfterTTL(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth, BurnTTL: time.Minute}
+	id := uploadBurn(t, newAuthMux(s))
+
+	s.Sweep(time.Now())
+	if _, err := os.Stat(filepath.Join(dir, id)); err != nil {
+		t.Fatalf("no debía borrarse antes del TTL: %v", err)
+	}
+	s.Sweep(time.Now().Add(2 * time.Minute))
+	ents, _ := os.ReadDir(dir)
+	if len(ents) != 0 {
+		t.Fatalf("esperaba directorio vacío tras el TTL, quedan %d", len(ents))
+	}
+}
@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compresión: los blobs compresibles (types.Compressible) se guardan con
+// gzip (antes de cifrar) y se sirven tal cual a clientes con
+// "Accept-Encoding: gzip". Solo gzip: zstd exigiría una dependencia externa.
+
+// decodeBody aplica Content-Encoding del request. Devuelve false si la
+// codificación no está soportada.
+func decodeBody(r *http.Request) (io.ReadCloser, bool) {
+	switch ce := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); ce {
+	case "", "identity":
+		return r.Body, true
+	case "gzip", "x-gzip":
+		return &gzipBody{src: r.Body}, true
+	default:
+		return nil, false
+	}
+}
+
+// gzipBody abre el lector gzip en la primera lectura para que un
+// encabezado inválido salga como error de Read y no antes.
+type gzipBody struct {
+	src io.ReadCloser
+	zr  *gzip.Reader
+}
+
+func (g *gzipBody) Read(p []byte) (int, error) {
+	if g.zr == nil {
+		zr, err := gzip.NewReader(g.src)
+		if err != nil {
+			return 0, gzipFormatErr(err)
+		}
+		g.zr = zr
+	}
+	n, err := g.zr.Read(p)
+	if err != nil && err != io.EOF {
+		err = gzipFormatErr(err)
+	}
+	return n, err
+}
+
+// gzipFormatErr distingue un cuerpo mal codificado (400) de un error de I/O.
+func gzipFormatErr(err error) error {
+	var corrupt flate.CorruptInputError
+	if errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.As(err, &corrupt) {
+		return errBadEncoding
+	}
+	return err
+}
+
+func (g *gzipBody) Close() error { return g.src.Close() }
+
+var errBadEncoding = errors.New("invalid gzip body")
+
+// acceptsGzip interpreta Accept-Encoding (gzip o *, con q > 0).
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	src io.Closer
+}
+
+func (g gzipReadCloser) Close() error { return g.src.Close() }
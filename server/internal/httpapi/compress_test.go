@@ -0,0 +1,108 @@
+package httpapi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func gz(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(b)
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestCompress_AtRestAndNegotiation(t *testing.T) {
+	kf, _ := writeKeyfile(t, "k1")
+	kr, _ := LoadKeyring(kf)
+	dir := t.TempDir()
+	// compresión + cifrado juntos: gzip se aplica antes de cifrar
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth, Compress: true, Keys: kr}
+	h := newAuthMux(s)
+
+	logs := []byte(strings.Repeat(`{"level":"info","msg":"request served"}`+"\n", 2000))
+	_, url := uploadAs(t, h, "u1", logs)
+	id, _ := BlobID(url)
+	if fi, _ := os.Stat(filepath.Join(dir, id)); fi.Size() > int64(len(logs)/5) {
+		t.Fatalf("no se comprimió: %d de %d bytes", fi.Size(), len(logs))
+	}
+
+	// sin Accept-Encoding: bytes originales
+	if code, got := download(t, h, url); code != http.StatusOK || !bytes.Equal(got, logs) {
+		t.Fatalf("plain status=%d igual=%v", code, bytes.Equal(got, logs))
+	}
+
+	// con Accept-Encoding: gzip se sirve comprimido
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer u1")
+	req.Header.Set("Accept-Encoding", "br;q=1.0, gzip;q=0.8")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding=%q", rr.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); !bytes.Equal(got, logs) {
+		t.Fatal("contenido gzip distinto del original")
+	}
+}
+
+func TestCompress_SkipsCompressedMimes(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth, Compress: true}
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(bytes.Repeat([]byte("P"), 1000)))
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("Authorization", "Bearer u1")
+	rr := httptest.NewRecorder()
+	newAuthMux(s).ServeHTTP(rr, req)
+	var up uploadResp
+	_ = json.NewDecoder(rr.Body).Decode(&up)
+	id, _ := BlobID(up.UploadURL)
+	if m, err := s.loadMeta(id); err != nil || m.Encoding != "" {
+		t.Fatalf("image/png no debe comprimirse: meta=%+v err=%v", m, err)
+	}
+}
+
+func TestUpload_ContentEncodingGzip(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+	plain := bytes.Repeat([]byte("abc"), 10_000)
+
+	post := func(body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set("Authorization", "Bearer u1")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post(gz(plain))
+	var up uploadResp
+	if err := json.NewDecoder(rr.Body).Decode(&up); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("status=%d err=%v", rr.Code, err)
+	}
+	if up.Size != len(plain) {
+		t.Fatalf("size=%d, want tamaño decodificado %d", up.Size, len(plain))
+	}
+	if _, got := download(t, h, up.UploadURL); !bytes.Equal(got, plain) {
+		t.Fatal("se guardó el cuerpo sin decodificar")
+	}
+
+	if rr := post([]byte("not gzip")); rr.Code != http.StatusBadRequest {
+		t.Fatalf("gzip inválido: status=%d, want 400", rr.Code)
+	}
+}
@@ -0,0 +1,280 @@
+package httpapi
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Cifrado en reposo (envelope encryption):
+//   - cada blob tiene su propia data key (DEK) AES-256 aleatoria;
+//   - la DEK se guarda en los metadatos envuelta con AES-GCM por una key
+//     encryption key (KEK) del keyring, identificada por kid;
+//   - el contenido se cifra en segmentos de encChunk bytes (AES-GCM, nonce =
+//     contador + marca de último segmento), así se cifra y descifra en
+//     streaming con memoria constante y no se puede truncar sin detectarlo.
+
+const encChunk = 64 << 10
+
+// Keyring contiene las KEK. La primera del fichero es la activa (envuelve
+// DEKs nuevas); las demás solo se usan para leer blobs antiguos.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// LoadKeyring lee un fichero con una KEK por línea: "<kid> <base64 de 32 bytes>".
+// Líneas vacías y las que empiezan por '#' se ignoran. Para rotar: añadir la
+// nueva clave como primera línea, reiniciar y llamar a RewrapKeys.
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	kr := &Keyring{keys: make(map[string][]byte)}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kid, enc, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("keyfile line %d: want \"<kid> <base64>\"", i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(enc))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("keyfile line %d: key must be 32 bytes base64", i+1)
+		}
+		if _, dup := kr.keys[kid]; dup {
+			return nil, fmt.Errorf("keyfile line %d: duplicate kid %q", i+1, kid)
+		}
+		kr.keys[kid] = key
+		if kr.primary == "" {
+			kr.primary = kid
+		}
+	}
+	if kr.primary == "" {
+		return nil, errors.New("keyfile: no keys")
+	}
+	return kr, nil
+}
+
+// encInfo va en blobMeta: DEK envuelta y la KEK que la envuelve.
+type encInfo struct {
+	KID string `json:"kid"`
+	DEK []byte `json:"dek"` // nonce || AES-GCM(kek, dek)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(blk)
+}
+
+// wrap genera una DEK nueva para el blob id y la envuelve con la KEK activa.
+func (k *Keyring) wrap(id string) (dek []byte, info *encInfo, err error) {
+	dek = make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+	info, err = k.wrapWith(k.primary, id, dek)
+	return dek, info, err
+}
+
+func (k *Keyring) wrapWith(kid, id string, dek []byte) (*encInfo, error) {
+	aead, err := newGCM(k.keys[kid])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &encInfo{KID: kid, DEK: aead.Seal(nonce, nonce, dek, []byte(id))}, nil
+}
+
+func (k *Keyring) unwrap(id string, info *encInfo) ([]byte, error) {
+	kek, ok := k.keys[info.KID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", info.KID)
+	}
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	ns := aead.NonceSize()
+	if len(info.DEK) < ns {
+		return nil, errors.New("wrapped key too short")
+	}
+	return aead.Open(nil, info.DEK[:ns], info.DEK[ns:], []byte(id))
+}
+
+// segNonce: 4 bytes de marca (1 = último segmento) + contador big-endian.
+func segNonce(ctr uint64, last bool) []byte {
+	n := make([]byte, 12)
+	if last {
+		n[3] = 1
+	}
+	binary.BigEndian.PutUint64(n[4:], ctr)
+	return n
+}
+
+// encryptWriter cifra por segmentos; Close sella el último (aunque esté vacío).
+type encryptWriter struct {
+	aead cipher.AEAD
+	w    io.Writer
+	aad  []byte
+	buf  []byte
+	ctr  uint64
+}
+
+func newEncryptWriter(w io.Writer, dek []byte, id string) (*encryptWriter, error) {
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{aead: aead, w: w, aad: []byte(id), buf: make([]byte, 0, encChunk+aead.Overhead())}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// se retiene siempre un segmento completo: solo Close sabe cuál es el último
+		if len(e.buf) == encChunk {
+			if err := e.flush(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		k := min(encChunk-len(e.buf), len(p))
+		e.buf = append(e.buf, p[:k]...)
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	out := e.aead.Seal(e.buf[:0], segNonce(e.ctr, last), e.buf, e.aad)
+	e.ctr++
+	_, err := e.w.Write(out)
+	e.buf = e.buf[:0]
+	return err
+}
+
+func (e *encryptWriter) Close() error { return e.flush(true) }
+
+// decryptReader descifra segmento a segmento y falla si falta el último.
+type decryptReader struct {
+	aead cipher.AEAD
+	r    *bufio.Reader
+	aad  []byte
+	seg  []byte
+	out  []byte
+	ctr  uint64
+	done bool
+}
+
+func newDecryptReader(r io.Reader, dek []byte, id string) (*decryptReader, error) {
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		aead: aead,
+		r:    bufio.NewReaderSize(r, encChunk+aead.Overhead()),
+		aad:  []byte(id),
+		seg:  make([]byte, encChunk+aead.Overhead()),
+	}, nil
+}
+
+var errCorruptBlob = errors.New("encrypted blob is corrupt or truncated")
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.r, d.seg)
+		last := false
+		switch {
+		case err == io.ErrUnexpectedEOF || err == io.EOF:
+			last = true
+		case err != nil:
+			return 0, err
+		default:
+			if _, perr := d.r.Peek(1); perr == io.EOF {
+				last = true
+			}
+		}
+		pt, oerr := d.aead.Open(d.seg[:0], segNonce(d.ctr, last), d.seg[:n], d.aad)
+		if oerr != nil {
+			return 0, errCorruptBlob
+		}
+		d.ctr++
+		d.out = pt
+		d.done = last
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// RewrapKeys vuelve a envolver con la KEK activa todas las DEK que usan otra.
+// Tras ejecutarlo, las KEK antiguas pueden retirarse del keyfile.
+func (s *UploadServer) RewrapKeys() (int, error) {
+	if s.Keys == nil {
+		return 0, nil
+	}
+	ents, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range ents {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !idRe.MatchString(id) {
+			continue
+		}
+		s.metaMu.Lock()
+		err := s.rewrap(id, &n)
+		s.metaMu.Unlock()
+		if err != nil {
+			return n, fmt.Errorf("rewrap %s: %w", id, err)
+		}
+	}
+	return n, nil
+}
+
+func (s *UploadServer) rewrap(id string, n *int) error {
+	m, err := s.loadMeta(id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if m.Enc == nil || m.Enc.KID == s.Keys.primary {
+		return nil
+	}
+	dek, err := s.Keys.unwrap(id, m.Enc)
+	if err != nil {
+		return err
+	}
+	if m.Enc, err = s.Keys.wrapWith(s.Keys.primary, id, dek); err != nil {
+		return err
+	}
+	if err := s.saveMeta(id, m); err != nil {
+		return err
+	}
+	*n++
+	return nil
+}
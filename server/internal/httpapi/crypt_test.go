@@ -0,0 +1,109 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeyfile(t *testing.T, kids ...string) (string, map[string]string) {
+	t.Helper()
+	lines := make([]string, 0, len(kids))
+	keys := map[string]string{}
+	for _, kid := range kids {
+		k := make([]byte, 32)
+		_, _ = rand.Read(k)
+		keys[kid] = base64.StdEncoding.EncodeToString(k)
+		lines = append(lines, kid+" "+keys[kid])
+	}
+	p := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(p, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p, keys
+}
+
+func download(t *testing.T, h http.Handler, url string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer u1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr.Code, rr.Body.Bytes()
+}
+
+func TestEncryption_RoundTripAndRotation(t *testing.T) {
+	kf, keys := writeKeyfile(t, "k1")
+	kr, err := LoadKeyring(kf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 8 << 20, Auth: mvpAuth, Keys: kr}
+	h := newAuthMux(s)
+
+	// tamaño no múltiplo del segmento para cubrir el último parcial
+	body := make([]byte, 3*encChunk+123)
+	_, _ = rand.Read(body)
+	_, url := uploadAs(t, h, "u1", body)
+	id, _ := BlobID(url)
+
+	onDisk, _ := os.ReadFile(filepath.Join(dir, id))
+	if bytes.Contains(onDisk, body[:64]) {
+		t.Fatal("el blob se guardó en claro")
+	}
+	if code, got := download(t, h, url); code != http.StatusOK || !bytes.Equal(got, body) {
+		t.Fatalf("status=%d igual=%v", code, bytes.Equal(got, body))
+	}
+
+	// rotación: k2 pasa a ser la activa, k1 sigue disponible para leer
+	rotated := filepath.Join(t.TempDir(), "keys")
+	k2 := make([]byte, 32)
+	_, _ = rand.Read(k2)
+	_ = os.WriteFile(rotated, []byte("k2 "+base64.StdEncoding.EncodeToString(k2)+"\nk1 "+keys["k1"]+"\n"), 0o600)
+	if s.Keys, err = LoadKeyring(rotated); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.RewrapKeys(); err != nil || n != 1 {
+		t.Fatalf("rewrap n=%d err=%v", n, err)
+	}
+
+	// retirada de k1: el blob sigue legible solo con k2
+	only := filepath.Join(t.TempDir(), "keys")
+	_ = os.WriteFile(only, []byte("k2 "+base64.StdEncoding.EncodeToString(k2)+"\n"), 0o600)
+	if s.Keys, err = LoadKeyring(only); err != nil {
+		t.Fatal(err)
+	}
+	if code, got := download(t, h, url); code != http.StatusOK || !bytes.Equal(got, body) {
+		t.Fatalf("tras rotar: status=%d igual=%v", code, bytes.Equal(got, body))
+	}
+}
+
+func TestEncryption_DetectsTruncation(t *testing.T) {
+	var buf bytes.Buffer
+	ew, _ := newEncryptWriter(&buf, bytes.Repeat([]byte{7}, 32), "id")
+	_, _ = ew.Write(bytes.Repeat([]byte("x"), 2*encChunk+10))
+	_ = ew.Close()
+
+	// quitar el último segmento: el penúltimo no lleva la marca de final
+	cut := buf.Bytes()[:encChunk+16]
+	dr, _ := newDecryptReader(bytes.NewReader(cut), bytes.Repeat([]byte{7}, 32), "id")
+	if _, err := io.ReadAll(dr); err == nil {
+		t.Fatal("esperaba error por truncado")
+	}
+}
+
+func TestLoadKeyring_Invalid(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "keys")
+	_ = os.WriteFile(p, []byte("k1 c2hvcnQ=\n"), 0o600)
+	if _, err := LoadKeyring(p); err == nil {
+		t.Fatal("esperaba error por clave corta")
+	}
+}
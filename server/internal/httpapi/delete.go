@@ -0,0 +1,48 @@
+package httpapi
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// DeleteBlob atiende DELETE /d/{id}: solo el dueño puede borrar (con
+// Auth desactivado, cualquiera). 204 si se borró, 404 si no existe o es
+// de otro usuario.
+func (s *UploadServer) DeleteBlob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !idRe.MatchString(id) {
+		http.NotFound(w, r)
+		return
+	}
+	user, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if !s.Delete(user, id) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Delete borra el blob id si pertenece a userID. Devuelve false si no
+// existe o es de otro.
+func (s *UploadServer) Delete(userID, id string) bool {
+	if !idRe.MatchString(id) {
+		return false
+	}
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	if s.Auth != nil {
+		m, err := s.loadMeta(id)
+		if err != nil || m.Owner != userID {
+			return false
+		}
+	}
+	if _, err := os.Stat(filepath.Join(s.Dir, id)); err != nil {
+		return false
+	}
+	s.removeBlob(id)
+	return true
+}
@@ -0,0 +1,45 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestDeleteBlob_OwnerOnly(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+	h.HandleFunc("DELETE /d/{id}", s.DeleteBlob)
+
+	_, url := uploadAs(t, h, "u1", []byte("contraseña pegada por error"))
+	del := func(token string) int {
+		req := httptest.NewRequest(http.MethodDelete, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := del(""); code != http.StatusUnauthorized {
+		t.Fatalf("sin token: status=%d, want 401", code)
+	}
+	if code := del("u2"); code != http.StatusNotFound {
+		t.Fatalf("otro usuario: status=%d, want 404", code)
+	}
+	if code := del("u1"); code != http.StatusNoContent {
+		t.Fatalf("dueño: status=%d, want 204", code)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("quedaron %d archivos", len(ents))
+	}
+	if code, _ := download(t, h, url); code != http.StatusNotFound {
+		t.Fatalf("tras borrar: status=%d, want 404", code)
+	}
+	if code := del("u1"); code != http.StatusNotFound {
+		t.Fatalf("segundo borrado: status=%d, want 404", code)
+	}
+}
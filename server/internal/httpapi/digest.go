@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// Integridad: el cliente puede mandar el SHA-256 del contenido en
+// "Content-Digest: sha-256=:<base64>:" (RFC 9530) o en el antiguo
+// "Digest: SHA-256=<base64>" (RFC 3230). Se compara con los bytes ya
+// decodificados (tras Content-Encoding), que son los que se guardan y los
+// que recibe quien descarga. Otros algoritmos se ignoran.
+
+var (
+	errBadDigest      = &uploadError{http.StatusBadRequest, "invalid digest header"}
+	errDigestMismatch = &uploadError{http.StatusBadRequest, "digest mismatch"}
+)
+
+// wantDigest devuelve el SHA-256 pedido en h, o nil si no se pidió ninguno.
+func wantDigest(h textproto.MIMEHeader) ([]byte, error) {
+	if v := h.Get("Content-Digest"); v != "" {
+		return parseDigest(v, true)
+	}
+	if v := h.Get("Digest"); v != "" {
+		return parseDigest(v, false)
+	}
+	return nil, nil
+}
+
+// parseDigest busca sha-256 en una lista "alg=valor, ..."; en
+// Content-Digest el valor va entre ':' (byte sequence de structured fields).
+func parseDigest(v string, structured bool) ([]byte, error) {
+	for _, item := range strings.Split(v, ",") {
+		alg, val, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(alg), "sha-256") {
+			continue
+		}
+		val = strings.TrimSpace(val)
+		if structured {
+			if len(val) < 2 || val[0] != ':' || val[len(val)-1] != ':' {
+				return nil, errBadDigest
+			}
+			val = val[1 : len(val)-1]
+		}
+		sum, err := base64.StdEncoding.DecodeString(val)
+		if err != nil || len(sum) != sha256.Size {
+			return nil, errBadDigest
+		}
+		return sum, nil
+	}
+	return nil, nil
+}
+
+// reprDigest: el SHA-256 del contenido sin codificar, válido sirva o no
+// gzip, para que curl y compañía puedan verificar la descarga.
+func reprDigest(hexSum string) string {
+	b, _ := hex.DecodeString(hexSum)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(b) + ":"
+}
+
+func checkDigest(want, got []byte) error {
+	if want != nil && !bytes.Equal(want, got) {
+		return errDigestMismatch
+	}
+	return nil
+}
+
+// Digest devuelve el SHA-256 (hex) guardado para el blob id, o "" si no
+// se conoce (blobs sin sidecar, relays sin Content-Digest).
+func (s *UploadServer) Digest(id string) string {
+	if m, err := s.loadMeta(id); err == nil {
+		return m.SHA256
+	}
+	if rl := s.getRelay(id); rl != nil && rl.digest != nil {
+		return hex.EncodeToString(rl.digest) // el declarado al reservar
+	}
+	return ""
+}
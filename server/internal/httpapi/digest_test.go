@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestUpload_Digest(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+	body := []byte("contenido verificable")
+	sum := sha256.Sum256(body)
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+	wrong := sha256.Sum256([]byte("otro"))
+
+	post := func(name, value string, gzipped bool) *httptest.ResponseRecorder {
+		payload := body
+		if gzipped {
+			payload = gz(body)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(payload))
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("Authorization", "Bearer u1")
+		if name != "" {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	cases := []struct {
+		name, header, value string
+		gzipped             bool
+		want                int
+	}{
+		{"sin digest", "", "", false, http.StatusOK},
+		{"content-digest", "Content-Digest", "sha-512=:AAAA:, sha-256=:" + b64 + ":", false, http.StatusOK},
+		{"digest legado", "Digest", "SHA-256=" + b64, false, http.StatusOK},
+		{"sobre lo decodificado", "Content-Digest", "sha-256=:" + b64 + ":", true, http.StatusOK},
+		{"no coincide", "Content-Digest", "sha-256=:" + base64.StdEncoding.EncodeToString(wrong[:]) + ":", false, http.StatusBadRequest},
+		{"mal formado", "Content-Digest", "sha-256=" + b64, false, http.StatusBadRequest},
+		{"solo otros algoritmos", "Digest", "MD5=HUXZLQLMuI/KZ5KDcJPcOA==", false, http.StatusOK},
+	}
+	var last string
+	for _, c := range cases {
+		rr := post(c.header, c.value, c.gzipped)
+		if rr.Code != c.want {
+			t.Fatalf("%s: status=%d, want %d (%s)", c.name, rr.Code, c.want, rr.Body)
+		}
+		if c.want != http.StatusOK {
+			continue
+		}
+		var up uploadResp
+		_ = json.NewDecoder(rr.Body).Decode(&up)
+		if up.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Fatalf("%s: sha256=%q", c.name, up.SHA256)
+		}
+		last = up.UploadURL
+		id, _ := BlobID(up.UploadURL)
+		if s.Digest(id) != up.SHA256 {
+			t.Fatalf("%s: Digest(id)=%q", c.name, s.Digest(id))
+		}
+	}
+
+	// los rechazos no dejan blob: 5 aceptados, cada uno con su sidecar
+	if ents, _ := os.ReadDir(dir); len(ents) != 2*5 {
+		t.Fatalf("archivos en disco=%d, want 10", len(ents))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, last, nil)
+	req.Header.Set("Authorization", "Bearer u1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Repr-Digest"); got != "sha-256=:"+b64+":" {
+		t.Fatalf("Repr-Digest=%q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"clip-sync/server/internal/fsutil"
+)
+
+// blobMeta se guarda junto al blob como <id>.json.
+type blobMeta struct {
+	Owner    string    `json:"owner,omitempty"`
+	Mime     string    `json:"mime,omitempty"`
+	Detected string    `json:"detected,omitempty"` // tipo por magic bytes
+	Filename string    `json:"filename,omitempty"` // nombre original (multipart)
+	Size     int64     `json:"size"`
+	SHA256   string    `json:"sha256,omitempty"` // hex del contenido original
+	Created  time.Time `json:"created"`
+
+	// burn-after-read: se borra cuando todos los Pending lo leyeron o al
+	// pasar BurnUntil (unix), lo que ocurra antes.
+	Burn      bool     `json:"burn,omitempty"`
+	BurnUntil int64    `json:"burn_until,omitempty"`
+	Pending   []string `json:"pending,omitempty"`
+	Armed     bool     `json:"armed,omitempty"` // Pending ya se fijó; no se vuelve a fijar
+
+	Orphan bool   `json:"orphan,omitempty"` // ningún clip lo ha referenciado aún
+	Scan   string `json:"scan,omitempty"`   // veredicto del antivirus: "clean" o "infected: <firma>"
+
+	Enc      *encInfo `json:"enc,omitempty"`      // nil = guardado en claro
+	Encoding string   `json:"encoding,omitempty"` // "gzip" si se comprimió al guardar
+}
+
+// persist indica si vale la pena escribir el sidecar: sin dueño (Auth
+// desactivado) ni estado propio no hay nada que recordar.
+func (m *blobMeta) persist() bool {
+	return m.Owner != "" || m.Filename != "" || m.Burn || m.Orphan || m.Scan != "" || m.Enc != nil || m.Encoding != ""
+}
+
+func (m *blobMeta) burnExpired(now time.Time) bool {
+	return m.Burn && now.Unix() > m.BurnUntil
+}
+
+// Owns indica si el blob id pertenece a userID. Sin Auth no hay dueños y
+// cualquier blob existente cuenta como propio.
+func (s *UploadServer) Owns(userID, id string) bool {
+	if s.Auth == nil {
+		_, err := os.Stat(filepath.Join(s.Dir, id))
+		return err == nil || s.Relaying(id)
+	}
+	owner, ok := s.blobOwner(id)
+	return ok && owner == userID
+}
+
+// blobOwner devuelve el dueño del blob id, guardado o en relay.
+func (s *UploadServer) blobOwner(id string) (string, bool) {
+	if m, err := s.loadMeta(id); err == nil {
+		return m.Owner, true
+	}
+	if rl := s.getRelay(id); rl != nil {
+		return rl.owner, true
+	}
+	return "", false
+}
+
+func (s *UploadServer) metaPath(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+func (s *UploadServer) loadMeta(id string) (*blobMeta, error) {
+	b, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		return nil, err
+	}
+	var m blobMeta
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// saveMeta escribe con fsutil.WriteFile para que un lector nunca vea JSON a medias.
+func (s *UploadServer) saveMeta(id string, m *blobMeta) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(s.metaPath(id), b)
+}
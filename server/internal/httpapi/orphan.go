@@ -0,0 +1,56 @@
+package httpapi
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Huérfanos: con OrphanGrace > 0 cada blob nuevo nace marcado como no
+// referenciado (blobMeta.Orphan) y la marca se quita cuando un clip que lo
+// apunta se reparte. Los que siguen marcados pasado el plazo (el clip
+// nunca se mandó o falló el envío) los borra el janitor. Los blobs
+// anteriores a activar esto no llevan marca y no se tocan.
+
+type orphanMetrics struct {
+	found     int64 // huérfanos detectados pasado el plazo
+	reclaimed int64 // borrados con éxito
+	bytes     int64 // bytes liberados
+}
+
+// MarkReferenced registra que un clip de userID apunta al blob id.
+func (s *UploadServer) MarkReferenced(userID, id string) {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	m, err := s.loadMeta(id)
+	if err != nil || !m.Orphan || (s.Auth != nil && m.Owner != userID) {
+		return
+	}
+	m.Orphan = false
+	_ = s.saveMeta(id, m)
+}
+
+func (s *UploadServer) orphaned(m *blobMeta, now time.Time) bool {
+	return s.OrphanGrace > 0 && m.Orphan && now.Sub(m.Created) > s.OrphanGrace
+}
+
+// reclaimOrphan borra un huérfano y actualiza las métricas (bajo metaMu).
+func (s *UploadServer) reclaimOrphan(id string, m *blobMeta) {
+	atomic.AddInt64(&s.orphans.found, 1)
+	if err := s.removeBlob(id); err != nil {
+		return // se reintenta en la próxima pasada
+	}
+	atomic.AddInt64(&s.orphans.reclaimed, 1)
+	atomic.AddInt64(&s.orphans.bytes, m.Size)
+}
+
+// MetricsSnapshot devuelve contadores del almacenamiento para /healthz.
+func (s *UploadServer) MetricsSnapshot() map[string]int64 {
+	m := map[string]int64{
+		"orphans_found_total":           atomic.LoadInt64(&s.orphans.found),
+		"orphans_reclaimed_total":       atomic.LoadInt64(&s.orphans.reclaimed),
+		"orphans_reclaimed_bytes_total": atomic.LoadInt64(&s.orphans.bytes),
+	}
+	s.usageMetrics(m)
+	s.scanMetrics(m)
+	return m
+}
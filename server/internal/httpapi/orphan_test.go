@@ -0,0 +1,39 @@
+package httpapi
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweep_ReclaimsOrphans(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth, OrphanGrace: time.Hour}
+	h := newAuthMux(s)
+
+	_, sent := uploadAs(t, h, "u1", []byte("referenciado"))
+	_, lost := uploadAs(t, h, "u1", []byte("huérfano"))
+	sentID, _ := BlobID(sent)
+	lostID, _ := BlobID(lost)
+	s.MarkReferenced("u2", lostID) // otro usuario no cuenta
+	s.MarkReferenced("u1", sentID)
+
+	s.Sweep(time.Now()) // dentro del plazo no se borra nada
+	if code, _ := download(t, h, lost); code != http.StatusOK {
+		t.Fatalf("antes del plazo: status=%d", code)
+	}
+
+	s.Sweep(time.Now().Add(2 * time.Hour))
+	if _, err := os.Stat(filepath.Join(dir, lostID)); !os.IsNotExist(err) {
+		t.Fatalf("el huérfano sigue en disco: %v", err)
+	}
+	if code, _ := download(t, h, sent); code != http.StatusOK {
+		t.Fatalf("el referenciado se borró: status=%d", code)
+	}
+	m := s.MetricsSnapshot()
+	if m["orphans_found_total"] != 1 || m["orphans_reclaimed_total"] != 1 || m["orphans_reclaimed_bytes_total"] != int64(len("huérfano")) {
+		t.Fatalf("métricas=%v", m)
+	}
+}
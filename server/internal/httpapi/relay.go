@@ -0,0 +1,393 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/textproto"
+	"time"
+
+	"clip-sync/server/internal/sniff"
+)
+
+// Relay: el emisor reserva un id (POST /relay), manda el clip con
+// upload_url "/d/<id>" y sube el contenido con PUT /relay/<id>. Las
+// descargas que se unen dentro de la ventana de encuentro reciben los
+// bytes según llegan, sin pasar por disco. Si al cerrarse la ventana falta
+// algún destinatario, el contenido se guarda además como blob normal y los
+// rezagados lo descargan de ahí.
+
+const (
+	defaultRelayWait = 5 * time.Second
+	relayReserveTTL  = time.Minute // reservas que nunca recibieron el PUT
+)
+
+var (
+	errRelayGone    = &uploadError{http.StatusGone, "all relay receivers left"}
+	errRelayExpired = errors.New("relay reservation expired")
+)
+
+type relay struct {
+	owner   string
+	mime    string
+	digest  []byte // Content-Digest declarado al reservar; nil = ninguno
+	created time.Time
+
+	expect  int              // destinatarios anunciados; -1 = aún no se sabe
+	readers []*io.PipeWriter // descargas unidas, en orden de llegada
+	full    chan struct{}    // se cierra cuando se unieron todos los esperados
+	isFull  bool
+	sending bool          // ya hay un PUT esperando o enviando
+	started bool          // la ventana terminó: no se admiten más uniones
+	done    chan struct{} // se cierra al terminar el PUT (con o sin éxito)
+}
+
+// checkFull cierra full si ya se unieron todos los esperados (bajo relayMu).
+func (rl *relay) checkFull() {
+	if !rl.isFull && rl.expect >= 0 && len(rl.readers) >= rl.expect {
+		close(rl.full)
+		rl.isFull = true
+	}
+}
+
+type relayResp struct {
+	UploadURL string `json:"upload_url"`
+	RelayURL  string `json:"relay_url"`
+}
+
+type relayDoneResp struct {
+	uploadResp
+	Relayed int  `json:"relayed"` // descargas servidas en directo
+	Stored  bool `json:"stored"`  // se guardó para los rezagados
+}
+
+func (s *UploadServer) relayWait() time.Duration {
+	if s.RelayWait > 0 {
+		return s.RelayWait
+	}
+	return defaultRelayWait
+}
+
+func (s *UploadServer) getRelay(id string) *relay {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+	return s.relays[id]
+}
+
+// ReserveRelay atiende POST /relay: reserva un id para un envío en directo.
+// Content-Type y Content-Digest son los del contenido que llegará en el PUT.
+func (s *UploadServer) ReserveRelay(w http.ResponseWriter, r *http.Request) {
+	owner, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	// los bytes en directo llegarían antes que el veredicto del antivirus
+	if s.Scanner != nil {
+		writeBodyError(w, errRelayScanned)
+		return
+	}
+	// burn necesita un blob con destinatarios pendientes; no aplica aquí
+	if IsBurnRequest(r) {
+		http.Error(w, "burn clips cannot be relayed", http.StatusBadRequest)
+		return
+	}
+	ct := mediaType(r.Header.Get("Content-Type"))
+	if len(s.Allowed) > 0 && !isAllowedMime(s.Allowed, ct) {
+		writeBodyError(w, errUnsupportedMime)
+		return
+	}
+	want, err := wantDigest(textproto.MIMEHeader(r.Header))
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	id := randHex(16)
+	s.relayMu.Lock()
+	if s.relays == nil {
+		s.relays = make(map[string]*relay)
+	}
+	s.relays[id] = &relay{
+		owner: owner, mime: ct, digest: want, created: time.Now(),
+		expect: -1, full: make(chan struct{}), done: make(chan struct{}),
+	}
+	s.relayMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(relayResp{UploadURL: "/d/" + id, RelayURL: "/relay/" + id})
+}
+
+// ExpectRelay anuncia cuántos dispositivos recibieron el clip del relay id;
+// el PUT deja de esperar en cuanto se han unido todos. No hace nada si id
+// no es un relay pendiente de userID.
+func (s *UploadServer) ExpectRelay(userID, id string, devices []string) {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+	rl := s.relays[id]
+	if rl == nil || rl.owner != userID || rl.started {
+		return
+	}
+	rl.expect = len(devices)
+	rl.checkFull()
+}
+
+// Relaying indica si id es un relay todavía en curso.
+func (s *UploadServer) Relaying(id string) bool {
+	return s.getRelay(id) != nil
+}
+
+// Relay atiende PUT /relay/{id}: espera a los destinatarios y reparte el
+// cuerpo entre ellos; si falta alguno, también lo guarda en disco.
+func (s *UploadServer) Relay(w http.ResponseWriter, r *http.Request) {
+	owner, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id := r.PathValue("id")
+	s.relayMu.Lock()
+	rl := s.relays[id]
+	if rl == nil || rl.owner != owner || rl.sending {
+		s.relayMu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	rl.sending = true
+	s.relayMu.Unlock()
+
+	fan := &fanout{}
+	var err error
+	defer func() {
+		fan.close(err)
+		s.relayMu.Lock()
+		delete(s.relays, id)
+		s.relayMu.Unlock()
+		close(rl.done)
+	}()
+
+	body, ok := decodeBody(r)
+	if !ok {
+		err = &uploadError{http.StatusUnsupportedMediaType, "unsupported content encoding"}
+		writeBodyError(w, err)
+		return
+	}
+
+	t := time.NewTimer(s.relayWait())
+	defer t.Stop()
+	select {
+	case <-rl.full:
+	case <-t.C:
+	case <-r.Context().Done():
+		err = r.Context().Err()
+	}
+
+	// a partir de aquí las descargas nuevas esperan a done
+	s.relayMu.Lock()
+	rl.started = true
+	fan.ws = rl.readers
+	keep := len(rl.readers) == 0 || rl.expect < 0 || len(rl.readers) < rl.expect
+	announced := rl.expect >= 0
+	s.relayMu.Unlock()
+	if err != nil {
+		return // el emisor se fue durante la espera; fan.close corta las uniones
+	}
+	fan.optional = keep
+
+	// el envío en directo lo limita RelayMaxBytes; MaxBytes solo a la copia
+	var src io.Reader = body
+	if s.RelayMaxBytes > 0 {
+		src = http.MaxBytesReader(w, body, s.RelayMaxBytes)
+	}
+
+	// el tipo se comprueba antes de mandar el primer byte a nadie
+	br := bufio.NewReaderSize(src, sniff.HeadSize)
+	head, perr := br.Peek(sniff.HeadSize)
+	if perr != nil && perr != io.EOF {
+		err = perr
+		writeBodyError(w, err)
+		return
+	}
+	ct, _, err := s.checkType(rl.mime, head)
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+
+	// la copia para los rezagados se guarda en paralelo; si no cabe en
+	// MaxBytes o falla, se abandona y el envío en directo sigue
+	var disk *diskCopy
+	var storedResp chan storeResult
+	dst := io.Writer(fan)
+	if keep {
+		pr, pw := io.Pipe()
+		disk = &diskCopy{pw: pw, max: s.MaxBytes, fan: fan}
+		storedResp = make(chan storeResult, 1)
+		go func() {
+			// ExpectRelay ya se llamó si el clip se repartió: no es huérfano
+			resp, err := s.store(pr, storeOpts{
+				ID: id, Owner: owner, Mime: ct, Digest: rl.digest, Referenced: announced,
+			})
+			pr.Close() // si store paró antes de tiempo, diskCopy abandona la copia
+			storedResp <- storeResult{resp, err}
+		}()
+		dst = io.MultiWriter(disk, fan)
+	}
+	sum := sha256.New()
+	n, err := io.Copy(io.MultiWriter(dst, sum), br)
+	if err == nil {
+		err = checkDigest(rl.digest, sum.Sum(nil))
+	}
+	resp := uploadResp{UploadURL: "/d/" + id, Size: int(n), Mime: ct, SHA256: hex.EncodeToString(sum.Sum(nil))}
+	stored := false
+	if disk != nil {
+		if err != nil {
+			disk.pw.CloseWithError(err)
+		} else {
+			disk.pw.Close()
+		}
+		if sr := <-storedResp; sr.err == nil {
+			resp, stored = sr.resp, true
+		}
+	}
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	if stored {
+		s.stored(owner, resp, false)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(relayDoneResp{uploadResp: resp, Relayed: fan.served(), Stored: stored})
+}
+
+type storeResult struct {
+	resp uploadResp
+	err  error
+}
+
+// diskCopy pasa el contenido del relay a store mientras no supere max
+// bytes (0 = sin límite). Si se pasa o store falla, la copia se abandona
+// (store borra su temporal) sin cortar el envío en directo; desde entonces
+// el envío ya no es opcional para el fanout.
+type diskCopy struct {
+	pw      *io.PipeWriter
+	max, n  int64
+	dropped bool
+	fan     *fanout
+}
+
+func (d *diskCopy) Write(p []byte) (int, error) {
+	if d.dropped {
+		return len(p), nil
+	}
+	d.n += int64(len(p))
+	if d.max > 0 && d.n > d.max {
+		d.drop(&http.MaxBytesError{Limit: d.max})
+		return len(p), nil
+	}
+	if _, err := d.pw.Write(p); err != nil {
+		d.drop(err)
+	}
+	return len(p), nil
+}
+
+func (d *diskCopy) drop(err error) {
+	d.dropped = true
+	d.pw.CloseWithError(err)
+	d.fan.optional = false
+}
+
+// serveRelay sirve GET /d/{id} desde un relay en curso. Devuelve false si
+// no hay relay para id (o ya terminó) y hay que buscar el blob en disco.
+func (s *UploadServer) serveRelay(w http.ResponseWriter, r *http.Request, id string) bool {
+	s.relayMu.Lock()
+	rl := s.relays[id]
+	if rl == nil {
+		s.relayMu.Unlock()
+		return false
+	}
+	if rl.started {
+		s.relayMu.Unlock()
+		// llegó tarde: si el PUT guarda copia estará en disco al terminar
+		select {
+		case <-rl.done:
+			return false
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	pr, pw := io.Pipe()
+	rl.readers = append(rl.readers, pw)
+	rl.checkFull()
+	s.relayMu.Unlock()
+
+	// si el cliente se va, el PUT ve el error en su próxima escritura
+	stop := context.AfterFunc(r.Context(), func() { pr.CloseWithError(context.Canceled) })
+	defer stop()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", "inline; filename="+id)
+	w.Header().Set("Cache-Control", "no-store")
+	if rl.digest != nil {
+		w.Header().Set("Repr-Digest", reprDigest(hex.EncodeToString(rl.digest)))
+	}
+	if _, err := io.Copy(w, pr); err != nil {
+		pr.CloseWithError(err)
+		// cortar la respuesta: el cliente debe ver la descarga incompleta
+		panic(http.ErrAbortHandler)
+	}
+	return true
+}
+
+// sweepRelays descarta reservas que nunca recibieron el PUT.
+func (s *UploadServer) sweepRelays(now time.Time) {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+	for id, rl := range s.relays {
+		if rl.sending || now.Sub(rl.created) < relayReserveTTL {
+			continue
+		}
+		for _, pw := range rl.readers {
+			pw.CloseWithError(errRelayExpired)
+		}
+		delete(s.relays, id)
+		close(rl.done)
+	}
+}
+
+// fanout copia cada escritura a todas las descargas unidas. Una descarga
+// que falla se descarta sin afectar al resto; el ritmo lo marca la más
+// lenta. Si no es optional (no se guarda copia) y no queda ninguna, el
+// envío ya no tiene sentido y falla con errRelayGone.
+type fanout struct {
+	ws       []*io.PipeWriter
+	optional bool
+}
+
+func (f *fanout) Write(p []byte) (int, error) {
+	for i := 0; i < len(f.ws); {
+		if _, err := f.ws[i].Write(p); err != nil {
+			f.ws = append(f.ws[:i], f.ws[i+1:]...)
+			continue
+		}
+		i++
+	}
+	if len(f.ws) == 0 && !f.optional {
+		return 0, errRelayGone
+	}
+	return len(p), nil
+}
+
+func (f *fanout) served() int { return len(f.ws) }
+
+func (f *fanout) close(err error) {
+	for _, pw := range f.ws {
+		if err != nil {
+			pw.CloseWithError(err)
+		} else {
+			pw.Close()
+		}
+	}
+}
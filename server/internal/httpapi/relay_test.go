@@ -0,0 +1,165 @@
+package httpapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func newRelayServer(t *testing.T, s *UploadServer) *httptest.Server {
+	t.Helper()
+	mux := newAuthMux(s)
+	mux.HandleFunc("POST /relay", s.ReserveRelay)
+	mux.HandleFunc("PUT /relay/{id}", s.Relay)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func authDo(t *testing.T, method, url string, body io.Reader) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, body)
+	req.Header.Set("Authorization", "Bearer u1")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func reserveRelay(t *testing.T, base string) (string, string) {
+	t.Helper()
+	resp := authDo(t, http.MethodPost, base+"/relay", nil)
+	defer resp.Body.Close()
+	var rr relayResp
+	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("reserve status=%d err=%v", resp.StatusCode, err)
+	}
+	id, _ := BlobID(rr.UploadURL)
+	return id, rr.RelayURL
+}
+
+// fetch descarga en segundo plano; el resultado llega por el canal.
+func fetch(url string) <-chan []byte {
+	out := make(chan []byte, 1)
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer u1")
+	go func() {
+		var b []byte
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			b, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil || resp.StatusCode != http.StatusOK {
+				b = nil
+			}
+		}
+		out <- b
+	}()
+	return out
+}
+
+func putRelay(t *testing.T, url string, body []byte) relayDoneResp {
+	t.Helper()
+	resp := authDo(t, http.MethodPut, url, bytes.NewReader(body))
+	defer resp.Body.Close()
+	var done relayDoneResp
+	if err := json.NewDecoder(resp.Body).Decode(&done); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("put status=%d err=%v", resp.StatusCode, err)
+	}
+	return done
+}
+
+func TestRelay_StreamsWithoutDisk(t *testing.T) {
+	dir := t.TempDir()
+	// MaxBytes no aplica al relay en directo
+	s := &UploadServer{Dir: dir, MaxBytes: 1024, Auth: mvpAuth, RelayWait: 5 * time.Second}
+	srv := newRelayServer(t, s)
+
+	id, relayURL := reserveRelay(t, srv.URL)
+	s.ExpectRelay("u1", id, []string{"B", "C"})
+	b, c := fetch(srv.URL+"/d/"+id+"?device=B"), fetch(srv.URL+"/d/"+id+"?device=C")
+
+	body := make([]byte, 2<<20)
+	_, _ = rand.Read(body)
+	done := putRelay(t, srv.URL+relayURL, body)
+	if done.Stored || done.Relayed != 2 || done.Size != len(body) {
+		t.Fatalf("resp=%+v", done)
+	}
+	for _, ch := range []<-chan []byte{b, c} {
+		if got := <-ch; !bytes.Equal(got, body) {
+			t.Fatalf("receptor recibió %d bytes, want %d", len(got), len(body))
+		}
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("el relay en directo no debe tocar disco: %d archivos", len(ents))
+	}
+}
+
+func TestRelay_FallsBackToStorage(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth, RelayWait: 100 * time.Millisecond}
+	srv := newRelayServer(t, s)
+
+	id, relayURL := reserveRelay(t, srv.URL)
+	s.ExpectRelay("u1", id, []string{"B", "C"}) // C nunca se une
+	b := fetch(srv.URL + "/d/" + id + "?device=B")
+	for !s.joined(id) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	body := bytes.Repeat([]byte("relay "), 10_000)
+	done := putRelay(t, srv.URL+relayURL, body)
+	if !done.Stored || done.Relayed != 1 {
+		t.Fatalf("resp=%+v", done)
+	}
+	if got := <-b; !bytes.Equal(got, body) {
+		t.Fatal("el receptor en directo no recibió el contenido")
+	}
+	// el rezagado lo descarga del disco
+	if got := <-fetch(srv.URL + "/d/" + id + "?device=C"); !bytes.Equal(got, body) {
+		t.Fatal("el rezagado no recibió la copia guardada")
+	}
+}
+
+// joined indica si ya hay alguna descarga esperando en el relay id.
+func (s *UploadServer) joined(id string) bool {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+	rl := s.relays[id]
+	return rl != nil && len(rl.readers) > 0
+}
+
+func TestRelay_CopyOverMaxBytesKeepsStreaming(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1024, Auth: mvpAuth, RelayWait: 100 * time.Millisecond}
+	srv := newRelayServer(t, s)
+
+	id, relayURL := reserveRelay(t, srv.URL)
+	s.ExpectRelay("u1", id, []string{"B", "C"}) // C nunca se une
+	b := fetch(srv.URL + "/d/" + id + "?device=B")
+	for !s.joined(id) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// la copia de respaldo no cabe en MaxBytes: se descarta, B lo recibe igual
+	body := bytes.Repeat([]byte("relay "), 10_000)
+	done := putRelay(t, srv.URL+relayURL, body)
+	if done.Stored || done.Relayed != 1 || done.Size != len(body) {
+		t.Fatalf("resp=%+v", done)
+	}
+	if got := <-b; !bytes.Equal(got, body) {
+		t.Fatalf("el receptor en directo recibió %d bytes, want %d", len(got), len(body))
+	}
+	if got := <-fetch(srv.URL + "/d/" + id + "?device=C"); got != nil {
+		t.Fatal("quedó una copia parcial para el rezagado")
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("quedaron %d archivos de la copia descartada", len(ents))
+	}
+}
@@ -0,0 +1,100 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"clip-sync/server/internal/scan"
+)
+
+// fakeScanner marca como infectado lo que contenga "EICAR" y recuerda si
+// lo que vio estaba en claro.
+type fakeScanner struct {
+	down bool
+	seen [][]byte
+}
+
+func (f *fakeScanner) Scan(_ context.Context, path string) (scan.Result, error) {
+	if f.down {
+		return scan.Result{}, errors.New("connection refused")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return scan.Result{}, err
+	}
+	f.seen = append(f.seen, b)
+	if bytes.Contains(b, []byte("EICAR")) {
+		return scan.Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return scan.Result{}, nil
+}
+
+func TestScan_RejectsFlagged(t *testing.T) {
+	dir := t.TempDir()
+	sc := &fakeScanner{}
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth, Scanner: sc, Compress: true}
+	h := newAuthMux(s)
+
+	code, url := uploadAs(t, h, "u1", []byte("texto limpio"))
+	id, _ := BlobID(url)
+	if code != http.StatusOK || !s.Scanned(id) {
+		t.Fatalf("limpio: status=%d scanned=%v", code, s.Scanned(id))
+	}
+	// se guarda comprimido, pero el antivirus ve el contenido original
+	if len(sc.seen) != 1 || string(sc.seen[0]) != "texto limpio" {
+		t.Fatalf("el antivirus vio %q", sc.seen)
+	}
+
+	if code, _ := uploadAs(t, h, "u1", []byte("X5O EICAR")); code != http.StatusUnprocessableEntity {
+		t.Fatalf("infectado: status=%d, want 422", code)
+	}
+	sc.down = true
+	if code, _ := uploadAs(t, h, "u1", []byte("sin veredicto")); code != http.StatusServiceUnavailable {
+		t.Fatalf("antivirus caído: status=%d, want 503", code)
+	}
+	// solo quedan el blob limpio y su sidecar
+	if ents, _ := os.ReadDir(dir); len(ents) != 2 {
+		t.Fatalf("quedaron %d archivos, want 2", len(ents))
+	}
+	m := s.MetricsSnapshot()
+	if m["scans_total"] != 3 || m["scans_flagged_total"] != 1 || m["scans_failed_total"] != 1 {
+		t.Fatalf("métricas=%v", m)
+	}
+
+	// sin antivirus todo se puede difundir; con él, un blob sin veredicto no
+	if !(&UploadServer{Dir: dir}).Scanned("0123") || s.Scanned("0123") {
+		t.Fatal("Scanned de un blob sin veredicto")
+	}
+}
+
+func TestScan_Quarantine(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth, Scanner: &fakeScanner{}, ScanAction: scan.Quarantine}
+	h := newAuthMux(s)
+
+	if code, _ := uploadAs(t, h, "u1", []byte("X5O EICAR")); code != http.StatusUnprocessableEntity {
+		t.Fatalf("status=%d, want 422", code)
+	}
+	ents, _ := os.ReadDir(filepath.Join(dir, quarantineDir))
+	if len(ents) != 2 {
+		t.Fatalf("cuarentena con %d archivos, want blob + sidecar", len(ents))
+	}
+	if total, _ := s.UsageSnapshot(); total.Blobs != 0 {
+		t.Fatalf("la cuarentena no cuenta como uso: %+v", total)
+	}
+}
+
+func TestScan_DisablesRelay(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), Auth: mvpAuth, Scanner: &fakeScanner{}}
+	srv := newRelayServer(t, s)
+	resp := authDo(t, http.MethodPost, srv.URL+"/relay", nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("status=%d, want 409", resp.StatusCode)
+	}
+}
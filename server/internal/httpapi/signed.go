@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URLSigner emite y valida URLs de descarga firmadas con HMAC:
+//
+//	/d/<id>?exp=<unix>&dev=<device>[&once=1]&sig=hex(hmac_sha256(secret, id|exp|dev|once))
+//
+// Una URL firmada es credencial suficiente para GET /d/{id}; deja de
+// funcionar al expirar y, con once=1, tras la primera descarga.
+type URLSigner struct {
+	Secret    []byte
+	TTL       time.Duration // 0 = 10 minutos
+	SingleUse bool
+
+	mu   sync.Mutex
+	used map[string]int64 // sig -> exp, para single-use
+}
+
+const defaultURLTTL = 10 * time.Minute
+
+// BlobID extrae el id de un upload_url local ("/d/<id>", con o sin query).
+func BlobID(uploadURL string) (string, bool) {
+	id, sub, ok := splitBlobPath(uploadURL)
+	return id, ok && sub == ""
+}
+
+// splitBlobPath reconoce "/d/<id>" y "/d/<id>/thumb" (con o sin query).
+func splitBlobPath(u string) (id, sub string, ok bool) {
+	if i := strings.IndexByte(u, '?'); i >= 0 {
+		u = u[:i]
+	}
+	rest, ok := strings.CutPrefix(u, "/d/")
+	if !ok {
+		return "", "", false
+	}
+	id, sub, _ = strings.Cut(rest, "/")
+	if !idRe.MatchString(id) || (sub != "" && sub != "thumb") {
+		return "", "", false
+	}
+	return id, sub, true
+}
+
+// SignURL firma uploadURL (blob o su miniatura) para el dispositivo dev.
+// URLs que no apuntan a un blob local se devuelven tal cual (exp=0).
+func (s *URLSigner) SignURL(uploadURL, dev string) (string, int64) {
+	id, sub, ok := splitBlobPath(uploadURL)
+	if !ok {
+		return uploadURL, 0
+	}
+	// la firma cubre el recurso concreto: la de la miniatura no sirve para el blob
+	subject := id
+	if sub != "" {
+		subject += "/" + sub
+	}
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = defaultURLTTL
+	}
+	exp := time.Now().Add(ttl).Unix()
+	once := ""
+	if s.SingleUse {
+		once = "1"
+	}
+	q := url.Values{}
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	if dev != "" {
+		q.Set("dev", dev)
+	}
+	if once != "" {
+		q.Set("once", once)
+	}
+	q.Set("sig", s.mac(subject, exp, dev, once))
+	return "/d/" + subject + "?" + q.Encode(), exp
+}
+
+func (s *URLSigner) mac(subject string, exp int64, dev, once string) string {
+	m := hmac.New(sha256.New, s.Secret)
+	m.Write([]byte(subject + "|" + strconv.FormatInt(exp, 10) + "|" + dev + "|" + once))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// verify comprueba firma, expiración y single-use para subject
+// ("<id>" o "<id>/thumb").
+func (s *URLSigner) verify(subject string, q url.Values) bool {
+	sig := q.Get("sig")
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if sig == "" || err != nil {
+		return false
+	}
+	now := time.Now().Unix()
+	if now > exp {
+		return false
+	}
+	once := q.Get("once")
+	want := s.mac(subject, exp, q.Get("dev"), once)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return false
+	}
+	if once == "" {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.used == nil {
+		s.used = make(map[string]int64)
+	}
+	if _, dup := s.used[sig]; dup {
+		return false
+	}
+	// purga perezosa de firmas ya expiradas
+	for k, e := range s.used {
+		if now > e {
+			delete(s.used, k)
+		}
+	}
+	s.used[sig] = exp
+	return true
+}
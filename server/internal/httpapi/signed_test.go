@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedURL_Download(t *testing.T) {
+	signer := &URLSigner{Secret: []byte("k")}
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth, Signer: signer}
+	h := newAuthMux(s)
+
+	_, url := uploadAs(t, h, "u1", []byte("hola"))
+	signed, exp := signer.SignURL(url, "B")
+	if exp <= time.Now().Unix() || !strings.Contains(signed, "sig=") {
+		t.Fatalf("firma inválida: %q exp=%d", signed, exp)
+	}
+
+	get := func(u string) int {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, u, nil))
+		return rr.Code
+	}
+	// sin bearer: la firma basta
+	if code := get(signed); code != http.StatusOK {
+		t.Fatalf("signed status=%d", code)
+	}
+	// firma alterada
+	if code := get(strings.Replace(signed, "dev=B", "dev=C", 1)); code != http.StatusForbidden {
+		t.Fatalf("tampered status=%d, want 403", code)
+	}
+	// expirada
+	id, _ := BlobID(url)
+	past := time.Now().Add(-time.Minute).Unix()
+	old := fmt.Sprintf("%s?exp=%d&dev=B&sig=%s", url, past, signer.mac(id, past, "B", ""))
+	if code := get(old); code != http.StatusForbidden {
+		t.Fatalf("expired status=%d, want 403", code)
+	}
+}
+
+func TestSignedURL_SingleUse(t *testing.T) {
+	signer := &URLSigner{Secret: []byte("k"), SingleUse: true}
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth, Signer: signer}
+	h := newAuthMux(s)
+
+	_, url := uploadAs(t, h, "u1", []byte("hola"))
+	signed, _ := signer.SignURL(url, "B")
+	for i, want := range []int{http.StatusOK, http.StatusForbidden} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, signed, nil))
+		if rr.Code != want {
+			t.Fatalf("intento %d: status=%d, want %d", i+1, rr.Code, want)
+		}
+	}
+}
+
+func TestBlobID(t *testing.T) {
+	id := strings.Repeat("a", 32)
+	if got, ok := BlobID("/d/" + id + "?exp=1"); !ok || got != id {
+		t.Fatalf("BlobID=%q ok=%v", got, ok)
+	}
+	if _, ok := BlobID("https://example.com/x"); ok {
+		t.Fatal("URL externa no es un blob local")
+	}
+}
@@ -0,0 +1,69 @@
+package httpapi
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Texto de blobs: la política de contenido también revisa los clips de
+// texto subidos como blob (hasta un tamaño) y puede reescribirlos.
+
+// ReadText devuelve el contenido del blob guardado id si es texto UTF-8 de
+// max bytes como mucho. Un relay en curso todavía no está en disco.
+func (s *UploadServer) ReadText(id string, max int64) (string, bool) {
+	if !idRe.MatchString(id) {
+		return "", false
+	}
+	meta, err := s.loadMeta(id)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", false
+		}
+		meta = nil // sin sidecar: guardado tal cual
+	}
+	if meta != nil && (!strings.HasPrefix(meta.Mime, "text/") || meta.Size > max) {
+		return "", false
+	}
+	rc, err := s.openBlob(id, meta)
+	if err != nil {
+		return "", false
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, max+1))
+	if err != nil || int64(len(b)) > max || !utf8.Valid(b) {
+		return "", false
+	}
+	return string(b), true
+}
+
+// ReplaceText sustituye el contenido del blob id por text sin cambiar su
+// URL, dueño ni opciones. Un blob sin sidecar queda como text/plain.
+func (s *UploadServer) ReplaceText(id, text string) (Blob, error) {
+	if !idRe.MatchString(id) {
+		return Blob{}, os.ErrNotExist
+	}
+	o := storeOpts{ID: id, Mime: "text/plain", Referenced: true}
+	meta, err := s.loadMeta(id)
+	switch {
+	case err == nil:
+		o.Owner, o.Mime, o.Filename, o.Burn, o.Referenced = meta.Owner, meta.Mime, meta.Filename, meta.Burn, !meta.Orphan
+	case !os.IsNotExist(err):
+		return Blob{}, err
+	}
+	old, err := os.Stat(filepath.Join(s.Dir, id))
+	if err != nil {
+		return Blob{}, err
+	}
+	resp, err := s.store(strings.NewReader(text), o)
+	if err != nil {
+		return Blob{}, err
+	}
+	// store contó el blob como nuevo: el anterior ya no ocupa
+	s.usage.mu.Lock()
+	s.usage.add(o.Owner, -1, -old.Size())
+	s.usage.mu.Unlock()
+	return Blob{URL: resp.UploadURL, Size: resp.Size, Mime: resp.Mime, SHA256: resp.SHA256}, nil
+}
@@ -0,0 +1,214 @@
+package httpapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Miniaturas: GET /d/{id}/thumb devuelve un PNG de como mucho thumbMax px
+// de lado para blobs PNG/JPEG/GIF. Se genera en la primera petición y se
+// cachea como <id>.thumb (cifrada con la DEK del blob si aplica).
+
+const (
+	thumbMax = 256
+	// evita bombas de descompresión: 16 MP son ~64 MB de RGBA por imagen
+	thumbMaxPixels = 16_000_000
+	// miniaturas generándose a la vez; el resto espera turno
+	thumbConcurrent = 2
+)
+
+var thumbRenders = make(chan struct{}, thumbConcurrent)
+
+var errNoThumb = errors.New("no thumbnail for this blob")
+
+// IsThumbMime indica si hay miniatura para ese tipo.
+func IsThumbMime(mime string) bool {
+	switch mime {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+func (s *UploadServer) thumbPath(id string) string {
+	return filepath.Join(s.Dir, id+".thumb")
+}
+
+func (s *UploadServer) Thumbnail(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !idRe.MatchString(id) {
+		http.NotFound(w, r)
+		return
+	}
+	if !s.authorizeDownload(w, r, id, id+"/thumb") {
+		return
+	}
+	meta, _ := s.loadMeta(id)
+	// los burn no tienen miniatura: sería una copia que sobrevive a la lectura
+	if meta != nil && (meta.Burn || !IsThumbMime(meta.Mime)) {
+		http.NotFound(w, r)
+		return
+	}
+	b, err := s.thumbnail(r.Context(), id, meta)
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return
+		}
+		if os.IsNotExist(err) || errors.Is(err, errNoThumb) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "thumbnail error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	_, _ = w.Write(b)
+}
+
+// thumbnail devuelve la miniatura cacheada o la genera, esperando turno
+// entre las que se generan a la vez mientras ctx siga vivo.
+func (s *UploadServer) thumbnail(ctx context.Context, id string, meta *blobMeta) ([]byte, error) {
+	if b, err := s.readThumb(id, meta); err == nil {
+		return b, nil
+	}
+	select {
+	case thumbRenders <- struct{}{}:
+		defer func() { <-thumbRenders }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	// otra petición pudo generarla mientras esperábamos
+	if b, err := s.readThumb(id, meta); err == nil {
+		return b, nil
+	}
+
+	// primero solo la cabecera: dimensiones antes de reservar memoria
+	src, err := s.openBlob(id, meta)
+	if err != nil {
+		return nil, err
+	}
+	cfg, _, err := image.DecodeConfig(bufio.NewReader(src))
+	src.Close()
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > thumbMaxPixels {
+		return nil, errNoThumb
+	}
+
+	src, err = s.openBlob(id, meta)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bufio.NewReader(src))
+	src.Close()
+	if err != nil {
+		return nil, errNoThumb
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleToFit(img, thumbMax)); err != nil {
+		return nil, err
+	}
+	_ = s.writeThumb(id, meta, buf.Bytes()) // la caché es best-effort
+	return buf.Bytes(), nil
+}
+
+func (s *UploadServer) readThumb(id string, meta *blobMeta) ([]byte, error) {
+	f, err := os.Open(s.thumbPath(id))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rd io.Reader = f
+	if meta != nil && meta.Enc != nil {
+		if s.Keys == nil {
+			return nil, errors.New("no keyring")
+		}
+		dek, err := s.Keys.unwrap(id, meta.Enc)
+		if err != nil {
+			return nil, err
+		}
+		if rd, err = newDecryptReader(f, dek, id+"/thumb"); err != nil {
+			return nil, err
+		}
+	}
+	return io.ReadAll(rd)
+}
+
+func (s *UploadServer) writeThumb(id string, meta *blobMeta, b []byte) error {
+	tmp, err := os.CreateTemp(s.Dir, ".thumb-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+	var wr io.Writer = tmp
+	var enc *encryptWriter
+	if meta != nil && meta.Enc != nil && s.Keys != nil {
+		dek, err := s.Keys.unwrap(id, meta.Enc)
+		if err == nil {
+			enc, err = newEncryptWriter(tmp, dek, id+"/thumb")
+		}
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		wr = enc
+	}
+	_, err = wr.Write(b)
+	if err == nil && enc != nil {
+		err = enc.Close()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpName, s.thumbPath(id))
+}
+
+// scaleToFit reduce img para que quepa en limit×limit promediando por
+// áreas. Imágenes ya pequeñas se copian tal cual (a NRGBA).
+func scaleToFit(img image.Image, limit int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > limit || h > limit {
+		if w >= h {
+			tw, th = limit, h*limit/w
+		} else {
+			tw, th = w*limit/h, limit
+		}
+		tw, th = max(tw, 1), max(th, 1)
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		y1 = max(y1, y0+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			x1 = max(x1, x0+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
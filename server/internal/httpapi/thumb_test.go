@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func pngBytes(w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+func TestThumbnail_GeneratedAndCached(t *testing.T) {
+	signer := &URLSigner{Secret: []byte("k")}
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 8 << 20, Auth: mvpAuth, Signer: signer}
+	mux := newAuthMux(s)
+	mux.HandleFunc("GET /d/{id}/thumb", s.Thumbnail)
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(pngBytes(1000, 500)))
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("Authorization", "Bearer u1")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var up uploadResp
+	_ = json.NewDecoder(rr.Body).Decode(&up)
+	id, _ := BlobID(up.UploadURL)
+	if up.ThumbURL != "/d/"+id+"/thumb" {
+		t.Fatalf("thumb_url=%q", up.ThumbURL)
+	}
+
+	code, body := download(t, mux, "/d/"+id+"/thumb")
+	if code != http.StatusOK {
+		t.Fatalf("thumb status=%d", code)
+	}
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 256 || b.Dy() != 128 {
+		t.Fatalf("tamaño miniatura=%v, want 256x128", b.Size())
+	}
+	if _, err := os.Stat(s.thumbPath(id)); err != nil {
+		t.Fatalf("la miniatura debe quedar cacheada: %v", err)
+	}
+
+	// la firma del blob no vale para la miniatura, y viceversa
+	blobSig, _ := signer.SignURL("/d/"+id, "B")
+	thumbSig, _ := signer.SignURL("/d/"+id+"/thumb", "B")
+	for _, c := range []struct {
+		url  string
+		want int
+	}{
+		{thumbSig, http.StatusOK},
+		{strings.Replace(blobSig, "/d/"+id, "/d/"+id+"/thumb", 1), http.StatusForbidden},
+	} {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, c.url, nil))
+		if rr.Code != c.want {
+			t.Fatalf("%s: status=%d, want %d", c.url, rr.Code, c.want)
+		}
+	}
+}
+
+func TestThumbnail_NotForNonImages(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth}
+	mux := newAuthMux(s)
+	mux.HandleFunc("GET /d/{id}/thumb", s.Thumbnail)
+	_, url := uploadAs(t, mux, "u1", []byte("texto"))
+	if code, _ := download(t, mux, url+"/thumb"); code != http.StatusNotFound {
+		t.Fatalf("status=%d, want 404", code)
+	}
+}
+
+// Un PNG que declara más píxeles de los permitidos no se decodifica: basta
+// la cabecera para rechazarlo.
+func TestThumbnail_TooManyPixels(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth}
+	mux := newAuthMux(s)
+	mux.HandleFunc("GET /d/{id}/thumb", s.Thumbnail)
+
+	// IHDR de 5000x4000 (20 MP) con su CRC recalculado
+	b := pngBytes(2, 2)
+	binary.BigEndian.PutUint32(b[16:], 5000)
+	binary.BigEndian.PutUint32(b[20:], 4000)
+	binary.BigEndian.PutUint32(b[29:], crc32.ChecksumIEEE(b[12:29]))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(b))
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("Authorization", "Bearer u1")
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	var up uploadResp
+	_ = json.NewDecoder(rr.Body).Decode(&up)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("upload status=%d", rr.Code)
+	}
+	if code, _ := download(t, mux, up.UploadURL+"/thumb"); code != http.StatusNotFound {
+		t.Fatalf("status=%d, want 404", code)
+	}
+}
@@ -1,64 +1,278 @@
 package httpapi
 
 import (
+	"bufio"
+	"compress/gzip"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
 	"mime"
 	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"clip-sync/server/internal/scan"
+	"clip-sync/server/internal/sniff"
+	"clip-sync/server/pkg/types"
 )
 
 type UploadServer struct {
 	Dir      string
 	MaxBytes int64
 	Allowed  []string // whitelist de mimes permitidos; vacío = desactivado
+
+	// Auth valida el token del request (mismas credenciales que /ws).
+	// Si es nil, upload y download quedan abiertos como en el MVP.
+	Auth func(token string) (string, bool)
+
+	// Signer valida URLs firmadas (?exp=&sig=) en Download; nil = desactivado.
+	Signer *URLSigner
+
+	// BurnTTL: vida máxima de un blob burn-after-read (0 = 10 minutos).
+	BurnTTL time.Duration
+
+	// Keys activa el cifrado en reposo de blobs nuevos; nil = en claro.
+	Keys *Keyring
+
+	// Compress guarda con gzip los blobs de tipos compresibles.
+	Compress bool
+
+	// Sniff decide qué hacer si los primeros bytes no cuadran con el
+	// Content-Type declarado (zero value = sniff.Off).
+	Sniff sniff.Policy
+
+	// RelayWait: ventana para que los destinatarios se unan a un relay
+	// (0 = 5 segundos). RelayMaxBytes limita los envíos que no tocan disco
+	// (0 = sin límite); si se guarda copia rige MaxBytes.
+	RelayWait     time.Duration
+	RelayMaxBytes int64
+
+	// OrphanGrace: plazo para que un clip referencie un blob nuevo antes
+	// de que el janitor lo borre (0 = desactivado).
+	OrphanGrace time.Duration
+
+	// Scanner analiza cada upload antes de publicarlo; nil = sin análisis.
+	// ScanAction decide si un blob detectado se borra o va a cuarentena, y
+	// ScanTimeout limita cada análisis (0 = 1 minuto).
+	Scanner     scan.Scanner
+	ScanAction  scan.Action
+	ScanTimeout time.Duration
+
+	// OnStored recibe cada blob nuevo (POST /upload, /api/clips, relay con
+	// copia) una vez confirmado: en un multipart, solo si se guardaron
+	// todas las partes. No debe bloquear.
+	OnStored func(owner string, b Blob, burn bool)
+
+	metaMu  sync.Mutex // serializa read-modify-write de metadatos
+	orphans orphanMetrics
+	usage   usageTable
+	scans   scanMetrics
+
+	relayMu sync.Mutex
+	relays  map[string]*relay // id -> relay reservado o en curso
 }
 
 type uploadResp struct {
 	UploadURL string `json:"upload_url"`
 	Size      int    `json:"size"`
+	ThumbURL  string `json:"thumb_url,omitempty"`
+	Mime      string `json:"mime,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	SHA256    string `json:"sha256"` // hex del contenido guardado
+}
+
+// multipartResp: una entrada por parte con archivo, en el orden del form.
+type multipartResp struct {
+	Files []uploadResp `json:"files"`
+}
+
+// uploadError es un rechazo del contenido con su código HTTP.
+type uploadError struct {
+	code int
+	msg  string
 }
 
+func (e *uploadError) Error() string { return e.msg }
+
+var (
+	errUnsupportedMime = &uploadError{http.StatusUnsupportedMediaType, "unsupported media type"}
+	errMimeMismatch    = &uploadError{http.StatusUnsupportedMediaType, "content does not match declared type"}
+	errBadMultipart    = &uploadError{http.StatusBadRequest, "invalid multipart body"}
+	errStorage         = &uploadError{http.StatusInternalServerError, "storage error"}
+)
+
+const maxFilename = 255
+
 var idRe = regexp.MustCompile(`^[a-f0-9]{32}$`)
 
 func (s *UploadServer) Upload(w http.ResponseWriter, r *http.Request) {
+	owner, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, ok := decodeBody(r)
+	if !ok {
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+	// el límite aplica a los bytes decodificados (evita bombas gzip)
+	r.Body = body
 	if s.MaxBytes > 0 {
-		r.Body = http.MaxBytesReader(w, r.Body, s.MaxBytes)
+		r.Body = http.MaxBytesReader(w, body, s.MaxBytes)
 	}
 	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
 		http.Error(w, "storage error", http.StatusInternalServerError)
 		return
 	}
 
-	// validar Content-Type contra whitelist si está configurada
-	if len(s.Allowed) > 0 {
-		ct := r.Header.Get("Content-Type")
-		if ct == "" {
-			ct = "application/octet-stream"
+	ct := mediaType(r.Header.Get("Content-Type"))
+	if ct == "multipart/form-data" {
+		s.uploadMultipart(w, r, owner)
+		return
+	}
+	want, err := wantDigest(textproto.MIMEHeader(r.Header))
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	burn := IsBurnRequest(r)
+	resp, err := s.store(r.Body, storeOpts{Owner: owner, Mime: ct, Burn: burn, Digest: want})
+	if err != nil {
+		writeBodyError(w, err)
+		return
+	}
+	s.stored(owner, resp, burn)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// uploadMultipart guarda cada parte con filename como un blob propio,
+// leyendo las partes en streaming. Si una falla se borran las anteriores:
+// o se guardan todas o ninguna.
+func (s *UploadServer) uploadMultipart(w http.ResponseWriter, r *http.Request, owner string) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, errBadMultipart.msg, errBadMultipart.code)
+		return
+	}
+	burn := IsBurnRequest(r)
+	var files []uploadResp
+	fail := func(err error) {
+		for _, f := range files {
+			id, _ := BlobID(f.UploadURL)
+			s.removeBlob(id)
 		}
-		if media, _, err := mime.ParseMediaType(ct); err == nil {
-			ct = media
+		writeBodyError(w, err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
 		}
-		if !isAllowedMime(s.Allowed, ct) {
-			http.Error(w, "unsupported media type", http.StatusUnsupportedMediaType)
+		if err != nil {
+			fail(multipartErr(err))
 			return
 		}
+		name := part.FileName()
+		if name == "" { // campos normales del formulario
+			part.Close()
+			continue
+		}
+		want, err := wantDigest(part.Header)
+		var resp uploadResp
+		if err == nil {
+			resp, err = s.store(part, storeOpts{
+				Owner:    owner,
+				Mime:     mediaType(part.Header.Get("Content-Type")),
+				Filename: cleanFilename(name),
+				Burn:     burn,
+				Digest:   want,
+			})
+		}
+		part.Close()
+		if err != nil {
+			fail(multipartErr(err))
+			return
+		}
+		files = append(files, resp)
+	}
+	if len(files) == 0 {
+		http.Error(w, "no file parts", http.StatusBadRequest)
+		return
+	}
+	for _, f := range files {
+		s.stored(owner, f, burn)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(multipartResp{Files: files})
+}
+
+// storeOpts describe un blob nuevo para store.
+type storeOpts struct {
+	ID       string // "" = id aleatorio
+	Owner    string
+	Mime     string
+	Filename string
+	Burn     bool
+	Digest   []byte // SHA-256 esperado; nil = no se comprueba
+
+	Referenced bool // ya hay un clip que lo apunta (relay anunciado)
+}
+
+// checkType aplica whitelist y sniffing a ct con los primeros bytes del
+// contenido; devuelve el tipo final y el detectado.
+func (s *UploadServer) checkType(ct string, head []byte) (string, string, error) {
+	// validar Content-Type contra whitelist si está configurada
+	if len(s.Allowed) > 0 && !isAllowedMime(s.Allowed, ct) {
+		return "", "", errUnsupportedMime
+	}
+	// tipo real por magic bytes; el whitelist se vuelve a aplicar si se corrige
+	detected := sniff.Detect(head)
+	if s.Sniff != sniff.Off && !sniff.Compatible(ct, detected) {
+		if s.Sniff == sniff.Reject {
+			return "", "", errMimeMismatch
+		}
+		ct = detected
+		if len(s.Allowed) > 0 && !isAllowedMime(s.Allowed, ct) {
+			return "", "", errUnsupportedMime
+		}
+	}
+	return ct, detected, nil
+}
+
+// store guarda src como blob nuevo (tmp + rename) y devuelve la respuesta
+// para el cliente. Los errores son *uploadError o del cuerpo.
+func (s *UploadServer) store(src io.Reader, o storeOpts) (uploadResp, error) {
+	br := bufio.NewReaderSize(src, sniff.HeadSize)
+	head, err := br.Peek(sniff.HeadSize)
+	if err != nil && err != io.EOF {
+		return uploadResp{}, err
+	}
+	ct, detected, err := s.checkType(o.Mime, head)
+	if err != nil {
+		return uploadResp{}, err
 	}
 
-	id := randHex(16)
+	id := o.ID
+	if id == "" {
+		id = randHex(16)
+	}
 	final := filepath.Join(s.Dir, id)
 
 	// escribir a tmp y luego rename
 	tmp, err := os.CreateTemp(s.Dir, ".upload-*")
 	if err != nil {
-		http.Error(w, "storage error", http.StatusInternalServerError)
-		return
+		return uploadResp{}, errStorage
 	}
 	tmpName := tmp.Name()
 	defer func() {
@@ -66,47 +280,166 @@ func (s *UploadServer) Upload(w http.ResponseWriter, r *http.Request) {
 		_ = os.Remove(tmpName) // no pasa nada si ya se renombró
 	}()
 
-	n, err := io.Copy(tmp, r.Body)
-	if err != nil {
-		var maxErr *http.MaxBytesError
-		if errors.As(err, &maxErr) {
-			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
-			return
+	meta := &blobMeta{Owner: o.Owner, Mime: ct, Detected: detected, Filename: o.Filename, Created: time.Now().UTC()}
+	meta.Orphan = s.OrphanGrace > 0 && !o.Referenced
+	var dst io.Writer = tmp
+	var enc *encryptWriter
+	if s.Keys != nil {
+		dek, info, err := s.Keys.wrap(id)
+		if err == nil {
+			enc, err = newEncryptWriter(tmp, dek, id)
 		}
-		http.Error(w, "write error", http.StatusInternalServerError)
-		return
+		if err != nil {
+			return uploadResp{}, errStorage
+		}
+		meta.Enc = info
+		dst = enc
+	}
+	var zw *gzip.Writer
+	if s.Compress && types.Compressible(ct) {
+		zw = gzip.NewWriter(dst)
+		meta.Encoding = "gzip"
+		dst = zw
 	}
 
+	// el antivirus necesita el contenido en claro: si lo guardado va
+	// cifrado o comprimido se escribe además una copia temporal sin tocar
+	sum := sha256.New()
+	var tee io.Writer = sum
+	plainName := tmpName
+	if s.Scanner != nil && (enc != nil || zw != nil) {
+		plain, err := os.CreateTemp(s.Dir, ".scan-*")
+		if err != nil {
+			return uploadResp{}, errStorage
+		}
+		plainName = plain.Name()
+		defer func() {
+			plain.Close()
+			_ = os.Remove(plainName)
+		}()
+		tee = io.MultiWriter(tee, plain)
+	}
+	n, err := io.Copy(dst, io.TeeReader(br, tee))
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil && enc != nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		return uploadResp{}, err
+	}
+	if err := checkDigest(o.Digest, sum.Sum(nil)); err != nil {
+		return uploadResp{}, err
+	}
+	meta.SHA256 = hex.EncodeToString(sum.Sum(nil))
+
 	// fsync para asegurar persistencia antes del rename (opcional)
 	if err := tmp.Sync(); err != nil {
-		http.Error(w, "fsync error", http.StatusInternalServerError)
-		return
+		return uploadResp{}, &uploadError{http.StatusInternalServerError, "fsync error"}
 	}
 	if err := tmp.Close(); err != nil {
-		http.Error(w, "close error", http.StatusInternalServerError)
-		return
+		return uploadResp{}, &uploadError{http.StatusInternalServerError, "close error"}
+	}
+	if s.Scanner != nil {
+		if err := s.scanBlob(id, plainName, tmpName, meta); err != nil {
+			return uploadResp{}, err
+		}
 	}
 
+	// metadatos antes del rename: un blob visible siempre tiene dueño
+	meta.Size = n
+	if o.Burn {
+		meta.Burn = true
+		meta.BurnUntil = meta.Created.Add(s.burnTTL()).Unix()
+	}
+	if meta.persist() {
+		if err := s.saveMeta(id, meta); err != nil {
+			return uploadResp{}, errStorage
+		}
+	}
+
+	s.usage.mu.Lock()
 	if err := os.Rename(tmpName, final); err != nil {
-		http.Error(w, "rename error", http.StatusInternalServerError)
-		return
+		s.usage.mu.Unlock()
+		_ = os.Remove(s.metaPath(id))
+		return uploadResp{}, &uploadError{http.StatusInternalServerError, "rename error"}
 	}
+	if fi, err := os.Stat(final); err == nil {
+		s.usage.add(o.Owner, 1, fi.Size())
+	}
+	s.usage.mu.Unlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(uploadResp{
+	resp := uploadResp{
 		UploadURL: "/d/" + id,
 		Size:      int(n),
-	})
+		Mime:      ct,
+		Filename:  o.Filename,
+		SHA256:    meta.SHA256,
+	}
+	if IsThumbMime(ct) && !meta.Burn {
+		resp.ThumbURL = "/d/" + id + "/thumb"
+	}
+	return resp, nil
+}
+
+// stored avisa a OnStored de un blob ya confirmado.
+func (s *UploadServer) stored(owner string, resp uploadResp, burn bool) {
+	if s.OnStored != nil {
+		s.OnStored(owner, Blob{URL: resp.UploadURL, Size: resp.Size, Mime: resp.Mime, SHA256: resp.SHA256}, burn)
+	}
+}
+
+// Blob describe un blob recién guardado por Store.
+type Blob struct {
+	URL    string // "/d/<id>"
+	Size   int
+	Mime   string // tras sniffing
+	SHA256 string
+}
+
+// Store guarda src como blob de owner, igual que un POST /upload con ese
+// Content-Type (y X-Clip-Burn si burn): mismas comprobaciones de tipo, cifrado,
+// compresión y análisis. El límite de tamaño lo pone quien llama. Los
+// errores se responden con WriteUploadError.
+func (s *UploadServer) Store(owner, mime string, burn bool, src io.Reader) (Blob, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return Blob{}, errStorage
+	}
+	resp, err := s.store(src, storeOpts{Owner: owner, Mime: mediaType(mime), Burn: burn})
+	if err != nil {
+		return Blob{}, err
+	}
+	s.stored(owner, resp, burn)
+	return Blob{URL: resp.UploadURL, Size: resp.Size, Mime: resp.Mime, SHA256: resp.SHA256}, nil
 }
 
+// WriteUploadError responde un error de Store con el mismo código que
+// daría POST /upload.
+func WriteUploadError(w http.ResponseWriter, err error) { writeBodyError(w, err) }
+
 func (s *UploadServer) Download(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 	if !idRe.MatchString(id) {
 		http.NotFound(w, r)
 		return
 	}
-	fp := filepath.Join(s.Dir, id)
-	f, err := os.Open(fp)
+	if !s.authorizeDownload(w, r, id, id) {
+		return
+	}
+	if s.serveRelay(w, r, id) {
+		return
+	}
+	meta, _ := s.loadMeta(id) // nil para blobs sin sidecar
+	// con gzip en reposo y cliente que lo acepta se sirve sin recomprimir
+	passGzip := meta != nil && meta.Encoding == "gzip" && acceptsGzip(r)
+	var f io.ReadCloser
+	var err error
+	if passGzip {
+		f, err = s.openStored(id, meta)
+	} else {
+		f, err = s.openBlob(id, meta)
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.NotFound(w, r)
@@ -117,9 +450,159 @@ func (s *UploadServer) Download(w http.ResponseWriter, r *http.Request) {
 	}
 	defer f.Close()
 
+	// burn-after-read: cada destinatario lee una vez; el último lo borra
+	last := false
+	if meta != nil && meta.Burn {
+		var ok bool
+		if last, ok = s.consumeBurn(id, downloadDevice(r), meta); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Disposition", "inline; filename="+id)
+	w.Header().Set("Content-Disposition", contentDisposition(id, meta))
+	if meta != nil && meta.Encoding != "" {
+		w.Header().Set("Vary", "Accept-Encoding")
+	}
+	if passGzip {
+		w.Header().Set("Content-Encoding", "gzip")
+	}
+	if meta != nil && meta.SHA256 != "" {
+		w.Header().Set("Repr-Digest", reprDigest(meta.SHA256))
+	}
 	_, _ = io.Copy(w, f)
+	if last {
+		f.Close()
+		s.metaMu.Lock()
+		s.removeBlob(id)
+		s.metaMu.Unlock()
+	}
+}
+
+// writeBodyError traduce errores leyendo/guardando el cuerpo del upload.
+func writeBodyError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	var upErr *uploadError
+	switch {
+	case errors.As(err, &upErr):
+		http.Error(w, upErr.msg, upErr.code)
+	case errors.As(err, &maxErr):
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errBadEncoding):
+		http.Error(w, "invalid gzip body", http.StatusBadRequest)
+	default:
+		http.Error(w, "write error", http.StatusInternalServerError)
+	}
+}
+
+// multipartErr: lo que no sea límite, gzip o un rechazo propio es un
+// multipart mal formado (400), no un fallo del almacenamiento.
+func multipartErr(err error) error {
+	var maxErr *http.MaxBytesError
+	var upErr *uploadError
+	if errors.As(err, &maxErr) || errors.As(err, &upErr) || errors.Is(err, errBadEncoding) {
+		return err
+	}
+	return errBadMultipart
+}
+
+// mediaType normaliza un Content-Type ("" = application/octet-stream).
+func mediaType(ct string) string {
+	if ct == "" {
+		return "application/octet-stream"
+	}
+	if media, _, err := mime.ParseMediaType(ct); err == nil {
+		return media
+	}
+	return ct
+}
+
+// cleanFilename deja solo el nombre base, sin controles ni comillas, y
+// acotado a maxFilename bytes sin partir caracteres UTF-8.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	for len(name) > maxFilename {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// contentDisposition usa el nombre original si se subió con uno.
+func contentDisposition(id string, meta *blobMeta) string {
+	if meta != nil && meta.Filename != "" {
+		if v := mime.FormatMediaType("inline", map[string]string{"filename": meta.Filename}); v != "" {
+			return v
+		}
+	}
+	return "inline; filename=" + id
+}
+
+type blobReader struct {
+	io.Reader
+	io.Closer
+}
+
+// openBlob abre el blob id y devuelve su contenido original: descifrado y
+// descomprimido según meta (nil = blob sin sidecar, guardado tal cual).
+func (s *UploadServer) openBlob(id string, meta *blobMeta) (io.ReadCloser, error) {
+	rc, err := s.openStored(id, meta)
+	if err != nil || meta == nil || meta.Encoding == "" {
+		return rc, err
+	}
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return gzipReadCloser{zr, rc}, nil
+}
+
+// openStored abre el blob id descifrado pero aún con meta.Encoding aplicado.
+func (s *UploadServer) openStored(id string, meta *blobMeta) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.Dir, id))
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil || meta.Enc == nil {
+		return f, nil
+	}
+	if s.Keys == nil {
+		f.Close()
+		return nil, errors.New("blob is encrypted but no keyring is configured")
+	}
+	dek, err := s.Keys.unwrap(id, meta.Enc)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	dr, err := newDecryptReader(f, dek, id)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return blobReader{dr, f}, nil
+}
+
+// downloadDevice identifica al dispositivo que descarga: "dev" de la URL
+// firmada o "?device=" junto al token.
+func downloadDevice(r *http.Request) string {
+	q := r.URL.Query()
+	if d := q.Get("dev"); d != "" {
+		return d
+	}
+	return q.Get("device")
 }
 
 func randHex(n int) string {
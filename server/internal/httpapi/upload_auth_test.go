@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// token == userID, como el modo MVP del server
+func mvpAuth(token string) (string, bool) { return token, token != "" }
+
+func newAuthMux(s *UploadServer) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /upload", s.Upload)
+	mux.HandleFunc("GET /d/{id}", s.Download)
+	return mux
+}
+
+func uploadAs(t *testing.T, h http.Handler, token string, body []byte) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	var up uploadResp
+	_ = json.NewDecoder(rr.Body).Decode(&up)
+	return rr.Code, up.UploadURL
+}
+
+func TestUpload_RequiresToken(t *testing.T) {
+	dir := t.TempDir()
+	h := newAuthMux(&UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth})
+
+	if code, _ := uploadAs(t, h, "", []byte("hola")); code != http.StatusUnauthorized {
+		t.Fatalf("status=%d, want 401", code)
+	}
+	ents, _ := os.ReadDir(dir)
+	if len(ents) != 0 {
+		t.Fatalf("no debe guardar archivos sin credenciales")
+	}
+}
+
+func TestDownload_OwnerScoped(t *testing.T) {
+	dir := t.TempDir()
+	h := newAuthMux(&UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth})
+
+	code, url := uploadAs(t, h, "u1", []byte("secreto"))
+	if code != http.StatusOK || url == "" {
+		t.Fatalf("upload status=%d url=%q", code, url)
+	}
+
+	cases := []struct {
+		name string
+		url  string
+		auth string
+		want int
+	}{
+		{"sin token", url, "", http.StatusUnauthorized},
+		{"otro usuario", url, "Bearer u2", http.StatusNotFound},
+		{"dueño por cabecera", url, "Bearer u1", http.StatusOK},
+		{"dueño por query", url + "?token=u1", "", http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.url, nil)
+		if c.auth != "" {
+			req.Header.Set("Authorization", c.auth)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != c.want {
+			t.Fatalf("%s: status=%d, want %d", c.name, rr.Code, c.want)
+		}
+		if c.want == http.StatusOK && rr.Body.String() != "secreto" {
+			t.Fatalf("%s: body=%q", c.name, rr.Body.String())
+		}
+	}
+}
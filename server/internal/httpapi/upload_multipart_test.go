@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"testing"
+)
+
+type formFile struct {
+	name, mime string
+	body       []byte
+}
+
+func postForm(t *testing.T, h http.Handler, files ...formFile) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("note", "campo sin archivo")
+	for _, f := range files {
+		hdr := textproto.MIMEHeader{}
+		hdr.Set("Content-Disposition", `form-data; name="file"; filename="`+f.name+`"`)
+		if f.mime != "" {
+			hdr.Set("Content-Type", f.mime)
+		}
+		pw, _ := mw.CreatePart(hdr)
+		_, _ = pw.Write(f.body)
+	}
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer u1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestUpload_MultipartParts(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+
+	rr := postForm(t, h,
+		formFile{"notas.txt", "text/plain", []byte("hola")},
+		formFile{"../../etc/año 1.bin", "", []byte{1, 2, 3}},
+	)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status=%d body=%s", rr.Code, rr.Body)
+	}
+	var resp multipartResp
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || len(resp.Files) != 2 {
+		t.Fatalf("resp=%+v err=%v", resp, err)
+	}
+	want := []uploadResp{
+		{Filename: "notas.txt", Mime: "text/plain", Size: 4},
+		{Filename: "año 1.bin", Mime: "application/octet-stream", Size: 3},
+	}
+	for i, f := range resp.Files {
+		if f.Filename != want[i].Filename || f.Mime != want[i].Mime || f.Size != want[i].Size {
+			t.Fatalf("parte %d: %+v, want %+v", i, f, want[i])
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, resp.Files[0].UploadURL, nil)
+	req.Header.Set("Authorization", "Bearer u1")
+	got := httptest.NewRecorder()
+	h.ServeHTTP(got, req)
+	if got.Body.String() != "hola" {
+		t.Fatalf("body=%q", got.Body.String())
+	}
+	if cd := got.Header().Get("Content-Disposition"); cd != "inline; filename=notas.txt" {
+		t.Fatalf("Content-Disposition=%q", cd)
+	}
+}
+
+func TestUpload_MultipartAllOrNothing(t *testing.T) {
+	dir := t.TempDir()
+	s := &UploadServer{Dir: dir, MaxBytes: 1 << 20, Auth: mvpAuth, Allowed: []string{"text/*"}}
+	h := newAuthMux(s)
+
+	rr := postForm(t, h,
+		formFile{"a.txt", "text/plain", []byte("ok")},
+		formFile{"b.bin", "application/octet-stream", []byte{0}},
+	)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status=%d, want 415", rr.Code)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("quedaron %d archivos de un upload rechazado", len(ents))
+	}
+
+	if rr := postForm(t, h); rr.Code != http.StatusBadRequest {
+		t.Fatalf("sin archivos: status=%d, want 400", rr.Code)
+	}
+}
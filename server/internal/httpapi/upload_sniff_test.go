@@ -0,0 +1,68 @@
+package httpapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"clip-sync/server/internal/sniff"
+)
+
+func TestUpload_SniffPolicy(t *testing.T) {
+	elf := append([]byte("\x7fELF\x02\x01\x01\x00"), bytes.Repeat([]byte{0}, 600)...)
+
+	post := func(s *UploadServer) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(elf))
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set("Authorization", "Bearer u1")
+		rr := httptest.NewRecorder()
+		newAuthMux(s).ServeHTTP(rr, req)
+		return rr
+	}
+
+	// reject: ejecutable declarado como texto
+	if rr := post(&UploadServer{Dir: t.TempDir(), Auth: mvpAuth, Sniff: sniff.Reject}); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("reject: status=%d, want 415", rr.Code)
+	}
+
+	// correct: se guarda con el tipo detectado...
+	s := &UploadServer{Dir: t.TempDir(), Auth: mvpAuth, Sniff: sniff.Correct}
+	rr := post(s)
+	var up uploadResp
+	if err := json.NewDecoder(rr.Body).Decode(&up); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("correct: status=%d err=%v", rr.Code, err)
+	}
+	id, _ := BlobID(up.UploadURL)
+	m, err := s.loadMeta(id)
+	if err != nil || m.Mime != "application/x-executable" || m.Detected != "application/x-executable" {
+		t.Fatalf("meta=%+v err=%v", m, err)
+	}
+
+	// ...salvo que el tipo corregido no pase el whitelist
+	s2 := &UploadServer{Dir: t.TempDir(), Auth: mvpAuth, Sniff: sniff.Correct, Allowed: []string{"text/*"}}
+	if rr := post(s2); rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("correct+whitelist: status=%d, want 415", rr.Code)
+	}
+}
+
+// Formatos que DetectContentType no conoce: con reject se aceptan igual.
+func TestUpload_SniffUnknownFormats(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), Auth: mvpAuth, Sniff: sniff.Reject}
+	for mime, head := range map[string][]byte{
+		"image/heic":      []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic\x00\x00\x01\x0ameta"),
+		"video/quicktime": []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00qt  \x00\x00\x00\x08wide"),
+		"audio/flac":      []byte("fLaC\x00\x00\x00\x22\x10\x00\x10\x00\x00\x00\x0e\x00\x3e\xf4\x0a\xc4\x42\xf0"),
+	} {
+		body := append(head, bytes.Repeat([]byte{0x5a}, 600)...)
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(body))
+		req.Header.Set("Content-Type", mime)
+		req.Header.Set("Authorization", "Bearer u1")
+		rr := httptest.NewRecorder()
+		newAuthMux(s).ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: status=%d, quiero 200", mime, rr.Code)
+		}
+	}
+}
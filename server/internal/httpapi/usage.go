@@ -0,0 +1,167 @@
+package httpapi
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Uso del almacenamiento: blobs y bytes en disco por dueño. Se mantiene
+// al guardar y al borrar, y RebuildUsage lo recalcula desde el directorio
+// (al arrancar o si se sospecha que se desvió). Cuenta el tamaño real del
+// blob en disco (tras comprimir/cifrar); miniaturas y sidecars no cuentan.
+
+// Usage es el consumo de un usuario o del total.
+type Usage struct {
+	Blobs int64 `json:"blobs"`
+	Bytes int64 `json:"bytes"`
+}
+
+type usageTable struct {
+	mu    sync.Mutex
+	total Usage
+	users map[string]Usage // userID ("" = anónimo) -> uso
+}
+
+// add suma al uso de owner; el llamador tiene u.mu. Quien cambia el disco
+// lo hace con u.mu tomado para que RebuildUsage no cuente dos veces.
+func (u *usageTable) add(owner string, blobs, bytes int64) {
+	if u.users == nil {
+		u.users = make(map[string]Usage)
+	}
+	cur := u.users[owner]
+	cur.Blobs += blobs
+	cur.Bytes += bytes
+	if cur.Blobs <= 0 {
+		delete(u.users, owner)
+	} else {
+		u.users[owner] = cur
+	}
+	u.total.Blobs += blobs
+	u.total.Bytes += bytes
+}
+
+// UsageSnapshot devuelve el total y una copia del uso por usuario.
+func (s *UploadServer) UsageSnapshot() (Usage, map[string]Usage) {
+	u := &s.usage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	users := make(map[string]Usage, len(u.users))
+	for k, v := range u.users {
+		users[k] = v
+	}
+	return u.total, users
+}
+
+// RebuildUsage recalcula el uso recorriendo Dir. Mientras dura, los
+// uploads y borrados esperan para no contar dos veces.
+func (s *UploadServer) RebuildUsage() error {
+	u := &s.usage
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ents, err := os.ReadDir(s.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var total Usage
+	users := make(map[string]Usage)
+	for _, e := range ents {
+		id := e.Name()
+		if !idRe.MatchString(id) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(s.Dir, id))
+		if err != nil {
+			continue // borrado entre ReadDir y Stat
+		}
+		owner := ""
+		if m, err := s.loadMeta(id); err == nil {
+			owner = m.Owner
+		}
+		cur := users[owner]
+		cur.Blobs++
+		cur.Bytes += fi.Size()
+		users[owner] = cur
+		total.Blobs++
+		total.Bytes += fi.Size()
+	}
+	u.total, u.users = total, users
+	return nil
+}
+
+// usageMetrics aplana el uso para /healthz, como drops_device en ws.
+func (s *UploadServer) usageMetrics(m map[string]int64) {
+	total, users := s.UsageSnapshot()
+	m["storage_blobs"] = total.Blobs
+	m["storage_bytes"] = total.Bytes
+	for uid, v := range users {
+		m["storage_blobs_user:"+uid] = v.Blobs
+		m["storage_bytes_user:"+uid] = v.Bytes
+	}
+}
+
+// BlobInfo describe un blob guardado, para inspeccionar el almacenamiento.
+type BlobInfo struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Mime    string    `json:"mime,omitempty"`
+	Size    int64     `json:"size"` // en disco
+	Created time.Time `json:"created"`
+	Burn    bool      `json:"burn,omitempty"`
+	Orphan  bool      `json:"orphan,omitempty"`
+}
+
+// Blobs lista los blobs de owner (todos si all), de más nuevo a más viejo.
+// Los blobs sin metadatos son anónimos y su fecha es la del fichero.
+func (s *UploadServer) Blobs(owner string, all bool) ([]BlobInfo, error) {
+	ents, err := os.ReadDir(s.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	out := []BlobInfo{}
+	for _, e := range ents {
+		id := e.Name()
+		if !idRe.MatchString(id) {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(s.Dir, id))
+		if err != nil {
+			continue
+		}
+		b := BlobInfo{ID: id, Size: fi.Size(), Created: fi.ModTime()}
+		if m, err := s.loadMeta(id); err == nil {
+			b.Owner, b.Mime, b.Created, b.Burn, b.Orphan = m.Owner, m.Mime, m.Created, m.Burn, m.Orphan
+		}
+		if all || b.Owner == owner {
+			out = append(out, b)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out, nil
+}
+
+// Purge borra los blobs de owner (todos si all) creados antes de before y
+// devuelve cuánto liberó.
+func (s *UploadServer) Purge(owner string, all bool, before time.Time) (Usage, error) {
+	list, err := s.Blobs(owner, all)
+	if err != nil {
+		return Usage{}, err
+	}
+	var freed Usage
+	for _, b := range list {
+		if !b.Created.Before(before) {
+			continue
+		}
+		s.metaMu.Lock()
+		err := s.removeBlob(b.ID)
+		s.metaMu.Unlock()
+		if err != nil {
+			return freed, err
+		}
+		freed.Blobs++
+		freed.Bytes += b.Size
+	}
+	return freed, nil
+}
@@ -0,0 +1,64 @@
+package httpapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUsage_IncrementalMatchesRebuild(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+
+	uploadAs(t, h, "u1", []byte("uno"))
+	_, gone := uploadAs(t, h, "u1", []byte("dos dos"))
+	uploadAs(t, h, "u2", []byte("tres tres tres"))
+	id, _ := BlobID(gone)
+	if !s.Delete("u1", id) {
+		t.Fatal("delete falló")
+	}
+
+	total, users := s.UsageSnapshot()
+	want := map[string]Usage{"u1": {1, 3}, "u2": {1, 14}}
+	if total != (Usage{2, 17}) || !reflect.DeepEqual(users, want) {
+		t.Fatalf("incremental: total=%+v users=%+v", total, users)
+	}
+
+	// un servidor nuevo sobre el mismo directorio llega a lo mismo
+	s2 := &UploadServer{Dir: s.Dir}
+	if err := s2.RebuildUsage(); err != nil {
+		t.Fatal(err)
+	}
+	total2, users2 := s2.UsageSnapshot()
+	if total2 != total || !reflect.DeepEqual(users2, users) {
+		t.Fatalf("rebuild: total=%+v users=%+v", total2, users2)
+	}
+
+	m := s.MetricsSnapshot()
+	if m["storage_bytes"] != 17 || m["storage_blobs_user:u2"] != 1 || m["storage_bytes_user:u1"] != 3 {
+		t.Fatalf("métricas=%v", m)
+	}
+}
+
+func TestPurge_OnlyOwnerAndOlder(t *testing.T) {
+	s := &UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20, Auth: mvpAuth}
+	h := newAuthMux(s)
+	uploadAs(t, h, "u1", []byte("uno"))
+	uploadAs(t, h, "u1", []byte("dos dos"))
+	uploadAs(t, h, "u2", []byte("tres tres tres"))
+
+	if list, _ := s.Blobs("u1", false); len(list) != 2 || list[0].Owner != "u1" {
+		t.Fatalf("blobs=%+v", list)
+	}
+	if freed, _ := s.Purge("u1", false, time.Now().Add(-time.Hour)); freed.Blobs != 0 {
+		t.Fatalf("borró blobs recientes: %+v", freed)
+	}
+	freed, err := s.Purge("u1", false, time.Now().Add(time.Second))
+	if err != nil || freed != (Usage{2, 10}) {
+		t.Fatalf("purge: %+v %v", freed, err)
+	}
+	total, users := s.UsageSnapshot()
+	if total != (Usage{1, 14}) || len(users) != 1 {
+		t.Fatalf("uso tras purge: %+v %+v", total, users)
+	}
+}
@@ -0,0 +1,350 @@
+// Package policy revisa el texto de los clips antes de difundirlos en
+// busca de secretos (claves de AWS, claves privadas, tokens...). Cada regla
+// detecta con una regex, opcionalmente exigiendo entropía mínima a lo que
+// encaja, y tiene una acción: allow (nada), flag (se difunde y se
+// registra), redact (se sustituye lo encontrado) o block (no se difunde).
+// Solo se revisa a los usuarios que lo activaron, o a todos sin excepción
+// con Forced.
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"clip-sync/server/pkg/types"
+
+	"clip-sync/server/internal/fsutil"
+)
+
+// Action es lo que se hace con un clip en el que encaja una regla. Las
+// acciones están ordenadas de menos a más severa: manda la mayor.
+type Action int
+
+const (
+	Allow Action = iota
+	Flag
+	Redact
+	Block
+)
+
+var actionNames = [...]string{"allow", "flag", "redact", "block"}
+
+func (a Action) String() string {
+	if a < Allow || a > Block {
+		return "unknown"
+	}
+	return actionNames[a]
+}
+
+// ParseAction convierte "allow", "flag", "redact" o "block".
+func ParseAction(s string) (Action, bool) {
+	for i, n := range actionNames {
+		if s == n {
+			return Action(i), true
+		}
+	}
+	return Allow, false
+}
+
+func (a Action) MarshalText() ([]byte, error) { return []byte(a.String()), nil }
+
+func (a *Action) UnmarshalText(b []byte) error {
+	v, ok := ParseAction(string(b))
+	if !ok {
+		return fmt.Errorf("unknown action %q", b)
+	}
+	*a = v
+	return nil
+}
+
+// Rule es un detector con su acción.
+type Rule struct {
+	Name       string
+	Pattern    *regexp.Regexp
+	MinEntropy float64 // bits por carácter que debe tener lo que encaja (0 = no se mira)
+	Action     Action
+}
+
+// Builtin devuelve las reglas incluidas para formatos de secretos comunes.
+func Builtin() []Rule {
+	return []Rule{
+		{Name: "private_key", Action: Block,
+			Pattern: regexp.MustCompile(`-----BEGIN[A-Z ]* PRIVATE KEY-----[\s\S]*?(?:-----END[A-Z ]* PRIVATE KEY-----|$)`)},
+		{Name: "aws_access_key_id", Action: Redact,
+			Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "aws_secret_access_key", Action: Redact,
+			Pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+		{Name: "github_token", Action: Redact,
+			Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{50,})\b`)},
+		{Name: "slack_token", Action: Redact,
+			Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+		{Name: "jwt", Action: Flag,
+			Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{16,}`)},
+		// cadenas largas y aleatorias: contraseñas y claves sin formato
+		// conocido. Solo se registran: los falsos positivos son frecuentes.
+		{Name: "high_entropy", Action: Flag, MinEntropy: 4.5,
+			Pattern: regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`)},
+	}
+}
+
+// ErrForced: el operador impuso la política y un usuario no puede salirse.
+var ErrForced = errors.New("content policy is enforced for all users")
+
+// Engine aplica las reglas a los clips de los usuarios que lo activaron.
+type Engine struct {
+	Rules  []Rule
+	Forced bool   // activado para todos; nadie puede desactivarlo
+	Path   string // fichero JSON con la elección de cada usuario; "" = memoria
+
+	// Log, si no es nil, recibe policy_flag, policy_redact y policy_block
+	// con los nombres de las reglas (nunca el texto encontrado).
+	Log func(event string, fields map[string]any)
+
+	mu    sync.Mutex
+	users map[string]bool // userID -> activado
+}
+
+// Load lee un fichero de reglas:
+//
+//	{"builtin": true, "rules": [{"name": "...", "pattern": "...", "min_entropy": 0, "action": "redact"}]}
+//
+// Una regla sin pattern con el nombre de una incluida cambia su acción.
+func Load(path string) ([]Rule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f struct {
+		Builtin bool `json:"builtin"`
+		Rules   []struct {
+			Name       string  `json:"name"`
+			Pattern    string  `json:"pattern"`
+			MinEntropy float64 `json:"min_entropy"`
+			Action     Action  `json:"action"`
+		} `json:"rules"`
+	}
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if f.Builtin {
+		rules = Builtin()
+	}
+	for _, r := range f.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule without name")
+		}
+		if r.Pattern == "" {
+			i := slices.IndexFunc(rules, func(b Rule) bool { return b.Name == r.Name })
+			if i < 0 {
+				return nil, fmt.Errorf("rule %q: no pattern and no built-in rule by that name", r.Name)
+			}
+			rules[i].Action = r.Action
+			continue
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %v", r.Name, err)
+		}
+		rules = append(rules, Rule{Name: r.Name, Pattern: re, MinEntropy: r.MinEntropy, Action: r.Action})
+	}
+	return rules, nil
+}
+
+// LoadUsers lee la elección de cada usuario guardada en e.Path, si existe.
+func (e *Engine) LoadUsers() error {
+	if e.Path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(e.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return json.Unmarshal(b, &e.users)
+}
+
+// Enabled indica si los clips de userID se revisan.
+func (e *Engine) Enabled(userID string) bool {
+	if e.Forced {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.users[userID]
+}
+
+// SetEnabled activa o desactiva la revisión para userID. Con Forced no se
+// puede desactivar (ErrForced).
+func (e *Engine) SetEnabled(userID string, on bool) error {
+	if e.Forced && !on {
+		return ErrForced
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prev, had := e.users[userID]
+	if e.users == nil {
+		e.users = make(map[string]bool)
+	}
+	e.users[userID] = on
+	if err := e.saveLocked(); err != nil {
+		if had {
+			e.users[userID] = prev
+		} else {
+			delete(e.users, userID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Match es un tramo de texto en el que encajó una regla.
+type Match struct {
+	Rule       *Rule
+	Start, End int
+}
+
+// Scan devuelve lo que encaja en text, en orden y sin solapes. Si dos
+// tramos se pisan gana la acción más severa (un flag genérico no debe
+// tapar un secreto que hay que redactar); a igualdad, la regla anterior.
+func (e *Engine) Scan(text string) []Match {
+	var all []Match
+	for i := range e.Rules {
+		r := &e.Rules[i]
+		for _, loc := range r.Pattern.FindAllStringIndex(text, -1) {
+			if r.MinEntropy > 0 && entropy(text[loc[0]:loc[1]]) < r.MinEntropy {
+				continue
+			}
+			all = append(all, Match{Rule: r, Start: loc[0], End: loc[1]})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Rule.Action > all[j].Rule.Action })
+	var out []Match
+	for _, m := range all {
+		overlaps := slices.ContainsFunc(out, func(o Match) bool { return m.Start < o.End && o.Start < m.End })
+		if !overlaps {
+			out = append(out, m)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+// Apply revisa un clip de texto inline de userID: lo deja como está, lo
+// redacta en el sitio o devuelve false para que no se difunda. El texto de
+// los clips subidos como blob lo revisa quien puede leerlo, con Text.
+func (e *Engine) Apply(userID string, clip *types.Clip) bool {
+	if len(clip.Data) == 0 || !strings.HasPrefix(clip.Mime, "text/") || !e.Enabled(userID) {
+		return true
+	}
+	text, ok := e.Text(userID, clip.MsgID, string(clip.Data))
+	if !ok {
+		return false
+	}
+	if text != string(clip.Data) {
+		clip.Data = []byte(text)
+		clip.Size = len(clip.Data)
+		if clip.SHA256 != "" {
+			sum := sha256.Sum256(clip.Data)
+			clip.SHA256 = hex.EncodeToString(sum[:])
+		}
+	}
+	return true
+}
+
+// Text aplica las reglas a text del clip msgID de userID (sin mirar si lo
+// activó): devuelve el texto, redactado si hace falta, y false si hay que
+// bloquearlo.
+func (e *Engine) Text(userID, msgID, text string) (string, bool) {
+	matches := e.Scan(text)
+	act := Allow
+	var names []string
+	for _, m := range matches {
+		if m.Rule.Action == Allow {
+			continue
+		}
+		act = max(act, m.Rule.Action)
+		if !slices.Contains(names, m.Rule.Name) {
+			names = append(names, m.Rule.Name)
+		}
+	}
+	if act == Allow {
+		return text, true
+	}
+	e.log("policy_"+act.String(), map[string]any{"user_id": userID, "msg_id": msgID, "rules": names})
+	switch act {
+	case Block:
+		return text, false
+	case Redact:
+		return redact(text, matches), true
+	}
+	return text, true
+}
+
+// redact sustituye los tramos con acción redact por [REDACTED:<regla>].
+func redact(text string, matches []Match) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.Rule.Action != Redact {
+			continue
+		}
+		b.WriteString(text[last:m.Start])
+		b.WriteString("[REDACTED:" + m.Rule.Name + "]")
+		last = m.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// entropy es la entropía de Shannon de s en bits por carácter.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	n := float64(len(s))
+	var h float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / n
+			h -= p * math.Log2(p)
+		}
+	}
+	return h
+}
+
+func (e *Engine) log(event string, fields map[string]any) {
+	if e.Log != nil {
+		e.Log(event, fields)
+	}
+}
+
+// saveLocked guarda en Path; el llamador tiene e.mu.
+func (e *Engine) saveLocked() error {
+	if e.Path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(e.users, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFile(e.Path, b)
+}
@@ -0,0 +1,184 @@
+// Package scan pasa los uploads por un antivirus externo antes de que los
+// destinatarios puedan descargarlos: un comando local que recibe la ruta
+// del archivo o un clamd por socket (protocolo INSTREAM).
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Result es el veredicto de un análisis.
+type Result struct {
+	Infected  bool
+	Signature string // qué se detectó; vacío si está limpio
+}
+
+// Scanner analiza el archivo en path (contenido en claro). Un error
+// significa que no se pudo analizar, no que esté infectado.
+type Scanner interface {
+	Scan(ctx context.Context, path string) (Result, error)
+}
+
+// Action decide qué hacer con un blob detectado.
+type Action int
+
+const (
+	Reject     Action = iota // se borra y el upload falla
+	Quarantine               // se aparta a <dir>/quarantine y el upload falla
+)
+
+// ParseAction interpreta "reject|quarantine"; desconocido → Reject.
+func ParseAction(s string) Action {
+	if strings.EqualFold(strings.TrimSpace(s), "quarantine") {
+		return Quarantine
+	}
+	return Reject
+}
+
+func (a Action) String() string {
+	if a == Quarantine {
+		return "quarantine"
+	}
+	return "reject"
+}
+
+// Parse construye un Scanner desde la configuración:
+//
+//	clamd:/run/clamav/clamd.ctl   clamd por socket unix
+//	command:clamscan --no-summary comando; la ruta va como último argumento
+//
+// Vacío devuelve nil (sin análisis).
+func Parse(spec string) (Scanner, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "clamd":
+		if arg == "" {
+			return nil, errors.New("clamd: missing socket path")
+		}
+		return &Clamd{Network: "unix", Addr: arg}, nil
+	case "command":
+		f := strings.Fields(arg)
+		if len(f) == 0 {
+			return nil, errors.New("command: missing program")
+		}
+		return &Command{Path: f[0], Args: f[1:]}, nil
+	}
+	return nil, fmt.Errorf("unknown scanner %q (want clamd:<socket> or command:<program>)", kind)
+}
+
+// Command ejecuta Path con Args y la ruta del archivo al final. Sigue la
+// convención de clamscan: salida 0 = limpio, 1 = detectado (la última
+// línea de stdout es la firma), cualquier otra = error.
+type Command struct {
+	Path string
+	Args []string
+}
+
+func (c *Command) Scan(ctx context.Context, path string) (Result, error) {
+	cmd := exec.CommandContext(ctx, c.Path, append(append([]string(nil), c.Args...), path)...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	if err == nil {
+		return Result{}, nil
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && ee.ExitCode() == 1 {
+		return Result{Infected: true, Signature: lastLine(out.String())}, nil
+	}
+	return Result{}, fmt.Errorf("scan command: %w", err)
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	sig := strings.TrimSpace(lines[len(lines)-1])
+	if sig == "" {
+		return "detected"
+	}
+	return sig
+}
+
+// clamdChunk: tamaño de cada trozo INSTREAM; clamd rechaza el stream
+// entero si supera su StreamMaxLength, no por trozos.
+const clamdChunk = 64 << 10
+
+// Clamd habla con clamd por Network ("unix" o "tcp") y Addr.
+type Clamd struct {
+	Network string
+	Addr    string
+}
+
+func (c *Clamd) Scan(ctx context.Context, path string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.Network, c.Addr)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	buf := make([]byte, 4+clamdChunk)
+	for {
+		n, rerr := f.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return Result{}, fmt.Errorf("clamd: %w", err)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return Result{}, rerr
+		}
+	}
+	// trozo de longitud 0 = fin del stream
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	return parseClamd(string(reply))
+}
+
+// parseClamd interpreta "stream: OK", "stream: <firma> FOUND" o
+// "... ERROR" (terminados en NUL con el prefijo z).
+func parseClamd(reply string) (Result, error) {
+	r := strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	_, status, _ := strings.Cut(r, ": ")
+	switch {
+	case status == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("clamd: %s", r)
+}
@@ -0,0 +1,127 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeClamd atiende INSTREAM y marca como infectado todo stream que
+// contenga "EICAR".
+func fakeClamd(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "clamd") // rutas de socket cortas
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	sock := filepath.Join(dir, "clamd.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(c)
+		}
+	}()
+	return sock
+}
+
+func serveClamd(c net.Conn) {
+	defer c.Close()
+	cmd := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(c, cmd); err != nil || string(cmd) != "zINSTREAM\x00" {
+		_, _ = io.WriteString(c, "UNKNOWN COMMAND\x00")
+		return
+	}
+	var body bytes.Buffer
+	for {
+		var n uint32
+		if err := binary.Read(c, binary.BigEndian, &n); err != nil {
+			return
+		}
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(&body, c, int64(n)); err != nil {
+			return
+		}
+	}
+	if bytes.Contains(body.Bytes(), []byte("EICAR")) {
+		_, _ = io.WriteString(c, "stream: Eicar-Test-Signature FOUND\x00")
+		return
+	}
+	_, _ = io.WriteString(c, "stream: OK\x00")
+}
+
+func writeFile(t *testing.T, body []byte) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "blob")
+	if err := os.WriteFile(p, body, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestClamd(t *testing.T) {
+	sc, err := Parse("clamd:" + fakeClamd(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// más de un trozo para cubrir el troceo
+	clean := bytes.Repeat([]byte("limpio "), clamdChunk/3)
+	if res, err := sc.Scan(context.Background(), writeFile(t, clean)); err != nil || res.Infected {
+		t.Fatalf("limpio: res=%+v err=%v", res, err)
+	}
+	res, err := sc.Scan(context.Background(), writeFile(t, append(clean, "EICAR"...)))
+	if err != nil || !res.Infected || res.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("infectado: res=%+v err=%v", res, err)
+	}
+
+	down := &Clamd{Network: "unix", Addr: filepath.Join(t.TempDir(), "no.sock")}
+	if _, err := down.Scan(context.Background(), writeFile(t, clean)); err == nil {
+		t.Fatal("clamd caído debe ser error, no limpio")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	// exit 1 y firma en stdout si el archivo contiene EICAR
+	sc := &Command{Path: "sh", Args: []string{"-c", `if grep -q EICAR "$1"; then echo "$1: Test.EICAR"; exit 1; fi`, "scan"}}
+	if res, err := sc.Scan(context.Background(), writeFile(t, []byte("hola"))); err != nil || res.Infected {
+		t.Fatalf("limpio: res=%+v err=%v", res, err)
+	}
+	p := writeFile(t, []byte("xx EICAR xx"))
+	if res, err := sc.Scan(context.Background(), p); err != nil || !res.Infected || res.Signature != p+": Test.EICAR" {
+		t.Fatalf("infectado: res=%+v err=%v", res, err)
+	}
+	broken := &Command{Path: "sh", Args: []string{"-c", "exit 2", "scan"}}
+	if _, err := broken.Scan(context.Background(), p); err == nil {
+		t.Fatal("salida 2 debe ser error")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if sc, err := Parse(""); sc != nil || err != nil {
+		t.Fatalf("vacío: %v %v", sc, err)
+	}
+	c, err := Parse("command:clamscan --no-summary")
+	if cmd, ok := c.(*Command); err != nil || !ok || cmd.Path != "clamscan" || len(cmd.Args) != 1 {
+		t.Fatalf("command: %#v %v", c, err)
+	}
+	for _, bad := range []string{"clamd:", "command:", "icap:x"} {
+		if _, err := Parse(bad); err == nil {
+			t.Fatalf("%q debería fallar", bad)
+		}
+	}
+}
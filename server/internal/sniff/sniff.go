@@ -0,0 +1,180 @@
+// Package sniff detecta el tipo real de un contenido por sus primeros bytes
+// y decide si es compatible con el MIME que declaró el cliente.
+package sniff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// HeadSize: bytes necesarios para detectar (los que mira http.DetectContentType).
+const HeadSize = 512
+
+type Policy int
+
+const (
+	Off     Policy = iota // no se comprueba nada
+	Reject                // un tipo declarado incompatible se rechaza
+	Correct               // se sustituye por el tipo detectado
+)
+
+// ParsePolicy interpreta "off|reject|correct"; desconocido → Reject.
+func ParsePolicy(s string) Policy {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "off", "none":
+		return Off
+	case "correct":
+		return Correct
+	default:
+		return Reject
+	}
+}
+
+func (p Policy) String() string {
+	switch p {
+	case Off:
+		return "off"
+	case Correct:
+		return "correct"
+	}
+	return "reject"
+}
+
+const peMime = "application/vnd.microsoft.portable-executable"
+
+// ejecutables que http.DetectContentType no reconoce. Los PE se miran
+// aparte (isPE): "MZ" a secas es demasiado corto como firma.
+var execMagic = []struct {
+	sig  []byte
+	mime string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xce}, "application/x-mach-binary"},
+	{[]byte{0xfe, 0xed, 0xfa, 0xcf}, "application/x-mach-binary"},
+	{[]byte{0xce, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "application/x-mach-binary"},
+}
+
+// Detect devuelve el media type (sin parámetros) de head.
+func Detect(head []byte) string {
+	// texto legible nunca es un ejecutable, empiece por lo que empiece
+	if !looksText(head) {
+		if isPE(head) {
+			return peMime
+		}
+		for _, m := range execMagic {
+			if bytes.HasPrefix(head, m.sig) {
+				return m.mime
+			}
+		}
+	}
+	ct := http.DetectContentType(head)
+	if media, _, err := mime.ParseMediaType(ct); err == nil {
+		return media
+	}
+	return ct
+}
+
+// Compatible indica si declared es una etiqueta aceptable para un
+// contenido detectado como detected.
+func Compatible(declared, detected string) bool {
+	declared = strings.ToLower(strings.TrimSpace(declared))
+	switch {
+	case declared == detected, declared == "application/octet-stream":
+		return true
+	case isExec(detected):
+		return false
+	case textual(declared):
+		return textual(detected)
+	case detected == "application/octet-stream" || detected == "text/plain":
+		// el detector no sabe qué es: solo es mentira si el tipo declarado
+		// tiene firma propia que debería haberse visto
+		return !recognizable(declared)
+	case detected == "application/zip":
+		return zipBased(declared)
+	}
+	return false
+}
+
+// isPE: cabecera MZ cuyo e_lfanew (offset 0x3c) apunta a "PE\0\0" dentro
+// de head.
+func isPE(head []byte) bool {
+	if len(head) < 0x40 || !bytes.HasPrefix(head, []byte("MZ")) {
+		return false
+	}
+	off := binary.LittleEndian.Uint32(head[0x3c:])
+	return uint64(off)+4 <= uint64(len(head)) && bytes.Equal(head[off:off+4], []byte("PE\x00\x00"))
+}
+
+// looksText: UTF-8 válido sin bytes de control salvo los de espaciado. El
+// final puede cortar una runa a medias.
+func looksText(head []byte) bool {
+	for i := 0; i < len(head); {
+		r, n := utf8.DecodeRune(head[i:])
+		if r == utf8.RuneError && n <= 1 {
+			return len(head)-i < utf8.UTFMax && !utf8.FullRune(head[i:])
+		}
+		if (r < 0x20 && !strings.ContainsRune("\t\n\r\f\v\x1b", r)) || r == 0x7f {
+			return false
+		}
+		i += n
+	}
+	return true
+}
+
+func isExec(mt string) bool {
+	if mt == peMime {
+		return true
+	}
+	for _, m := range execMagic {
+		if m.mime == mt {
+			return true
+		}
+	}
+	return false
+}
+
+func textual(mt string) bool {
+	if strings.HasPrefix(mt, "text/") || strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml") {
+		return true
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript",
+		"application/x-yaml", "application/yaml", "application/x-sh", "application/sql":
+		return true
+	}
+	return false
+}
+
+// detectable: tipos que http.DetectContentType sabe producir por firma.
+// HEIC, AVIF, TIFF, QuickTime, FLAC, Matroska y compañía no están: el
+// detector los ve como octet-stream y no por eso son mentira.
+var detectable = map[string]bool{
+	"image/x-icon": true, "image/bmp": true, "image/gif": true, "image/webp": true,
+	"image/png": true, "image/jpeg": true,
+	"audio/basic": true, "audio/aiff": true, "audio/mpeg": true, "application/ogg": true,
+	"audio/midi": true, "audio/wave": true,
+	"video/avi": true, "video/mp4": true, "video/webm": true,
+	"font/ttf": true, "font/otf": true, "font/collection": true, "font/woff": true,
+	"font/woff2": true, "application/vnd.ms-fontobject": true,
+	"application/pdf": true, "application/postscript": true, "application/zip": true,
+	"application/x-gzip": true, "application/x-rar-compressed": true, "application/wasm": true,
+}
+
+// recognizable: tipos que Detect identifica por firma.
+func recognizable(mt string) bool {
+	return detectable[mt] || isExec(mt)
+}
+
+// zipBased: formatos que por dentro son un zip (OOXML, ODF, jar, epub...).
+func zipBased(mt string) bool {
+	return strings.HasSuffix(mt, "+zip") ||
+		strings.Contains(mt, "openxmlformats") ||
+		strings.Contains(mt, "opendocument") ||
+		mt == "application/java-archive" || mt == "application/epub+zip" ||
+		mt == "application/vnd.android.package-archive"
+}
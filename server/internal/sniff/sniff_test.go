@@ -0,0 +1,52 @@
+package sniff
+
+import "testing"
+
+func TestDetectAndCompatible(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	elf := []byte("\x7fELF\x02\x01\x01")
+	pe := make([]byte, 0x48)
+	copy(pe, "MZ")
+	pe[0x3c] = 0x40
+	copy(pe[0x40:], "PE\x00\x00")
+	cases := []struct {
+		name     string
+		declared string
+		head     []byte
+		want     bool
+	}{
+		{"png honesto", "image/png", png, true},
+		{"png como texto", "text/plain", png, false},
+		{"ejecutable como texto", "text/plain", elf, false},
+		{"ejecutable como octet-stream", "application/octet-stream", elf, true},
+		{"PE como texto", "text/plain", pe, false},
+		{"texto que empieza por MZ", "text/plain", []byte("MZ-1234 shipped"), true},
+		{"MZ sin cabecera PE no es ejecutable", "application/x-custom", []byte("MZ\x90\x00\x03\x00"), true},
+		{"json es texto", "application/json", []byte(`{"a":1}`), true},
+		{"markdown es texto", "text/markdown", []byte("# hola"), true},
+		{"png falso", "image/png", []byte("hola"), false},
+		{"tipo propio con bytes opacos", "application/x-custom", []byte{0, 1, 2, 3}, true},
+		{"heic", "image/heic", heicHead, true},
+		{"mov", "video/quicktime", movHead, true},
+		{"flac", "audio/flac", flacHead, true},
+		{"docx es zip", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", []byte("PK\x03\x04"), true},
+	}
+	for _, c := range cases {
+		if got := Compatible(c.declared, Detect(c.head)); got != c.want {
+			t.Errorf("%s: Compatible(%q, %q)=%v, want %v", c.name, c.declared, Detect(c.head), got, c.want)
+		}
+	}
+}
+
+// Cabeceras reales (recortadas) de formatos sin firma en DetectContentType.
+var (
+	heicHead = []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic\x00\x00\x01\x0ameta")
+	movHead  = []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x02\x00qt  \x00\x00\x00\x08wide")
+	flacHead = []byte("fLaC\x00\x00\x00\x22\x10\x00\x10\x00\x00\x00\x0e\x00\x3e\xf4\x0a\xc4\x42\xf0")
+)
+
+func TestParsePolicy(t *testing.T) {
+	if ParsePolicy("off") != Off || ParsePolicy("CORRECT") != Correct || ParsePolicy("") != Reject {
+		t.Fatal("ParsePolicy")
+	}
+}
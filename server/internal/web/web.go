@@ -0,0 +1,230 @@
+// Package web sirve un panel HTML (opt-in) para quien no tiene la CLI:
+// clips recientes, dispositivos conectados y envío de texto. Las páginas
+// se renderizan en el servidor; el único JavaScript es el botón de copiar.
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"clip-sync/server/internal/httpapi"
+	"clip-sync/server/internal/ws"
+	"clip-sync/server/pkg/types"
+)
+
+const (
+	// Device es el device_id con que el panel envía clips y firma enlaces.
+	Device = "web"
+
+	cookieName   = "clipsync_web"
+	cookieMaxAge = 12 * time.Hour
+	recentClips  = 50
+)
+
+//go:embed templates/*.html
+var files embed.FS
+
+var tmpl = template.Must(template.New("").Funcs(template.FuncMap{
+	"text":  clipText,
+	"bytes": humanBytes,
+}).ParseFS(files, "templates/*.html"))
+
+type Server struct {
+	// Auth valida el token (mismas credenciales que /ws). nil = el token es
+	// el userID.
+	Auth    func(token string) (string, bool)
+	WS      *ws.Server
+	Uploads *httpapi.UploadServer
+}
+
+// Register monta el panel bajo /web/.
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /web/{$}", s.dashboard)
+	mux.HandleFunc("GET /web/login", s.loginForm)
+	mux.HandleFunc("POST /web/login", s.login)
+	mux.HandleFunc("POST /web/logout", s.logout)
+	mux.HandleFunc("POST /web/send", s.send)
+}
+
+type dashboardData struct {
+	User    string
+	Devices []string
+	Clips   []types.Envelope
+	Sent    string
+	Error   string
+}
+
+func (s *Server) dashboard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	render(w, "dashboard.html", dashboardData{
+		User:    userID,
+		Devices: s.WS.Devices(userID),
+		Clips:   s.WS.Recent(userID, Device, recentClips),
+		Sent:    q.Get("sent"),
+		Error:   q.Get("error"),
+	})
+}
+
+func (s *Server) loginForm(w http.ResponseWriter, r *http.Request) {
+	render(w, "login.html", r.URL.Query().Get("error"))
+}
+
+// login valida el token pegado en el formulario y lo guarda en una cookie
+// HttpOnly; cada request lo vuelve a validar, así que un token HMAC
+// caducado cierra la sesión solo.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if !sameOrigin(r) {
+		http.Error(w, "cross-site request", http.StatusForbidden)
+		return
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	if _, ok := s.userID(token); !ok {
+		http.Redirect(w, r, "/web/login?error="+url.QueryEscape("invalid token"), http.StatusSeeOther)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: cookieName, Value: token, Path: "/web/",
+		MaxAge: int(cookieMaxAge / time.Second), HttpOnly: true, Secure: r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.Redirect(w, r, "/web/", http.StatusSeeOther)
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: cookieName, Path: "/web/", MaxAge: -1, HttpOnly: true})
+	http.Redirect(w, r, "/web/login", http.StatusSeeOther)
+}
+
+// send publica un clip de texto: inline si cabe y si no como blob, igual
+// que POST /api/clips.
+func (s *Server) send(w http.ResponseWriter, r *http.Request) {
+	userID, ok := s.session(w, r)
+	if !ok {
+		return
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-site request", http.StatusForbidden)
+		return
+	}
+	text := r.PostFormValue("text")
+	if text == "" {
+		back(w, r, "error", "nothing to send")
+		return
+	}
+	clip := &types.Clip{MsgID: newMsgID(), Mime: "text/plain; charset=utf-8", Size: len(text)}
+	if len(text) <= s.inlineMax() {
+		clip.Data = []byte(text)
+	} else {
+		blob, err := s.Uploads.Store(userID, clip.Mime, false, strings.NewReader(text))
+		if err != nil {
+			back(w, r, "error", err.Error())
+			return
+		}
+		clip.UploadURL, clip.SHA256 = blob.URL, blob.SHA256
+	}
+	if err := s.WS.Submit(userID, Device, clip); err != nil {
+		if id, ok := httpapi.BlobID(clip.UploadURL); ok {
+			s.Uploads.Delete(userID, id)
+		}
+		back(w, r, "error", err.Error())
+		return
+	}
+	back(w, r, "sent", clip.MsgID)
+}
+
+// session devuelve el usuario de la cookie o redirige al login.
+func (s *Server) session(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if c, err := r.Cookie(cookieName); err == nil {
+		if uid, ok := s.userID(c.Value); ok {
+			return uid, true
+		}
+	}
+	http.Redirect(w, r, "/web/login", http.StatusSeeOther)
+	return "", false
+}
+
+func (s *Server) userID(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	if s.Auth == nil {
+		return token, true
+	}
+	uid, ok := s.Auth(token)
+	return uid, ok && uid != ""
+}
+
+func (s *Server) inlineMax() int {
+	if s.WS.MaxInlineBytes > 0 {
+		return s.WS.MaxInlineBytes
+	}
+	return types.MaxInlineBytes
+}
+
+// sameOrigin rechaza formularios enviados desde otro sitio. La cookie ya
+// es SameSite=Strict; esto cubre navegadores que no lo respetan.
+func sameOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		return err == nil && u.Host == r.Host
+	}
+	return true
+}
+
+// back vuelve al panel con un aviso (Post/Redirect/Get).
+func back(w http.ResponseWriter, r *http.Request, key, msg string) {
+	http.Redirect(w, r, "/web/?"+key+"="+url.QueryEscape(msg), http.StatusSeeOther)
+}
+
+func render(w http.ResponseWriter, name string, data any) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, "template: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// clipText devuelve el texto de un clip inline de tipo text/*, o "".
+func clipText(c *types.Clip) string {
+	if c == nil || c.Data == nil || !strings.HasPrefix(c.Mime, "text/") || !utf8.Valid(c.Data) {
+		return ""
+	}
+	return string(c.Data)
+}
+
+func humanBytes(n int) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	}
+}
+
+func newMsgID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "web-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,99 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"clip-sync/server/internal/httpapi"
+	"clip-sync/server/internal/ws"
+)
+
+func newTestServer(t *testing.T) (*http.ServeMux, *ws.Server) {
+	t.Helper()
+	wss := &ws.Server{HistorySize: 10, MaxInlineBytes: 16}
+	up := &httpapi.UploadServer{Dir: t.TempDir(), MaxBytes: 1 << 20}
+	mux := http.NewServeMux()
+	(&Server{WS: wss, Uploads: up}).Register(mux)
+	return mux, wss
+}
+
+func do(mux http.Handler, method, target string, form url.Values, cookie *http.Cookie, hdr map[string]string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestDashboard_LoginSendAndList(t *testing.T) {
+	mux, wss := newTestServer(t)
+
+	if rr := do(mux, http.MethodGet, "/web/", nil, nil, nil); rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/web/login" {
+		t.Fatalf("sin sesión: status=%d loc=%q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr := do(mux, http.MethodPost, "/web/login", url.Values{"token": {"u1"}}, nil, nil)
+	cookies := rr.Result().Cookies()
+	if rr.Code != http.StatusSeeOther || len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("login: status=%d cookies=%v", rr.Code, cookies)
+	}
+	session := cookies[0]
+
+	sub, err := wss.Subscribe("u1", "laptop", 0, "test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	for _, text := range []string{"<b>hola</b>", strings.Repeat("largo ", 10)} {
+		rr = do(mux, http.MethodPost, "/web/send", url.Values{"text": {text}}, session, nil)
+		if loc := rr.Header().Get("Location"); rr.Code != http.StatusSeeOther || !strings.HasPrefix(loc, "/web/?sent=web-") {
+			t.Fatalf("send %q: status=%d loc=%q", text, rr.Code, loc)
+		}
+	}
+	if ev, ok := sub.TryNext(); !ok || ev.Env.From != Device || string(ev.Env.Clip.Data) != "<b>hola</b>" {
+		t.Fatalf("el dispositivo recibió %+v ok=%v", ev, ok)
+	}
+
+	rr = do(mux, http.MethodGet, "/web/", nil, session, nil)
+	body := rr.Body.String()
+	for _, want := range []string{"&lt;b&gt;hola&lt;/b&gt;", "<span>laptop</span>", `href="/d/`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("el panel no contiene %q", want)
+		}
+	}
+	// más nuevo primero: el clip largo (blob) antes que el texto
+	if strings.Index(body, `href="/d/`) > strings.Index(body, "&lt;b&gt;hola") {
+		t.Error("los clips no están del más nuevo al más viejo")
+	}
+}
+
+func TestDashboard_RejectsBadTokenAndCrossSite(t *testing.T) {
+	mux, _ := newTestServer(t)
+	if rr := do(mux, http.MethodPost, "/web/login", url.Values{"token": {""}}, nil, nil); len(rr.Result().Cookies()) != 0 {
+		t.Fatal("un token vacío abrió sesión")
+	}
+	session := &http.Cookie{Name: cookieName, Value: "u1"}
+	rr := do(mux, http.MethodPost, "/web/send", url.Values{"text": {"x"}}, session, map[string]string{"Sec-Fetch-Site": "cross-site"})
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("cross-site: status=%d", rr.Code)
+	}
+	rr = do(mux, http.MethodPost, "/web/send", url.Values{"text": {"x"}}, session, map[string]string{"Origin": "https://evil.example"})
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("otro origin: status=%d", rr.Code)
+	}
+}
@@ -0,0 +1,254 @@
+// Package webhook envía eventos del servidor (clips difundidos, dispositivos
+// que entran y salen, uploads nuevos) por POST a URLs externas. Cada cuerpo
+// va firmado con HMAC-SHA256; los envíos fallidos se reintentan con backoff
+// exponencial desde una cola acotada: si se llena, los eventos nuevos se
+// descartan en vez de frenar al servidor.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tipos de evento.
+const (
+	EventClip        = "clip"
+	EventDeviceJoin  = "device.join"
+	EventDeviceLeave = "device.leave"
+	EventUpload      = "upload"
+)
+
+// Cabeceras de cada envío. La firma es hex(hmac_sha256(secret,
+// timestamp + "." + cuerpo)), con el prefijo "sha256=".
+const (
+	HeaderEvent     = "X-Clipsync-Event"
+	HeaderDelivery  = "X-Clipsync-Delivery"
+	HeaderTimestamp = "X-Clipsync-Timestamp"
+	HeaderSignature = "X-Clipsync-Signature"
+)
+
+// Event es el cuerpo JSON de un envío.
+type Event struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Device string    `json:"device,omitempty"`
+	Data   any       `json:"data,omitempty"`
+}
+
+// Dispatcher reparte eventos a URLs. Hay que arrancarlo con Run.
+type Dispatcher struct {
+	URLs   []string
+	Secret string   // "" = sin firma
+	Events []string // tipos que se envían; vacío = todos
+
+	QueueSize   int           // envíos pendientes como máximo (0 = 1000)
+	Workers     int           // envíos en paralelo (0 = 4)
+	MaxAttempts int           // intentos por envío (0 = 5)
+	Backoff     time.Duration // espera tras el primer fallo, se dobla en cada uno (0 = 1s)
+	Timeout     time.Duration // por intento (0 = 10s)
+	Client      *http.Client  // nil = http.DefaultClient
+
+	// Log, si no es nil, recibe webhook_failed y webhook_dropped.
+	Log func(event string, fields map[string]any)
+
+	once    sync.Once
+	queue   chan delivery
+	metrics struct {
+		delivered, failed, retries, dropped int64
+	}
+}
+
+type delivery struct {
+	url  string
+	ev   Event
+	body []byte
+}
+
+func (d *Dispatcher) init() {
+	d.once.Do(func() { d.queue = make(chan delivery, orDefault(d.QueueSize, 1000)) })
+}
+
+// Send encola ev para cada URL sin bloquear. ID y Time se rellenan si
+// vienen vacíos.
+func (d *Dispatcher) Send(ev Event) {
+	if len(d.URLs) == 0 || (len(d.Events) > 0 && !slices.Contains(d.Events, ev.Type)) {
+		return
+	}
+	d.init()
+	if ev.ID == "" {
+		ev.ID = newID()
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	body, err := json.Marshal(ev)
+	if err != nil {
+		d.log("webhook_dropped", map[string]any{"event": ev.Type, "id": ev.ID, "err": err.Error()})
+		return
+	}
+	for _, u := range d.URLs {
+		select {
+		case d.queue <- delivery{url: u, ev: ev, body: body}:
+		default:
+			atomic.AddInt64(&d.metrics.dropped, 1)
+			d.log("webhook_dropped", map[string]any{"event": ev.Type, "id": ev.ID, "url": u, "reason": "queue full"})
+		}
+	}
+}
+
+// Run atiende la cola hasta que ctx termine. Lo que quede en ella se
+// pierde.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.init()
+	done := make(chan struct{})
+	n := orDefault(d.Workers, 4)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case dl := <-d.queue:
+					d.deliver(ctx, dl)
+				}
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-done
+	}
+}
+
+// deliver intenta el envío hasta MaxAttempts veces. Se reintenta tras un
+// error de red, un 429 o un 5xx; otro código es definitivo.
+func (d *Dispatcher) deliver(ctx context.Context, dl delivery) {
+	wait := d.Backoff
+	if wait <= 0 {
+		wait = time.Second
+	}
+	attempts := orDefault(d.MaxAttempts, 5)
+	var last string
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			atomic.AddInt64(&d.metrics.retries, 1)
+			t := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return
+			case <-t.C:
+			}
+			wait *= 2
+		}
+		code, err := d.post(ctx, dl)
+		switch {
+		case err == nil && code < 300:
+			atomic.AddInt64(&d.metrics.delivered, 1)
+			return
+		case err != nil:
+			last = err.Error()
+		default:
+			last = "status " + strconv.Itoa(code)
+		}
+		if err == nil && code != http.StatusTooManyRequests && code < 500 {
+			break
+		}
+	}
+	atomic.AddInt64(&d.metrics.failed, 1)
+	d.log("webhook_failed", map[string]any{"event": dl.ev.Type, "id": dl.ev.ID, "url": dl.url, "err": last})
+}
+
+func (d *Dispatcher) post(ctx context.Context, dl delivery) (int, error) {
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.url, bytes.NewReader(dl.body))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, dl.ev.Type)
+	req.Header.Set(HeaderDelivery, dl.ev.ID)
+	req.Header.Set(HeaderTimestamp, ts)
+	if d.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(d.Secret, ts, dl.body))
+	}
+	c := d.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Sign devuelve la firma de un envío: "sha256=" + hex(hmac_sha256(secret,
+// timestamp + "." + body)).
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify comprueba la firma de un envío recibido, para receptores en Go.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+// MetricsSnapshot devuelve los contadores para /healthz.
+func (d *Dispatcher) MetricsSnapshot() map[string]int64 {
+	d.init()
+	return map[string]int64{
+		"webhook_queue_len":       int64(len(d.queue)),
+		"webhook_delivered_total": atomic.LoadInt64(&d.metrics.delivered),
+		"webhook_failed_total":    atomic.LoadInt64(&d.metrics.failed),
+		"webhook_retries_total":   atomic.LoadInt64(&d.metrics.retries),
+		"webhook_dropped_total":   atomic.LoadInt64(&d.metrics.dropped),
+	}
+}
+
+func (d *Dispatcher) log(event string, fields map[string]any) {
+	if d.Log != nil {
+		d.Log(event, fields)
+	}
+}
+
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Known indica si name es uno de los tipos de evento.
+func Known(name string) bool {
+	return slices.Contains([]string{EventClip, EventDeviceJoin, EventDeviceLeave, EventUpload}, name)
+}
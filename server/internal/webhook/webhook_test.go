@@ -0,0 +1,89 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_SignsAndRetries(t *testing.T) {
+	var calls int32
+	got := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify("s3cr3t", r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			t.Errorf("firma inválida: %q", r.Header.Get(HeaderSignature))
+		}
+		// los dos primeros intentos fallan
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var ev Event
+		_ = json.Unmarshal(body, &ev)
+		got <- ev
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{URLs: []string{srv.URL}, Secret: "s3cr3t", Backoff: time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+	d.Send(Event{Type: EventClip, User: "u1", Device: "A"})
+
+	select {
+	case ev := <-got:
+		if ev.Type != EventClip || ev.User != "u1" || ev.ID == "" {
+			t.Fatalf("evento: %+v", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no llegó el evento")
+	}
+	waitMetric(t, d, "webhook_delivered_total", 1)
+	if m := d.MetricsSnapshot(); m["webhook_retries_total"] != 2 || m["webhook_failed_total"] != 0 {
+		t.Fatalf("métricas: %v", m)
+	}
+}
+
+func TestDispatcher_GivesUpAndDrops(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	d := &Dispatcher{URLs: []string{srv.URL}, QueueSize: 1, Backoff: time.Millisecond, Events: []string{EventUpload}}
+	// sin Run la cola no se vacía: el segundo evento no cabe
+	d.Send(Event{Type: EventUpload, User: "u1"})
+	d.Send(Event{Type: EventUpload, User: "u1"})
+	d.Send(Event{Type: EventClip, User: "u1"}) // filtrado, no cuenta
+	if m := d.MetricsSnapshot(); m["webhook_dropped_total"] != 1 || m["webhook_queue_len"] != 1 {
+		t.Fatalf("métricas: %v", m)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+	waitMetric(t, d, "webhook_failed_total", 1)
+	// un 400 no se reintenta
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("intentos = %d, quiero 1", n)
+	}
+}
+
+func waitMetric(t *testing.T, d *Dispatcher, name string, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for d.MetricsSnapshot()[name] != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %d, quiero %d", name, d.MetricsSnapshot()[name], want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"clip-sync/server/internal/channel"
+	"clip-sync/server/pkg/types"
+)
+
+// Canales compartidos: además de su sala personal, un dispositivo puede
+// recibir los clips de los canales de los que su usuario es miembro
+// (channel.Registry decide quién lee y quién escribe). Los clips de canal
+// llevan clip.channel y envelope.user, y no se reanudan por seq: el número
+// de secuencia de un transporte es el del historial del usuario.
+
+// member es un dispositivo suscrito a un canal.
+type member struct {
+	user, device string
+}
+
+// joinChannels suscribe p a los canales de names que userID puede leer y
+// devuelve los que quedaron; los demás se ignoran.
+func (s *Server) joinChannels(userID, deviceID string, p peer, names []string) []string {
+	if s.Channels == nil || len(names) == 0 {
+		return nil
+	}
+	var joined, denied []string
+	s.mu.Lock()
+	for _, name := range names {
+		if s.Channels.Role(name, userID) < channel.Reader {
+			denied = append(denied, name)
+			continue
+		}
+		if s.chans == nil {
+			s.chans = make(map[string]map[member]peer)
+		}
+		if s.chans[name] == nil {
+			s.chans[name] = make(map[member]peer)
+		}
+		s.chans[name][member{userID, deviceID}] = p
+		joined = append(joined, name)
+	}
+	s.mu.Unlock()
+	if len(denied) > 0 {
+		s.log("ws_channel_denied", map[string]any{
+			"user_id": userID, "device_id": deviceID, "channels": denied,
+		})
+	}
+	return joined
+}
+
+// leaveChannelsLocked quita p de todos sus canales; el llamador tiene s.mu.
+func (s *Server) leaveChannelsLocked(m member, p peer) {
+	for name, subs := range s.chans {
+		if subs[m] == p {
+			delete(subs, m)
+			if len(subs) == 0 {
+				delete(s.chans, name)
+			}
+		}
+	}
+}
+
+// broadcastChannel envía env a los dispositivos suscritos a name salvo al
+// emisor. Quien dejó de ser miembro no recibe aunque siga suscrito.
+func (s *Server) broadcastChannel(name string, from member, env types.Envelope) {
+	type target struct {
+		m member
+		p peer
+	}
+	var targets []target
+	s.mu.RLock()
+	for m, p := range s.chans[name] {
+		if m == from || s.Channels.Role(name, m.user) < channel.Reader {
+			continue
+		}
+		targets = append(targets, target{m, p})
+	}
+	s.mu.RUnlock()
+
+	if s.OnDeliver != nil && env.Clip != nil {
+		devs := make([]string, 0, len(targets))
+		for _, t := range targets {
+			devs = append(devs, t.m.device)
+		}
+		s.OnDeliver(from.user, env.Clip, devs)
+	}
+	for _, t := range targets {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		// PrepareClip con el emisor: las URLs se firman si el blob es suyo
+		if err := t.p.send(ctx, s.prepareFor(from.user, env, t.m.device), 0); err != nil {
+			atomic.AddInt64(&s.metrics.drops, 1)
+			s.incDeviceDrop(t.m.user, t.m.device)
+			atomic.AddInt64(&t.p.stats().drops, 1)
+			s.log("ws_drop_backpressure", map[string]any{
+				"user_id": t.m.user, "device_id": t.m.device, "channel": name, "error": err.Error(),
+			})
+		}
+		cancel()
+	}
+}
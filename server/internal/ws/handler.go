@@ -2,18 +2,23 @@ package ws
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
     "regexp"
+	"slices"
+    "sort"
     "strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"clip-sync/server/internal/channel"
 	"clip-sync/server/internal/hub"
+	"clip-sync/server/internal/sniff"
 	"clip-sync/server/pkg/types"
 
 	"github.com/coder/websocket"
-	"github.com/coder/websocket/wsjson"
 )
 
 /* -------- rate limit -------- */
@@ -79,18 +84,90 @@ func (d *dedupeCache) ExistsOrAdd(id string) bool {
 	}
 	return false
 }
+func (d *dedupeCache) Remove(id string) {
+	if _, ok := d.set[id]; !ok {
+		return
+	}
+	delete(d.set, id)
+	if i := slices.Index(d.keys, id); i >= 0 {
+		d.keys = append(d.keys[:i], d.keys[i+1:]...)
+	}
+}
 
 type Server struct {
 	Hub                *hub.Hub
 	Auth               func(token string) (string, bool)
 	MaxInlineBytes     int
 	RateLimitPerSecond int
+	// SniffPolicy compara el mime declarado de clips inline con sus magic
+	// bytes (zero value = sniff.Off).
+	SniffPolicy sniff.Policy
 
 	// logger: si es nil, no loggea
 	Log func(event string, fields map[string]any)
 
+	// PrepareClip ajusta la copia del clip que recibe cada destinatario
+	// (firmar upload_url, añadir thumb_url...). nil = se envía tal cual.
+	PrepareClip func(userID, deviceID string, clip *types.Clip)
+
+	// OnDeliver se invoca con los dispositivos destino justo antes de
+	// enviarles un clip (p. ej. para armar blobs burn-after-read).
+	OnDeliver func(userID string, clip *types.Clip, devices []string)
+
+	// AcceptClip decide si un clip válido se difunde (p. ej. solo si su
+	// blob pasó el antivirus). nil = se aceptan todos.
+	AcceptClip func(userID string, clip *types.Clip) bool
+
+	// ContentPolicy revisa un clip ya aceptado antes de difundirlo: puede
+	// cambiarlo (p. ej. redactar secretos) o bloquearlo devolviendo false.
+	// nil = sin política de contenido.
+	ContentPolicy func(userID string, clip *types.Clip) bool
+
+	// Processors es la cadena por la que pasa cada clip antes de
+	// difundirse. nil = DefaultProcessors(); para añadir etapas propias se
+	// parte de esa lista.
+	Processors []ClipProcessor
+
+	// OnClip recibe cada clip difundido (a los dispositivos propios o a un
+	// canal) tal como salió del pipeline. No debe cambiarlo ni bloquear.
+	OnClip func(userID, deviceID string, clip *types.Clip)
+
+	// OnConnect y OnDisconnect avisan de que un dispositivo entra o sale,
+	// sea cual sea el transporte. Una reconexión que sustituye a la
+	// conexión anterior no cuenta como ninguna de las dos.
+	OnConnect    func(userID, deviceID, transport string)
+	OnDisconnect func(userID, deviceID string)
+
+	// OnRecall recibe el clip original de un recall (si sigue en el
+	// historial), o el de una oferta rechazada o caducada, para liberar lo
+	// asociado, p. ej. su blob.
+	OnRecall func(userID string, clip *types.Clip)
+
+	// HistorySize: clips recientes recordados por usuario (0 = ninguno;
+	// sin historial un recall solo se reenvía).
+	HistorySize int
+
+	// Channels da acceso a los canales compartidos. nil = sin canales.
+	Channels *channel.Registry
+
+	// OfferTTL: cuánto espera un clip en la bandeja de otro usuario (0 =
+	// 24h). InboxSize: ofertas pendientes por destinatario (0 = 100).
+	// OffersPerSender: pendientes de un mismo emisor entre todas las
+	// bandejas (0 = 100). MaxInboxes: bandejas con ofertas en total (0 =
+	// 10000).
+	OfferTTL        time.Duration
+	InboxSize       int
+	OffersPerSender int
+	MaxInboxes      int
+
+	// KnownRecipient decide si from puede ofrecer clips a to. nil = a
+	// cualquier usuario que se haya conectado desde el arranque.
+	KnownRecipient func(from, to string) bool
+
 	mu    sync.RWMutex
-	conns map[string]map[string]*websocket.Conn // userID -> deviceID -> conn
+	conns map[string]map[string]peer // userID -> deviceID -> conexión (ws, sse...)
+	seen  map[string]bool            // usuarios que se conectaron alguna vez
+	chans map[string]map[member]peer // canal -> suscriptores
 
 	rlmu sync.Mutex
 	rl   map[string]*limiter // key: userID|deviceID
@@ -107,6 +184,13 @@ type Server struct {
 	// backpressure visible: drops por device (userID|deviceID)
 	dropsMu        sync.Mutex
 	dropsByDevice  map[string]int64
+
+	inboxMu sync.Mutex
+	inbox   map[string][]*offer // userID destinatario -> ofertas pendientes
+	offered map[string]int      // userID emisor -> ofertas pendientes
+
+	histMu sync.Mutex
+	hist   map[room]*history // usuario o canal -> últimos clips
 }
 
 var deviceIDRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
@@ -132,18 +216,13 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer c.Close(websocket.StatusNormalClosure, "")
 
 	var userID, deviceID string
-
-	s.mu.Lock()
-	if s.conns == nil {
-		s.conns = make(map[string]map[string]*websocket.Conn)
-	}
-	s.mu.Unlock()
+	p := &wsPeer{c: c, st: newStats("ws", r.RemoteAddr)}
 
 	for {
-		var env types.Envelope
-		if err := wsjson.Read(r.Context(), c, &env); err != nil {
+		env, err := p.read(r.Context())
+		if err != nil {
 			if userID != "" && deviceID != "" {
-				s.removeConn(userID, deviceID)
+				s.removeConn(userID, deviceID, p)
 			}
 			return
 		}
@@ -168,51 +247,38 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 			userID, deviceID = uid, dev
-			s.addConn(uid, dev, c)
-			s.log("ws_hello", map[string]any{"user_id": uid, "device_id": dev})
+			s.addConn(uid, dev, p)
+			joined := s.joinChannels(uid, dev, p, env.Hello.Channels)
+			s.log("ws_hello", map[string]any{"user_id": uid, "device_id": dev, "channels": joined})
+			for _, o := range s.pendingOffers(uid) {
+				_ = p.send(r.Context(), o, 0)
+			}
 
 		case "clip":
 			if env.Clip == nil {
 				continue
 			}
-			clip := env.Clip
-			// 1) validar
-			if !s.validateClip(clip) {
-				atomic.AddInt64(&s.metrics.drops, 1)
-				s.log("ws_drop_invalid", map[string]any{
-					"user_id": userID, "device_id": deviceID, "msg_id": clip.MsgID,
-				})
+			_ = s.submit(userID, deviceID, env.Clip)
+
+		case "recall":
+			if env.Recall == nil || userID == "" {
 				continue
 			}
-			// 2) dedupe
-			if s.isDup(userID, clip.MsgID) {
-				atomic.AddInt64(&s.metrics.drops, 1)
-				s.log("ws_drop_dup", map[string]any{
-					"user_id": userID, "device_id": deviceID, "msg_id": clip.MsgID,
-				})
+			_ = s.Recall(userID, deviceID, env.Recall.Channel, env.Recall.MsgID)
+
+		case "accept":
+			if env.Offer == nil || userID == "" {
 				continue
 			}
-			// 3) rate limit
-			if !s.allow(userID, deviceID) {
-				atomic.AddInt64(&s.metrics.drops, 1)
-				s.log("ws_drop_rate", map[string]any{
-					"user_id": userID, "device_id": deviceID, "msg_id": clip.MsgID,
-				})
-				continue
+			if out, err := s.Accept(userID, deviceID, env.Offer.ID); err == nil {
+				_ = p.send(r.Context(), out, 0)
 			}
-			atomic.AddInt64(&s.metrics.clips, 1)
 
-			out := types.Envelope{
-				Type: "clip",
-				From: deviceID,
-				Clip: clip,
+		case "reject":
+			if env.Offer == nil || userID == "" {
+				continue
 			}
-			s.broadcast(userID, deviceID, out)
-			s.log("ws_clip", map[string]any{
-				"user_id": userID, "device_id": deviceID, "msg_id": clip.MsgID,
-				"mime": clip.Mime, "size": clip.Size, "has_data": len(clip.Data) > 0,
-				"has_url": clip.UploadURL != "",
-			})
+			_ = s.Reject(userID, deviceID, env.Offer.ID)
 
 		default:
 			// ignore
@@ -220,6 +286,41 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// recall olvida msgID, avisa a OnRecall con el clip original si se conoce
+// y reenvía el recall al resto de dispositivos, que pueden tenerlo aunque
+// el server ya no lo recuerde. En un canal solo se reenvía si el clip está
+// en su historial y lo mandó quien lo retira (o lo retira un owner): un
+// writer no puede borrar del portapapeles ajeno lo que no envió.
+func (s *Server) recall(userID, deviceID, channelName, msgID string) {
+	rm, sender := userRoom(userID), ""
+	if channelName != "" {
+		rm = chanRoom(channelName)
+		if s.Channels.Role(channelName, userID) < channel.Owner {
+			sender = userID
+		}
+	}
+	orig := s.forget(rm, msgID, sender)
+	if orig != nil && s.OnRecall != nil {
+		s.OnRecall(userID, orig.Clip)
+	}
+	env := types.Envelope{
+		Type:   "recall",
+		From:   deviceID,
+		Recall: &types.Recall{MsgID: msgID, Channel: channelName},
+	}
+	switch {
+	case channelName == "":
+		s.broadcast(userID, deviceID, env, 0)
+	case orig != nil:
+		env.User = userID
+		s.broadcastChannel(channelName, member{userID, deviceID}, env)
+	}
+	s.log("ws_recall", map[string]any{
+		"user_id": userID, "device_id": deviceID, "channel": channelName,
+		"msg_id": msgID, "known": orig != nil,
+	})
+}
+
 func (s *Server) isDup(userID, msgID string) bool {
 	if s.ddcap <= 0 || msgID == "" {
 		return false
@@ -238,6 +339,16 @@ func (s *Server) isDup(userID, msgID string) bool {
 	return hit
 }
 
+// forgetDup quita msgID del dedupe de userID: lo anotó un clip que al final
+// no se difundió, y su reintento no es un duplicado.
+func (s *Server) forgetDup(userID, msgID string) {
+	s.ddmu.Lock()
+	if d := s.dd[userID]; d != nil {
+		d.Remove(msgID)
+	}
+	s.ddmu.Unlock()
+}
+
 func (s *Server) allow(userID, deviceID string) bool {
 	if s.RateLimitPerSecond <= 0 {
 		return true
@@ -256,31 +367,70 @@ func (s *Server) allow(userID, deviceID string) bool {
 	return lim.allow()
 }
 
-func (s *Server) addConn(userID, deviceID string, c *websocket.Conn) {
+// addConn registra p como la conexión de deviceID. Si el dispositivo ya
+// estaba conectado, la nueva sustituye a la anterior.
+func (s *Server) addConn(userID, deviceID string, p peer) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	if s.conns == nil {
+		s.conns = make(map[string]map[string]peer)
+	}
 	if s.conns[userID] == nil {
-		s.conns[userID] = make(map[string]*websocket.Conn)
+		s.conns[userID] = make(map[string]peer)
+	}
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	s.seen[userID] = true
+	old, replaced := s.conns[userID][deviceID]
+	if !replaced {
+		atomic.AddInt64(&s.metrics.conns, 1)
+	} else {
+		s.leaveChannelsLocked(member{userID, deviceID}, old)
+	}
+	s.conns[userID][deviceID] = p
+	s.mu.Unlock()
+	if !replaced && s.OnConnect != nil {
+		s.OnConnect(userID, deviceID, p.stats().transport)
 	}
-	s.conns[userID][deviceID] = c
-	atomic.AddInt64(&s.metrics.conns, 1)
 }
 
-func (s *Server) removeConn(userID, deviceID string) {
+// removeConn quita p si sigue siendo la conexión de deviceID (una
+// reconexión pudo sustituirla).
+func (s *Server) removeConn(userID, deviceID string, p peer) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	removed := false
 	if m := s.conns[userID]; m != nil {
-		if _, ok := m[deviceID]; ok {
+		if cur, ok := m[deviceID]; ok && cur == p {
 			delete(m, deviceID)
 			atomic.AddInt64(&s.metrics.conns, -1)
+			s.leaveChannelsLocked(member{userID, deviceID}, p)
+			removed = true
 		}
 		if len(m) == 0 {
 			delete(s.conns, userID)
 		}
 	}
+	s.mu.Unlock()
+	if removed && s.OnDisconnect != nil {
+		s.OnDisconnect(userID, deviceID)
+	}
 }
 
-func (s *Server) broadcast(userID, fromDevice string, env types.Envelope) {
+// Devices devuelve los dispositivos conectados de userID, ordenados.
+func (s *Server) Devices(userID string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.conns[userID]))
+	for dev := range s.conns[userID] {
+		out = append(out, dev)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// broadcast envía env a los demás dispositivos de userID. seq es su número
+// en el historial (0 = no se guardó), para los transportes que reanudan.
+func (s *Server) broadcast(userID, fromDevice string, env types.Envelope, seq int64) {
 	buildTargets := func() [][2]interface{} {
 		s.mu.RLock()
 		defer s.mu.RUnlock()
@@ -301,15 +451,23 @@ func (s *Server) broadcast(userID, fromDevice string, env types.Envelope) {
 		time.Sleep(50 * time.Millisecond)
 		targets = buildTargets()
 	}
+	if s.OnDeliver != nil && env.Clip != nil {
+		devs := make([]string, 0, len(targets))
+		for _, pair := range targets {
+			devs = append(devs, pair[0].(string))
+		}
+		s.OnDeliver(userID, env.Clip, devs)
+	}
 
 	for _, pair := range targets {
 		dev := pair[0].(string)
-		c := pair[1].(*websocket.Conn)
+		p := pair[1].(peer)
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-		if err := wsjson.Write(ctx, c, env); err != nil {
+		if err := p.send(ctx, s.prepareFor(userID, env, dev), seq); err != nil {
 			// contar como drop por backpressure/error de escritura
 			atomic.AddInt64(&s.metrics.drops, 1)
 			s.incDeviceDrop(userID, dev)
+			atomic.AddInt64(&p.stats().drops, 1)
 			s.log("ws_drop_backpressure", map[string]any{
 				"user_id": userID, "device_id": dev, "error": err.Error(),
 			})
@@ -318,6 +476,17 @@ func (s *Server) broadcast(userID, fromDevice string, env types.Envelope) {
 	}
 }
 
+// prepareFor devuelve una copia del envelope ajustada para dev por PrepareClip.
+func (s *Server) prepareFor(userID string, env types.Envelope, dev string) types.Envelope {
+	if s.PrepareClip == nil || env.Clip == nil {
+		return env
+	}
+	cl := *env.Clip
+	s.PrepareClip(userID, dev, &cl)
+	env.Clip = &cl
+	return env
+}
+
 func (s *Server) incDeviceDrop(userID, deviceID string) {
 	key := userID + "|" + deviceID
 	s.dropsMu.Lock()
@@ -332,9 +501,22 @@ func (s *Server) validateClip(c *types.Clip) bool {
 	if c == nil {
 		return false
 	}
+	// burn-after-read cuenta dispositivos de un solo usuario
+	if (c.Channel != "" || c.To != "") && c.Burn {
+		return false
+	}
+	if c.Channel != "" && c.To != "" {
+		return false
+	}
 	if c.Mime == "" {
 		c.Mime = "application/octet-stream"
 	}
+	if c.SHA256 != "" {
+		if b, err := hex.DecodeString(c.SHA256); err != nil || len(b) != sha256.Size {
+			return false
+		}
+		c.SHA256 = strings.ToLower(c.SHA256)
+	}
 	if len(c.Data) > 0 {
 		if len(c.Data) != c.Size {
 			return false
@@ -342,6 +524,21 @@ func (s *Server) validateClip(c *types.Clip) bool {
 		if s.MaxInlineBytes > 0 && c.Size > s.MaxInlineBytes {
 			return false
 		}
+		if s.SniffPolicy != sniff.Off {
+			detected := sniff.Detect(c.Data[:min(len(c.Data), sniff.HeadSize)])
+			if !sniff.Compatible(c.Mime, detected) {
+				if s.SniffPolicy == sniff.Reject {
+					return false
+				}
+				c.Mime = detected
+			}
+		}
+		if c.SHA256 != "" {
+			sum := sha256.Sum256(c.Data)
+			if hex.EncodeToString(sum[:]) != c.SHA256 {
+				return false
+			}
+		}
 		return true
 	}
 	if c.UploadURL == "" || c.Size <= 0 {
@@ -368,18 +565,18 @@ func (s *Server) MetricsSnapshot() map[string]int64 {
 // Graceful shutdown
 func (s *Server) Shutdown(ctx context.Context) {
 	s.mu.Lock()
-	var list []*websocket.Conn
+	var list []peer
 	for _, devs := range s.conns {
-		for _, c := range devs {
-			list = append(list, c)
+		for _, p := range devs {
+			list = append(list, p)
 		}
 	}
 	total := int64(len(list))
-	s.conns = make(map[string]map[string]*websocket.Conn)
+	s.conns = make(map[string]map[string]peer)
 	atomic.AddInt64(&s.metrics.conns, -total)
 	s.mu.Unlock()
 
-	for _, c := range list {
-		_ = c.Close(websocket.StatusNormalClosure, "server_shutdown")
+	for _, p := range list {
+		p.close("server_shutdown")
 	}
 }
@@ -0,0 +1,116 @@
+package ws
+
+import "clip-sync/server/pkg/types"
+
+// Historial: los últimos HistorySize clips de cada usuario (y de cada
+// canal), con un número de secuencia creciente por historial. Permite
+// resolver un recall a su clip.
+
+// room identifica un historial: el de un usuario o el de un canal. Con una
+// clave compuesta un usuario no puede llamarse como un canal y leerlo.
+type room struct {
+	user, channel string
+}
+
+func userRoom(userID string) room { return room{user: userID} }
+func chanRoom(name string) room   { return room{channel: name} }
+
+type histEntry struct {
+	Seq int64
+	Env types.Envelope
+}
+
+type history struct {
+	seq     int64
+	entries []histEntry
+}
+
+// record guarda env en el historial rm y devuelve su número de
+// secuencia (0 sin historial). De los clips burn solo se guardan los
+// metadatos: su contenido no debe sobrevivir en memoria.
+func (s *Server) record(rm room, env types.Envelope) int64 {
+	if s.HistorySize <= 0 || env.Clip == nil {
+		return 0
+	}
+	cl := *env.Clip
+	if cl.Burn {
+		cl.Data = nil
+	}
+	env.Clip = &cl
+
+	s.histMu.Lock()
+	defer s.histMu.Unlock()
+	if s.hist == nil {
+		s.hist = make(map[room]*history)
+	}
+	h := s.hist[rm]
+	if h == nil {
+		h = &history{}
+		s.hist[rm] = h
+	}
+	h.seq++
+	h.entries = append(h.entries, histEntry{Seq: h.seq, Env: env})
+	if over := len(h.entries) - s.HistorySize; over > 0 {
+		h.entries = append(h.entries[:0], h.entries[over:]...)
+	}
+	return h.seq
+}
+
+// since devuelve una copia de las entradas de rm posteriores a seq.
+func (s *Server) since(rm room, seq int64) []histEntry {
+	s.histMu.Lock()
+	defer s.histMu.Unlock()
+	h := s.hist[rm]
+	if h == nil {
+		return nil
+	}
+	var out []histEntry
+	for _, e := range h.entries {
+		if e.Seq > seq {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// lastSeq devuelve la última secuencia asignada en rm (0 si no hay).
+func (s *Server) lastSeq(rm room) int64 {
+	s.histMu.Lock()
+	defer s.histMu.Unlock()
+	if h := s.hist[rm]; h != nil {
+		return h.seq
+	}
+	return 0
+}
+
+// forget quita msgID del historial rm y devuelve su envelope, o nil si no
+// estaba. Si sender no es "", solo lo quita si lo envió ese usuario.
+func (s *Server) forget(rm room, msgID, sender string) *types.Envelope {
+	s.histMu.Lock()
+	defer s.histMu.Unlock()
+	h := s.hist[rm]
+	if h == nil {
+		return nil
+	}
+	for i, e := range h.entries {
+		if e.Env.Clip.MsgID == msgID {
+			if sender != "" && e.Env.User != sender {
+				return nil
+			}
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+			return &e.Env
+		}
+	}
+	return nil
+}
+
+// Recent devuelve hasta n clips del historial de userID, del más nuevo al
+// más viejo, preparados (URLs firmadas...) como si fueran para deviceID.
+func (s *Server) Recent(userID, deviceID string, n int) []types.Envelope {
+	entries := s.since(userRoom(userID), 0)
+	out := make([]types.Envelope, 0, min(n, len(entries)))
+	for i := len(entries) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, s.prepareFor(userID, entries[i].Env, deviceID))
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package ws
+
+import (
+	"testing"
+
+	"clip-sync/server/pkg/types"
+)
+
+func TestHistory_TrimAndForget(t *testing.T) {
+	s := Server{HistorySize: 2}
+	for _, id := range []string{"m1", "m2", "m3"} {
+		s.record(userRoom("u1"), types.Envelope{Type: "clip", Clip: &types.Clip{MsgID: id, Data: []byte(id)}})
+	}
+	s.record(userRoom("u1"), types.Envelope{Type: "clip", Clip: &types.Clip{MsgID: "b", Data: []byte("x"), Burn: true}})
+
+	if s.forget(userRoom("u1"), "m2", "") != nil {
+		t.Fatal("m2 debió salir del historial al recortar")
+	}
+	if c := s.forget(userRoom("u1"), "b", ""); c == nil || c.Clip.Data != nil {
+		t.Fatalf("burn: clip=%+v, want sin data", c)
+	}
+	if c := s.forget(userRoom("u1"), "m3", ""); c == nil || string(c.Clip.Data) != "m3" {
+		t.Fatalf("m3: clip=%+v", c)
+	}
+	if s.forget(userRoom("u1"), "m3", "") != nil || s.forget(userRoom("u2"), "m3", "") != nil {
+		t.Fatal("forget debe quitarlo y no ver otros usuarios")
+	}
+}
+
+// Tras reiniciar el server la secuencia vuelve a 1: un Last-Event-ID de
+// antes del reinicio no debe tapar los clips nuevos.
+func TestSubscribe_AfterBeyondHistory(t *testing.T) {
+	s := &Server{HistorySize: 10}
+	sub, err := s.Subscribe("u1", "P", 40, "sse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	clip := &types.Clip{MsgID: "m1", Mime: "text/plain", Size: 4, Data: []byte("hola")}
+	if err := s.Submit("u1", "A", clip); err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := sub.TryNext()
+	if !ok || ev.Seq != 1 || ev.Env.Clip.MsgID != "m1" {
+		t.Fatalf("se perdió el clip nuevo: %+v ok=%v", ev, ok)
+	}
+}
@@ -0,0 +1,266 @@
+package ws
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"clip-sync/server/pkg/types"
+)
+
+// Bandeja de entrada: un clip con clip.to es para otro usuario. No se
+// difunde ni se aplica: queda en la bandeja del destinatario, cuyos
+// dispositivos reciben solo un "offer" con los metadatos, hasta que uno lo
+// acepta (y recibe el clip) o lo rechaza. El emisor se entera del
+// resultado por "offer_result", igual que si caduca.
+
+const (
+	defaultOfferTTL        = 24 * time.Hour
+	defaultInboxSize       = 100
+	defaultOffersPerSender = 100
+	defaultMaxInboxes      = 10000
+)
+
+// Estados de una oferta (Offer.Status).
+const (
+	OfferPending  = "pending"
+	OfferAccepted = "accepted"
+	OfferRejected = "rejected"
+	OfferExpired  = "expired"
+)
+
+var (
+	ErrInboxFull        = errors.New("recipient inbox is full")
+	ErrTooManyOffers    = errors.New("too many pending offers")
+	ErrUnknownRecipient = errors.New("unknown recipient")
+	ErrNoOffer          = errors.New("no such offer")
+)
+
+type offer struct {
+	id         string
+	from       string // userID del emisor
+	fromDevice string
+	to         string
+	clip       *types.Clip
+	created    time.Time
+}
+
+// public devuelve la oferta sin el contenido del clip: ni data ni URLs,
+// que darían acceso al blob antes de aceptarla.
+func (o *offer) public(status string) *types.Offer {
+	meta := *o.clip
+	meta.Data, meta.UploadURL, meta.ThumbURL, meta.ExpiresAt = nil, "", "", 0
+	return &types.Offer{ID: o.id, From: o.from, To: o.to, Clip: &meta, Status: status}
+}
+
+func (o *offer) envelope() types.Envelope {
+	return types.Envelope{Type: "offer", From: o.fromDevice, User: o.from, Offer: o.public(OfferPending)}
+}
+
+func (s *Server) offerTTL() time.Duration {
+	if s.OfferTTL > 0 {
+		return s.OfferTTL
+	}
+	return defaultOfferTTL
+}
+
+// unsent descuenta o de las pendientes de su emisor. Con inboxMu tomado.
+func (s *Server) unsent(o *offer) {
+	if s.offered[o.from]--; s.offered[o.from] <= 0 {
+		delete(s.offered, o.from)
+	}
+}
+
+func orDefault(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// knownRecipient indica si userID puede dejar clips en la bandeja de to.
+func (s *Server) knownRecipient(userID, to string) bool {
+	if s.KnownRecipient != nil {
+		return s.KnownRecipient(userID, to)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seen[to]
+}
+
+// offer deja clip (ya validado) en la bandeja de clip.To y avisa a sus
+// dispositivos conectados.
+func (s *Server) offer(userID, deviceID string, clip *types.Clip) error {
+	if !s.knownRecipient(userID, clip.To) {
+		s.log("ws_drop_unknown_recipient", map[string]any{
+			"user_id": userID, "device_id": deviceID, "to": clip.To, "msg_id": clip.MsgID,
+		})
+		return ErrUnknownRecipient
+	}
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	o := &offer{
+		id: hex.EncodeToString(b), from: userID, fromDevice: deviceID, to: clip.To,
+		clip: clip, created: time.Now(),
+	}
+	s.inboxMu.Lock()
+	var err error
+	switch {
+	case len(s.inbox[o.to]) >= orDefault(s.InboxSize, defaultInboxSize):
+		err = ErrInboxFull
+	case s.inbox[o.to] == nil && len(s.inbox) >= orDefault(s.MaxInboxes, defaultMaxInboxes):
+		err = ErrInboxFull
+	case s.offered[userID] >= orDefault(s.OffersPerSender, defaultOffersPerSender):
+		err = ErrTooManyOffers
+	}
+	if err != nil {
+		s.inboxMu.Unlock()
+		atomic.AddInt64(&s.metrics.drops, 1)
+		event := "ws_drop_inbox_full"
+		if err == ErrTooManyOffers {
+			event = "ws_drop_too_many_offers"
+		}
+		s.log(event, map[string]any{
+			"user_id": userID, "device_id": deviceID, "to": o.to, "msg_id": clip.MsgID,
+		})
+		return err
+	}
+	if s.inbox == nil {
+		s.inbox = make(map[string][]*offer)
+		s.offered = make(map[string]int)
+	}
+	s.inbox[o.to] = append(s.inbox[o.to], o)
+	s.offered[userID]++
+	s.inboxMu.Unlock()
+
+	// el blob queda referenciado mientras la oferta espera
+	if s.OnDeliver != nil {
+		s.OnDeliver(userID, clip, nil)
+	}
+	s.broadcast(o.to, "", o.envelope(), 0)
+	s.log("ws_offer", map[string]any{
+		"user_id": userID, "device_id": deviceID, "to": o.to, "offer_id": o.id, "msg_id": clip.MsgID,
+	})
+	return nil
+}
+
+// Offers devuelve las ofertas pendientes de userID, de la más vieja a la
+// más nueva.
+func (s *Server) Offers(userID string) []types.Offer {
+	s.inboxMu.Lock()
+	defer s.inboxMu.Unlock()
+	out := make([]types.Offer, 0, len(s.inbox[userID]))
+	for _, o := range s.inbox[userID] {
+		out = append(out, *o.public(OfferPending))
+	}
+	return out
+}
+
+func (s *Server) pendingOffers(userID string) []types.Envelope {
+	s.inboxMu.Lock()
+	defer s.inboxMu.Unlock()
+	var out []types.Envelope
+	for _, o := range s.inbox[userID] {
+		out = append(out, o.envelope())
+	}
+	return out
+}
+
+// Accept acepta la oferta id de la bandeja de userID desde deviceID y
+// devuelve el clip preparado para ese dispositivo.
+func (s *Server) Accept(userID, deviceID, id string) (types.Envelope, error) {
+	o := s.take(userID, id)
+	if o == nil {
+		return types.Envelope{}, ErrNoOffer
+	}
+	s.settle(o, deviceID, OfferAccepted)
+	env := types.Envelope{Type: "clip", From: o.fromDevice, User: o.from, Clip: o.clip}
+	// PrepareClip con el emisor: la URL se firma si el blob es suyo
+	return s.prepareFor(o.from, env, deviceID), nil
+}
+
+// Reject rechaza la oferta id de la bandeja de userID.
+func (s *Server) Reject(userID, deviceID, id string) error {
+	o := s.take(userID, id)
+	if o == nil {
+		return ErrNoOffer
+	}
+	s.settle(o, deviceID, OfferRejected)
+	return nil
+}
+
+// ExpireOffers da por caducadas las ofertas de más de OfferTTL.
+func (s *Server) ExpireOffers(now time.Time) {
+	var expired []*offer
+	s.inboxMu.Lock()
+	for user, list := range s.inbox {
+		kept := list[:0]
+		for _, o := range list {
+			if now.Sub(o.created) > s.offerTTL() {
+				expired = append(expired, o)
+				s.unsent(o)
+			} else {
+				kept = append(kept, o)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.inbox, user)
+		} else {
+			s.inbox[user] = kept
+		}
+	}
+	s.inboxMu.Unlock()
+	for _, o := range expired {
+		s.settle(o, "", OfferExpired)
+	}
+}
+
+// RunJanitor ejecuta ExpireOffers periódicamente hasta que ctx termine.
+func (s *Server) RunJanitor(ctx context.Context, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.ExpireOffers(now)
+		}
+	}
+}
+
+// take quita id de la bandeja de userID y lo devuelve (nil si no está).
+func (s *Server) take(userID, id string) *offer {
+	s.inboxMu.Lock()
+	defer s.inboxMu.Unlock()
+	list := s.inbox[userID]
+	for i, o := range list {
+		if o.id == id {
+			s.unsent(o)
+			s.inbox[userID] = append(list[:i], list[i+1:]...)
+			if len(s.inbox[userID]) == 0 {
+				delete(s.inbox, userID)
+			}
+			return o
+		}
+	}
+	return nil
+}
+
+// settle cierra una oferta: avisa al emisor y a los demás dispositivos
+// del destinatario (para que la quiten de su lista) y, si el clip no se
+// entregó, libera lo asociado como un recall.
+func (s *Server) settle(o *offer, deviceID, status string) {
+	result := types.Envelope{Type: "offer_result", From: deviceID, User: o.to, Offer: o.public(status)}
+	s.broadcast(o.from, "", result, 0)
+	s.broadcast(o.to, deviceID, result, 0)
+	if status != OfferAccepted && s.OnRecall != nil {
+		s.OnRecall(o.from, o.clip)
+	}
+	s.log("ws_offer_"+status, map[string]any{
+		"user_id": o.to, "device_id": deviceID, "from": o.from, "offer_id": o.id, "msg_id": o.clip.MsgID,
+	})
+}
@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+)
+
+func nextEvent(t *testing.T, sub *Subscription) types.Envelope {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ev, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev.Env
+}
+
+func TestInbox_OfferAcceptReject(t *testing.T) {
+	var released []string
+	s := &Server{InboxSize: 2, OnRecall: func(userID string, c *types.Clip) { released = append(released, c.MsgID) }}
+	sender, _ := s.Subscribe("u1", "S", 0, "test", "")
+	defer sender.Close()
+	phone, _ := s.Subscribe("u2", "P", 0, "test", "")
+	defer phone.Close()
+
+	clip := func(id string) *types.Clip {
+		return &types.Clip{MsgID: id, Mime: "text/plain", Size: 4, Data: []byte("hola"), To: "u2"}
+	}
+	if err := s.Submit("u1", "A", clip("m1")); err != nil {
+		t.Fatal(err)
+	}
+	offer := nextEvent(t, phone)
+	if offer.Type != "offer" || offer.User != "u1" || offer.Offer.Clip.Data != nil || offer.Offer.Clip.Size != 4 {
+		t.Fatalf("la oferta no debe traer el contenido: %+v", offer)
+	}
+	if _, ok := sender.TryNext(); ok {
+		t.Fatal("los dispositivos del emisor no reciben su oferta")
+	}
+
+	// un dispositivo que se conecta después la ve pendiente
+	laptop, _ := s.Subscribe("u2", "L", 0, "test", "")
+	defer laptop.Close()
+	if env := nextEvent(t, laptop); env.Type != "offer" || env.Offer.ID != offer.Offer.ID {
+		t.Fatalf("pendiente: %+v", env)
+	}
+
+	got, err := s.Accept("u2", "P", offer.Offer.ID)
+	if err != nil || string(got.Clip.Data) != "hola" || got.User != "u1" {
+		t.Fatalf("accept: %+v err=%v", got, err)
+	}
+	if env := nextEvent(t, sender); env.Type != "offer_result" || env.Offer.Status != OfferAccepted {
+		t.Fatalf("el emisor debe saber que se aceptó: %+v", env)
+	}
+	if env := nextEvent(t, laptop); env.Type != "offer_result" {
+		t.Fatalf("los otros dispositivos deben quitarla: %+v", env)
+	}
+	if _, err := s.Accept("u2", "P", offer.Offer.ID); !errors.Is(err, ErrNoOffer) {
+		t.Fatalf("aceptar dos veces: %v", err)
+	}
+
+	_ = s.Submit("u1", "A", clip("m2"))
+	_ = s.Submit("u1", "A", clip("m3"))
+	if err := s.Submit("u1", "A", clip("m4")); !errors.Is(err, ErrInboxFull) {
+		t.Fatalf("bandeja llena: %v", err)
+	}
+	offers := s.Offers("u2")
+	if len(offers) != 2 {
+		t.Fatalf("Offers=%+v", offers)
+	}
+	if err := s.Reject("u2", "P", offers[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	s.OfferTTL = time.Minute
+	s.ExpireOffers(time.Now().Add(2 * time.Minute))
+	if len(s.Offers("u2")) != 0 || len(released) != 2 || released[0] != "m2" || released[1] != "m3" {
+		t.Fatalf("rechazadas/caducadas liberan su clip: released=%v", released)
+	}
+
+	if err := s.Submit("u1", "A", &types.Clip{Mime: "text/plain", Size: 1, Data: []byte("x"), To: "u1"}); !errors.Is(err, ErrInvalidClip) {
+		t.Fatalf("a uno mismo: %v", err)
+	}
+}
+
+func TestInbox_FullDoesNotBurnMsgID(t *testing.T) {
+	s := &Server{InboxSize: 1}
+	s.SetDedupeCapacity(16)
+	phone, _ := s.Subscribe("u2", "P", 0, "test", "")
+	defer phone.Close()
+	clip := func(id string) *types.Clip {
+		return &types.Clip{MsgID: id, Mime: "text/plain", Size: 4, Data: []byte("hola"), To: "u2"}
+	}
+	if err := s.Submit("u1", "A", clip("m1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Submit("u1", "A", clip("m2")); !errors.Is(err, ErrInboxFull) {
+		t.Fatalf("err=%v, quiero ErrInboxFull", err)
+	}
+	if err := s.Reject("u2", "P", s.Offers("u2")[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Submit("u1", "A", clip("m2")); err != nil {
+		t.Fatalf("reintento tras bandeja llena: %v", err)
+	}
+}
+
+func TestInbox_RecipientAndLimits(t *testing.T) {
+	s := &Server{OffersPerSender: 2, MaxInboxes: 2}
+	s.SetDedupeCapacity(16)
+	for _, u := range []string{"u2", "u3", "u4"} {
+		sub, _ := s.Subscribe(u, "P", 0, "test", "")
+		defer sub.Close()
+	}
+	clip := func(id, to string) *types.Clip {
+		return &types.Clip{MsgID: id, Mime: "text/plain", Size: 4, Data: []byte("hola"), To: to}
+	}
+
+	// nunca se conectó: no se le puede dejar nada, y el msg_id no se quema
+	if err := s.Submit("u1", "A", clip("m1", "nadie")); !errors.Is(err, ErrUnknownRecipient) {
+		t.Fatalf("destinatario desconocido: %v", err)
+	}
+	if err := s.Submit("u1", "A", clip("m1", "u2")); err != nil {
+		t.Fatal(err)
+	}
+
+	// tope de bandejas: u3 abre la segunda, u4 ya no cabe
+	if err := s.Submit("u5", "A", clip("m2", "u3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Submit("u5", "A", clip("m3", "u4")); !errors.Is(err, ErrInboxFull) {
+		t.Fatalf("tope de bandejas: %v", err)
+	}
+
+	// tope por emisor, aunque las bandejas tengan sitio
+	if err := s.Submit("u1", "A", clip("m4", "u3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Submit("u1", "A", clip("m5", "u2")); !errors.Is(err, ErrTooManyOffers) {
+		t.Fatalf("tope por emisor: %v", err)
+	}
+	// al cerrarse una oferta vuelve a haber cupo
+	if err := s.Reject("u2", "P", s.Offers("u2")[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Submit("u1", "A", clip("m5", "u2")); err != nil {
+		t.Fatalf("tras rechazar: %v", err)
+	}
+
+	// KnownRecipient decide en lugar del registro de conexiones
+	s.KnownRecipient = func(from, to string) bool { return to != "u2" }
+	if err := s.Submit("u5", "A", clip("m6", "u2")); !errors.Is(err, ErrUnknownRecipient) {
+		t.Fatalf("KnownRecipient: %v", err)
+	}
+}
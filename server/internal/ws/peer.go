@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"clip-sync/server/pkg/types"
+
+	"github.com/coder/websocket"
+)
+
+// peer es un dispositivo conectado, sea cual sea el transporte. send
+// entrega un envelope (seq es su número en el historial, 0 = ninguno) y
+// close corta la conexión indicando el motivo. stats es lo que la API de
+// administración ve de la conexión.
+type peer interface {
+	send(ctx context.Context, env types.Envelope, seq int64) error
+	close(reason string)
+	stats() *connStats
+}
+
+// connStats describe una conexión; los contadores van con atomic.
+type connStats struct {
+	transport  string
+	remoteAddr string
+	connected  time.Time
+	bytesIn    int64 // envelopes JSON recibidos del dispositivo
+	bytesOut   int64 // envelopes JSON enviados al dispositivo
+	drops      int64
+}
+
+func newStats(transport, remoteAddr string) connStats {
+	return connStats{transport: transport, remoteAddr: remoteAddr, connected: time.Now()}
+}
+
+type wsPeer struct {
+	c  *websocket.Conn
+	st connStats
+}
+
+func (p *wsPeer) send(ctx context.Context, env types.Envelope, _ int64) error {
+	b, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	if err := p.c.Write(ctx, websocket.MessageText, b); err != nil {
+		return err
+	}
+	atomic.AddInt64(&p.st.bytesOut, int64(len(b)))
+	return nil
+}
+
+// read lee el siguiente envelope; un mensaje que no es JSON válido cierra
+// la conexión, como hacía wsjson.Read.
+func (p *wsPeer) read(ctx context.Context) (types.Envelope, error) {
+	var env types.Envelope
+	_, b, err := p.c.Read(ctx)
+	if err != nil {
+		return env, err
+	}
+	atomic.AddInt64(&p.st.bytesIn, int64(len(b)))
+	if err := json.Unmarshal(b, &env); err != nil {
+		_ = p.c.Close(websocket.StatusInvalidFramePayloadData, "failed to unmarshal JSON")
+		return env, err
+	}
+	return env, nil
+}
+
+func (p *wsPeer) close(reason string) {
+	_ = p.c.Close(websocket.StatusNormalClosure, reason)
+}
+
+func (p *wsPeer) stats() *connStats { return &p.st }
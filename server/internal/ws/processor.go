@@ -0,0 +1,126 @@
+package ws
+
+import (
+	"errors"
+
+	"clip-sync/server/pkg/types"
+)
+
+// Pipeline: cada clip pasa por una cadena de etapas antes de difundirse.
+// Una etapa puede dejarlo pasar, cambiarlo en el sitio o rechazarlo; la
+// primera que rechaza corta la cadena.
+
+// ClipContext es lo que ve cada etapa: quién envía y el clip, que puede
+// modificar.
+type ClipContext struct {
+	UserID   string
+	DeviceID string
+	Clip     *types.Clip
+
+	deduped bool // la etapa dedupe anotó Clip.MsgID
+}
+
+// ClipProcessor es una etapa del pipeline. Name la identifica (para
+// insertar otras antes o después). Process devuelve nil para seguir o un
+// error para descartar el clip: Submit lo devuelve tal cual, así que
+// conviene envolver uno de los Err* para que los transportes lo traduzcan
+// (p. ej. ErrRejected es un 422 en /api/clips).
+type ClipProcessor interface {
+	Name() string
+	Process(c *ClipContext) error
+}
+
+type funcProcessor struct {
+	name string
+	fn   func(c *ClipContext) error
+}
+
+func (p funcProcessor) Name() string                 { return p.name }
+func (p funcProcessor) Process(c *ClipContext) error { return p.fn(c) }
+
+// Processor crea una etapa a partir de una función.
+func Processor(name string, fn func(c *ClipContext) error) ClipProcessor {
+	return funcProcessor{name: name, fn: fn}
+}
+
+// RejectError es un rechazo con código: el clip se registra en el log como
+// ws_drop_<Code>. Un error sin código usa el nombre de la etapa.
+type RejectError struct {
+	Code string
+	Err  error
+}
+
+// Reject descarta el clip con code como motivo y err como error.
+func Reject(code string, err error) error {
+	return &RejectError{Code: code, Err: err}
+}
+
+func (e *RejectError) Error() string { return e.Err.Error() }
+func (e *RejectError) Unwrap() error { return e.Err }
+
+// DefaultProcessors devuelve las etapas incluidas, en orden: validate,
+// channel_acl, accept (AcceptClip), policy (ContentPolicy), dedupe y
+// rate_limit. Si una etapa posterior a dedupe (o la bandeja del
+// destinatario) rechaza el clip, su msg_id se olvida para que el reintento
+// no sea un duplicado. Para añadir una propia:
+//
+//	s.Processors = append(s.DefaultProcessors(), ws.Processor("org", fn))
+func (s *Server) DefaultProcessors() []ClipProcessor {
+	return []ClipProcessor{
+		Processor("validate", func(c *ClipContext) error {
+			if !s.validateClip(c.Clip) || c.Clip.To == c.UserID {
+				return Reject("invalid", ErrInvalidClip)
+			}
+			return nil
+		}),
+		Processor("channel_acl", func(c *ClipContext) error {
+			if c.Clip.Channel != "" && !s.canWrite(c.UserID, c.Clip.Channel) {
+				return Reject("forbidden", ErrForbidden)
+			}
+			return nil
+		}),
+		Processor("accept", func(c *ClipContext) error {
+			if s.AcceptClip != nil && !s.AcceptClip(c.UserID, c.Clip) {
+				return Reject("rejected", ErrRejected)
+			}
+			return nil
+		}),
+		Processor("policy", func(c *ClipContext) error {
+			if s.ContentPolicy != nil && !s.ContentPolicy(c.UserID, c.Clip) {
+				return Reject("policy", ErrBlocked)
+			}
+			return nil
+		}),
+		Processor("dedupe", func(c *ClipContext) error {
+			if s.isDup(c.UserID, c.Clip.MsgID) {
+				return Reject("dup", ErrDuplicate)
+			}
+			c.deduped = true
+			return nil
+		}),
+		Processor("rate_limit", func(c *ClipContext) error {
+			if !s.allow(c.UserID, c.DeviceID) {
+				return Reject("rate", ErrRateLimited)
+			}
+			return nil
+		}),
+	}
+}
+
+// process pasa c por la cadena y devuelve el primer rechazo con su código.
+func (s *Server) process(c *ClipContext) (code string, err error) {
+	chain := s.Processors
+	if chain == nil {
+		chain = s.DefaultProcessors()
+	}
+	for _, p := range chain {
+		if err := p.Process(c); err != nil {
+			var rej *RejectError
+			if errors.As(err, &rej) && rej.Code != "" {
+				return rej.Code, err
+			}
+			return p.Name(), err
+		}
+	}
+	return "", nil
+}
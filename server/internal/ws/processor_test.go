@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"clip-sync/server/pkg/types"
+)
+
+func TestProcessors_CustomStage(t *testing.T) {
+	var events []string
+	s := &Server{Log: func(event string, _ map[string]any) { events = append(events, event) }}
+	s.SetDedupeCapacity(16)
+	errOrg := fmt.Errorf("%w: texto prohibido", ErrRejected)
+	s.Processors = append(s.DefaultProcessors(),
+		Processor("upper", func(c *ClipContext) error {
+			c.Clip.Data = []byte(strings.ToUpper(string(c.Clip.Data)))
+			return nil
+		}),
+		Processor("org", func(c *ClipContext) error {
+			if strings.Contains(string(c.Clip.Data), "SECRETO") {
+				return errOrg
+			}
+			return nil
+		}),
+	)
+	phone, _ := s.Subscribe("u1", "P", 0, "test", "")
+	defer phone.Close()
+
+	clip := func(id, text string) *types.Clip {
+		return &types.Clip{MsgID: id, Mime: "text/plain", Size: len(text), Data: []byte(text)}
+	}
+	if err := s.Submit("u1", "A", clip("m1", "hola")); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextEvent(t, phone); string(got.Clip.Data) != "HOLA" {
+		t.Fatalf("la etapa no transformó el clip: %q", got.Clip.Data)
+	}
+
+	if err := s.Submit("u1", "A", clip("m2", "un secreto")); !errors.Is(err, ErrRejected) {
+		t.Fatalf("err=%v, quiero ErrRejected", err)
+	}
+	if ev := events[len(events)-1]; ev != "ws_drop_org" {
+		t.Fatalf("evento %q, quiero ws_drop_org", ev)
+	}
+	// las etapas incluidas siguen antes: el duplicado no llega a la propia
+	if err := s.Submit("u1", "A", clip("m1", "hola")); !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("err=%v, quiero ErrDuplicate", err)
+	}
+	if ev := events[len(events)-1]; ev != "ws_drop_dup" {
+		t.Fatalf("evento %q, quiero ws_drop_dup", ev)
+	}
+	if _, ok := phone.TryNext(); ok {
+		t.Fatal("se difundió un clip rechazado")
+	}
+}
@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"clip-sync/server/pkg/types"
+)
+
+// Operación: lo que la API de administración ve y hace con las conexiones
+// vivas, sin reiniciar el server.
+
+// Session es una conexión viva de un dispositivo.
+type Session struct {
+	User        string    `json:"user"`
+	Device      string    `json:"device"`
+	Transport   string    `json:"transport"` // ws|sse|poll
+	RemoteAddr  string    `json:"remote_addr,omitempty"`
+	ConnectedAt time.Time `json:"connected_at"`
+	BytesIn     int64     `json:"bytes_in"`
+	BytesOut    int64     `json:"bytes_out"`
+	Drops       int64     `json:"drops"`
+}
+
+// Sessions devuelve las conexiones vivas de userID ("" = de todos),
+// ordenadas por usuario y dispositivo.
+func (s *Server) Sessions(userID string) []Session {
+	s.mu.RLock()
+	out := make([]Session, 0, len(s.conns))
+	for uid, devs := range s.conns {
+		if userID != "" && uid != userID {
+			continue
+		}
+		for dev, p := range devs {
+			st := p.stats()
+			out = append(out, Session{
+				User: uid, Device: dev, Transport: st.transport, RemoteAddr: st.remoteAddr,
+				ConnectedAt: st.connected,
+				BytesIn:     atomic.LoadInt64(&st.bytesIn),
+				BytesOut:    atomic.LoadInt64(&st.bytesOut),
+				Drops:       atomic.LoadInt64(&st.drops),
+			})
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].User != out[j].User {
+			return out[i].User < out[j].User
+		}
+		return out[i].Device < out[j].Device
+	})
+	return out
+}
+
+// Kick desconecta deviceID de userID (todos sus dispositivos si es "") con
+// reason como motivo de cierre y devuelve cuántas conexiones cortó. Un
+// cliente que reconecta por su cuenta puede volver.
+func (s *Server) Kick(userID, deviceID, reason string) int {
+	var list []peer
+	var devs []string
+	s.mu.Lock()
+	for dev, p := range s.conns[userID] {
+		if deviceID != "" && dev != deviceID {
+			continue
+		}
+		list = append(list, p)
+		devs = append(devs, dev)
+		delete(s.conns[userID], dev)
+		s.leaveChannelsLocked(member{userID, dev}, p)
+	}
+	if len(s.conns[userID]) == 0 {
+		delete(s.conns, userID)
+	}
+	atomic.AddInt64(&s.metrics.conns, -int64(len(list)))
+	s.mu.Unlock()
+
+	for _, p := range list {
+		p.close(reason)
+	}
+	if s.OnDisconnect != nil {
+		for _, d := range devs {
+			s.OnDisconnect(userID, d)
+		}
+	}
+	s.log("ws_kick", map[string]any{
+		"user_id": userID, "device_id": deviceID, "reason": reason, "kicked": len(list),
+	})
+	return len(list)
+}
+
+// Notify envía un "notice" a los dispositivos conectados de userID ("" =
+// a todos) y devuelve a cuántos llegó.
+func (s *Server) Notify(userID string, n types.Notice) int {
+	var list []peer
+	s.mu.RLock()
+	for uid, devs := range s.conns {
+		if userID != "" && uid != userID {
+			continue
+		}
+		for _, p := range devs {
+			list = append(list, p)
+		}
+	}
+	s.mu.RUnlock()
+
+	env := types.Envelope{Type: "notice", Notice: &n}
+	sent := 0
+	for _, p := range list {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		if err := p.send(ctx, env, 0); err == nil {
+			sent++
+		}
+		cancel()
+	}
+	s.log("ws_notice", map[string]any{
+		"user_id": userID, "level": n.Level, "targets": len(list), "sent": sent,
+	})
+	return sent
+}
@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"clip-sync/server/internal/channel"
+	"clip-sync/server/pkg/types"
+)
+
+// Motivos por los que un clip no se difunde. Por /ws se descartan en
+// silencio; Submit los devuelve para que otros transportes respondan.
+var (
+	ErrInvalidClip   = errors.New("invalid clip")
+	ErrRejected      = errors.New("clip rejected")
+	ErrDuplicate     = errors.New("duplicate msg_id")
+	ErrRateLimited   = errors.New("rate limited")
+	ErrInvalidDevice = errors.New("invalid device_id")
+	ErrForbidden     = errors.New("not a writer of this channel")
+	ErrBlocked       = errors.New("clip blocked by content policy")
+)
+
+// Submit difunde clip de parte de deviceID como si hubiera llegado por su
+// WebSocket: mismo pipeline (Processors) y broadcast.
+func (s *Server) Submit(userID, deviceID string, clip *types.Clip) error {
+	if !deviceIDRe.MatchString(deviceID) {
+		return ErrInvalidDevice
+	}
+	return s.submit(userID, deviceID, clip)
+}
+
+func (s *Server) submit(userID, deviceID string, clip *types.Clip) error {
+	if clip == nil {
+		return ErrInvalidClip
+	}
+	pc := &ClipContext{UserID: userID, DeviceID: deviceID, Clip: clip}
+	if code, err := s.process(pc); err != nil {
+		if pc.deduped {
+			s.forgetDup(userID, clip.MsgID)
+		}
+		atomic.AddInt64(&s.metrics.drops, 1)
+		s.log("ws_drop_"+code, map[string]any{
+			"user_id": userID, "device_id": deviceID, "msg_id": clip.MsgID,
+		})
+		return err
+	}
+	atomic.AddInt64(&s.metrics.clips, 1)
+	if clip.To != "" {
+		err := s.offer(userID, deviceID, clip)
+		if err != nil && pc.deduped {
+			s.forgetDup(userID, clip.MsgID)
+		}
+		return err
+	}
+
+	out := types.Envelope{
+		Type: "clip",
+		From: deviceID,
+		Clip: clip,
+	}
+	if clip.Channel != "" {
+		out.User = userID
+		s.record(chanRoom(clip.Channel), out)
+		s.broadcastChannel(clip.Channel, member{userID, deviceID}, out)
+	} else {
+		// al historial antes de enviarlo: quien reanude por número de
+		// secuencia no debe ver un hueco
+		seq := s.record(userRoom(userID), out)
+		s.broadcast(userID, deviceID, out, seq)
+	}
+	if s.OnClip != nil {
+		s.OnClip(userID, deviceID, clip)
+	}
+	s.log("ws_clip", map[string]any{
+		"user_id": userID, "device_id": deviceID, "channel": clip.Channel, "msg_id": clip.MsgID,
+		"mime": clip.Mime, "size": clip.Size, "has_data": len(clip.Data) > 0,
+		"has_url": clip.UploadURL != "",
+	})
+	return nil
+}
+
+// Recall retira msgID (de channelName, o de los dispositivos propios si es
+// "") de parte de deviceID como un envelope "recall" por WebSocket (con el
+// mismo rate limit).
+func (s *Server) Recall(userID, deviceID, channelName, msgID string) error {
+	if !deviceIDRe.MatchString(deviceID) {
+		return ErrInvalidDevice
+	}
+	if msgID == "" {
+		return ErrInvalidClip
+	}
+	if channelName != "" && !s.canWrite(userID, channelName) {
+		return ErrForbidden
+	}
+	if !s.allow(userID, deviceID) {
+		atomic.AddInt64(&s.metrics.drops, 1)
+		s.log("ws_drop_rate", map[string]any{
+			"user_id": userID, "device_id": deviceID, "msg_id": msgID,
+		})
+		return ErrRateLimited
+	}
+	s.recall(userID, deviceID, channelName, msgID)
+	return nil
+}
+
+func (s *Server) canWrite(userID, channelName string) bool {
+	return s.Channels != nil && s.Channels.Role(channelName, userID) >= channel.Writer
+}
@@ -0,0 +1,194 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"clip-sync/server/pkg/types"
+)
+
+// Suscripciones: dispositivos que reciben por un transporte que no es el
+// WebSocket (SSE, long-poll). Cuentan como conectados igual que un /ws,
+// así que el broadcast, OnDeliver y las métricas los tratan igual.
+
+// subBuffer: envelopes en cola por suscriptor antes de contar drops.
+const subBuffer = 64
+
+// ErrClosed: el server cerró la suscripción (shutdown, reemplazo...).
+var ErrClosed = errors.New("subscription closed by server")
+
+// Event es un envelope entregado a un suscriptor. Seq es su número en el
+// historial del usuario (0 = no reanudable, p. ej. un recall).
+type Event struct {
+	Seq int64
+	Env types.Envelope
+}
+
+type chanPeer struct {
+	ch     chan Event
+	done   chan struct{}
+	once   sync.Once
+	reason string
+	st     connStats
+}
+
+func (p *chanPeer) send(ctx context.Context, env types.Envelope, seq int64) error {
+	select {
+	case p.ch <- Event{Seq: seq, Env: env}:
+		// el transporte serializa el envelope; se cuenta su JSON
+		if b, err := json.Marshal(env); err == nil {
+			atomic.AddInt64(&p.st.bytesOut, int64(len(b)))
+		}
+		return nil
+	case <-p.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *chanPeer) close(reason string) {
+	p.once.Do(func() {
+		p.reason = reason
+		close(p.done)
+	})
+}
+
+func (p *chanPeer) stats() *connStats { return &p.st }
+
+// Subscription es un dispositivo suscrito con Subscribe.
+type Subscription struct {
+	s        *Server
+	userID   string
+	deviceID string
+	p        *chanPeer
+	backlog  []Event
+	last     int64
+}
+
+// Subscribe registra deviceID de userID como conectado por transport desde
+// remoteAddr. Si after > 0 se reenvían antes los clips del historial
+// posteriores a after (menos los propios y los burn, cuyo blob puede no
+// servirle ya); un after mayor que la última secuencia no reenvía nada.
+// Después van las ofertas pendientes de su bandeja.
+func (s *Server) Subscribe(userID, deviceID string, after int64, transport, remoteAddr string) (*Subscription, error) {
+	if !deviceIDRe.MatchString(deviceID) {
+		return nil, ErrInvalidDevice
+	}
+	sub := &Subscription{
+		s: s, userID: userID, deviceID: deviceID, last: after,
+		p: &chanPeer{
+			ch: make(chan Event, subBuffer), done: make(chan struct{}),
+			st: newStats(transport, remoteAddr),
+		},
+	}
+	// registrar antes de leer el historial: lo que llegue entre medias
+	// estará en ambos y Next lo descarta por seq
+	s.addConn(userID, deviceID, sub.p)
+	// el historial vive en memoria y la secuencia vuelve a 1 al reiniciar:
+	// un after por delante de ella es de antes del reinicio y se ignora,
+	// o Next descartaría los clips nuevos con seq <= after
+	if after > s.lastSeq(userRoom(userID)) {
+		after, sub.last = 0, 0
+	}
+	if after > 0 {
+		for _, e := range s.since(userRoom(userID), after) {
+			if e.Env.From == deviceID || e.Env.Clip.Burn {
+				continue
+			}
+			sub.backlog = append(sub.backlog, Event{Seq: e.Seq, Env: s.prepareFor(userID, e.Env, deviceID)})
+		}
+	}
+	for _, o := range s.pendingOffers(userID) {
+		sub.backlog = append(sub.backlog, Event{Env: o})
+	}
+	s.log("ws_hello", map[string]any{
+		"user_id": userID, "device_id": deviceID, "transport": transport, "resume": len(sub.backlog),
+	})
+	return sub, nil
+}
+
+// JoinChannels suscribe también a los canales de names que el usuario
+// puede leer y devuelve cuáles.
+func (sub *Subscription) JoinChannels(names []string) []string {
+	return sub.s.joinChannels(sub.userID, sub.deviceID, sub.p, names)
+}
+
+// Next devuelve el siguiente envelope, esperando hasta que llegue uno, el
+// server cierre la suscripción (ErrClosed) o ctx termine.
+func (sub *Subscription) Next(ctx context.Context) (Event, error) {
+	if ev, ok := sub.TryNext(); ok {
+		return ev, nil
+	}
+	for {
+		select {
+		case ev := <-sub.p.ch:
+			if sub.fresh(ev) {
+				return ev, nil
+			}
+		case <-sub.p.done:
+			return Event{}, ErrClosed
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		}
+	}
+}
+
+// TryNext es Next sin esperar: ok = false si no hay nada pendiente.
+func (sub *Subscription) TryNext() (Event, bool) {
+	if len(sub.backlog) > 0 {
+		ev := sub.backlog[0]
+		sub.backlog = sub.backlog[1:]
+		if ev.Seq > 0 {
+			sub.last = ev.Seq
+		}
+		return ev, true
+	}
+	for {
+		select {
+		case ev := <-sub.p.ch:
+			if sub.fresh(ev) {
+				return ev, true
+			}
+		default:
+			return Event{}, false
+		}
+	}
+}
+
+// fresh descarta lo que ya salió en el backlog y avanza la secuencia.
+func (sub *Subscription) fresh(ev Event) bool {
+	if ev.Seq == 0 {
+		return true
+	}
+	if ev.Seq <= sub.last {
+		return false
+	}
+	sub.last = ev.Seq
+	return true
+}
+
+// Reason es el motivo con que el server cerró la suscripción.
+func (sub *Subscription) Reason() string {
+	select {
+	case <-sub.p.done:
+		return sub.p.reason
+	default:
+		return ""
+	}
+}
+
+// Received suma n bytes recibidos del dispositivo (p. ej. un envelope
+// mandado por /api/poll/send) a sus estadísticas.
+func (sub *Subscription) Received(n int64) {
+	atomic.AddInt64(&sub.p.st.bytesIn, n)
+}
+
+// Close da de baja la suscripción.
+func (sub *Subscription) Close() {
+	sub.s.removeConn(sub.userID, sub.deviceID, sub.p)
+	sub.p.close("")
+}
@@ -0,0 +1,53 @@
+package ws
+
+import (
+	"testing"
+
+	"clip-sync/server/internal/sniff"
+	"clip-sync/server/pkg/types"
+)
+
+func TestValidateClip_SniffInline(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+
+	s := Server{SniffPolicy: sniff.Reject}
+	if s.validateClip(&types.Clip{Mime: "text/plain", Size: len(png), Data: png}) {
+		t.Fatal("reject: un PNG declarado como texto debe descartarse")
+	}
+	txt := []byte("hola")
+	if !s.validateClip(&types.Clip{Mime: "text/plain", Size: len(txt), Data: txt}) {
+		t.Fatal("reject: texto honesto debe pasar")
+	}
+	mz := []byte("MZ-1234 shipped")
+	if !s.validateClip(&types.Clip{Mime: "text/plain", Size: len(mz), Data: mz}) {
+		t.Fatal("reject: un texto que empieza por MZ no es un ejecutable")
+	}
+
+	s.SniffPolicy = sniff.Correct
+	c := &types.Clip{Mime: "text/plain", Size: len(png), Data: png}
+	if !s.validateClip(c) || c.Mime != "image/png" {
+		t.Fatalf("correct: valid=%v mime=%q", s.validateClip(c), c.Mime)
+	}
+}
+
+func TestValidateClip_SHA256(t *testing.T) {
+	var s Server
+	data := []byte("hola")
+	const sum = "b221d9dbb083a7f33428d7c2a3c3198ae925614d70210e28716ccaa7cd4ddb79"
+	cases := []struct {
+		name string
+		clip types.Clip
+		want bool
+	}{
+		{"inline correcto", types.Clip{Size: 4, Data: data, SHA256: sum}, true},
+		{"inline en mayúsculas", types.Clip{Size: 4, Data: data, SHA256: "B221D9DBB083A7F33428D7C2A3C3198AE925614D70210E28716CCAA7CD4DDB79"}, true},
+		{"inline alterado", types.Clip{Size: 4, Data: []byte("hol4"), SHA256: sum}, false},
+		{"upload con digest", types.Clip{Size: 10, UploadURL: "/d/x", SHA256: sum}, true},
+		{"digest mal formado", types.Clip{Size: 10, UploadURL: "/d/x", SHA256: "zz"}, false},
+	}
+	for _, c := range cases {
+		if got := s.validateClip(&c.clip); got != c.want {
+			t.Fatalf("%s: valid=%v, want %v", c.name, got, c.want)
+		}
+	}
+}
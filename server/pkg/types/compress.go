@@ -0,0 +1,30 @@
+package types
+
+import "strings"
+
+// compressedMimes: formatos que ya vienen comprimidos; gzip no ganaría
+// nada. Lo comparten el servidor (al guardar) y los clientes (al subir).
+var compressedMimes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/*", "audio/*",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/zstd", "application/x-7z-compressed", "application/x-xz",
+	"application/x-bzip2", "application/x-rar-compressed", "application/pdf",
+}
+
+// Compressible indica si vale la pena comprimir contenido de tipo mime
+// (se ignoran los parámetros, como charset).
+func Compressible(mime string) bool {
+	mime, _, _ = strings.Cut(mime, ";")
+	mime = strings.ToLower(strings.TrimSpace(mime))
+	for _, p := range compressedMimes {
+		if base, ok := strings.CutSuffix(p, "/*"); ok {
+			if strings.HasPrefix(mime, base+"/") {
+				return false
+			}
+		} else if p == mime {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,18 @@
+package types
+
+import "testing"
+
+func TestCompressible(t *testing.T) {
+	for mime, want := range map[string]bool{
+		"text/plain; charset=utf-8": true,
+		"application/json":          true,
+		"image/PNG":                 false,
+		"image/avif":                false,
+		"video/mp4":                 false,
+		"application/zstd":          false,
+	} {
+		if got := Compressible(mime); got != want {
+			t.Errorf("Compressible(%q) = %v, quiero %v", mime, got, want)
+		}
+	}
+}
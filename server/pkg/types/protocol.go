@@ -3,16 +3,21 @@ package types
 const MaxInlineBytes = 64 << 10 // 64 KiB
 
 type Envelope struct {
-	Type  string `json:"type"`
-	From  string `json:"from,omitempty"` // deviceID del emisor
-	Hello *Hello `json:"hello,omitempty"`
-	Clip  *Clip  `json:"clip,omitempty"`
+	Type   string  `json:"type"`
+	From   string  `json:"from,omitempty"` // deviceID del emisor
+	User   string  `json:"user,omitempty"` // userID del emisor, en clips de canal
+	Hello  *Hello  `json:"hello,omitempty"`
+	Clip   *Clip   `json:"clip,omitempty"`
+	Recall *Recall `json:"recall,omitempty"`
+	Offer  *Offer  `json:"offer,omitempty"`
+	Notice *Notice `json:"notice,omitempty"`
 }
 
 type Hello struct {
-	Token    string `json:"token"`
-	UserID   string `json:"user_id"`
-	DeviceID string `json:"device_id"`
+	Token    string   `json:"token"`
+	UserID   string   `json:"user_id"`
+	DeviceID string   `json:"device_id"`
+	Channels []string `json:"channels,omitempty"` // canales a recibir además de los propios clips
 }
 
 type Clip struct {
@@ -21,4 +26,37 @@ type Clip struct {
 	Size      int    `json:"size,omitempty"`
 	Data      []byte `json:"data,omitempty"`
 	UploadURL string `json:"upload_url,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // unix; caducidad de upload_url firmada
+	Burn      bool   `json:"burn,omitempty"`       // burn-after-read: no guardar, borrar tras leer
+	ThumbURL  string `json:"thumb_url,omitempty"`  // miniatura PNG para clips de imagen
+	SHA256    string `json:"sha256,omitempty"`     // hex del contenido, para verificar la descarga
+	Channel   string `json:"channel,omitempty"`    // canal compartido destino; "" = dispositivos propios
+	To        string `json:"to,omitempty"`         // userID destinatario: el clip va a su bandeja (Offer)
+}
+
+// Recall retira un clip ya enviado: el server lo olvida (y borra su blob)
+// y los receptores lo quitan del historial y del portapapeles.
+type Recall struct {
+	MsgID   string `json:"msg_id"`
+	Channel string `json:"channel,omitempty"`
+}
+
+// Offer es un clip que otro usuario ofrece: queda en la bandeja del
+// destinatario hasta que uno de sus dispositivos lo acepta ("accept") o lo
+// rechaza ("reject"). Un "offer" lleva solo los metadatos del clip; el
+// contenido llega como "clip" al dispositivo que acepta. El emisor recibe
+// el resultado como "offer_result".
+type Offer struct {
+	ID     string `json:"id"`
+	From   string `json:"from,omitempty"`   // userID del emisor
+	To     string `json:"to,omitempty"`     // userID del destinatario
+	Clip   *Clip  `json:"clip,omitempty"`   // sin data ni upload_url
+	Status string `json:"status,omitempty"` // pending|accepted|rejected|expired
+}
+
+// Notice es un aviso del operador ("notice"), p. ej. un mantenimiento
+// próximo. Los clientes lo muestran; no toca el portapapeles.
+type Notice struct {
+	Text  string `json:"text"`
+	Level string `json:"level,omitempty"` // info|warning
 }
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+func postClip(t *testing.T, url, ct string, body []byte) (int, map[string]string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer u1")
+	if ct != "" {
+		req.Header.Set("Content-Type", ct)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out := map[string]string{}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestAPIClips_BroadcastsThroughWSPipeline(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	t.Setenv("CLIPSYNC_INLINE_MAXBYTES", "1024")
+	srv := httptest.NewServer(newMux(t))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	c, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(websocket.StatusNormalClosure, "")
+	_ = wsjson.Write(ctx, c, types.Envelope{Type: "hello", Hello: &types.Hello{Token: "u1", UserID: "u1", DeviceID: "B"}})
+	time.Sleep(50 * time.Millisecond)
+
+	// texto en JSON con msg_id propio
+	code, out := postClip(t, srv.URL+"/api/clips", "application/json", []byte(`{"text":"hola","msg_id":"ci-1"}`))
+	if code != http.StatusOK || out["msg_id"] != "ci-1" {
+		t.Fatalf("json: status=%d out=%v", code, out)
+	}
+	var env types.Envelope
+	if err := wsjson.Read(ctx, c, &env); err != nil || string(env.Clip.Data) != "hola" || env.From != "api" {
+		t.Fatalf("env=%+v err=%v", env, err)
+	}
+
+	// mismo msg_id: el dedupe de ws lo frena
+	if code, _ := postClip(t, srv.URL+"/api/clips", "application/json", []byte(`{"text":"otra vez","msg_id":"ci-1"}`)); code != http.StatusConflict {
+		t.Fatalf("dup: status=%d, want 409", code)
+	}
+
+	// cuerpo crudo grande: se sube como blob y el clip lleva la URL firmada
+	big := bytes.Repeat([]byte("log line\n"), 1000)
+	code, out = postClip(t, srv.URL+"/api/clips?device=ci", "text/plain", big)
+	if code != http.StatusOK || out["msg_id"] == "" || out["upload_url"] == "" {
+		t.Fatalf("raw: status=%d out=%v", code, out)
+	}
+	if err := wsjson.Read(ctx, c, &env); err != nil || env.From != "ci" || env.Clip.Size != len(big) || env.Clip.SHA256 == "" {
+		t.Fatalf("env=%+v err=%v", env, err)
+	}
+	resp, err := http.Get(srv.URL + env.Clip.UploadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(got, big) {
+		t.Fatalf("descarga: %d bytes, want %d", len(got), len(big))
+	}
+
+	if code, _ := postClip(t, srv.URL+"/api/clips?device=no%20vale", "text/plain", []byte("x")); code != http.StatusBadRequest {
+		t.Fatalf("device inválido: status=%d, want 400", code)
+	}
+}
+
+// Un 429 no debe dejar el msg_id anotado: el reintento con el mismo msg_id
+// tiene que entregarse, no volver como duplicado.
+func TestAPIClips_RetryAfterRateLimit(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	t.Setenv("CLIPSYNC_RATE_LPS", "1")
+	srv := httptest.NewServer(newMux(t))
+	defer srv.Close()
+
+	url := srv.URL + "/api/clips?device=ci"
+	if code, _ := postClip(t, url, "application/json", []byte(`{"text":"uno","msg_id":"ci-1"}`)); code != http.StatusOK {
+		t.Fatalf("primero: %d", code)
+	}
+	if code, _ := postClip(t, url, "application/json", []byte(`{"text":"dos","msg_id":"ci-2"}`)); code != http.StatusTooManyRequests {
+		t.Fatalf("segundo: %d, quiero 429", code)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if code, out := postClip(t, url, "application/json", []byte(`{"text":"dos","msg_id":"ci-2"}`)); code != http.StatusOK {
+		t.Fatalf("reintento: %d %v, quiero 200", code, out)
+	}
+	// lo entregado sí sigue siendo un duplicado
+	time.Sleep(1100 * time.Millisecond)
+	if code, _ := postClip(t, url, "application/json", []byte(`{"text":"dos","msg_id":"ci-2"}`)); code != http.StatusConflict {
+		t.Fatalf("repetido: %d, quiero 409", code)
+	}
+}
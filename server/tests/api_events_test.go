@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+)
+
+type sseEvent struct {
+	id, event string
+	env       types.Envelope
+}
+
+// openSSE abre /api/events y devuelve los eventos por un canal.
+func openSSE(t *testing.T, ctx context.Context, url, lastID string) <-chan sseEvent {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	req.Header.Set("Authorization", "Bearer u1")
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status=%d ct=%q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	out := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(out)
+		var ev sseEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if ev.event != "" {
+					out <- ev
+				}
+				ev = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.id = line[4:]
+			case strings.HasPrefix(line, "event: "):
+				ev.event = line[7:]
+			case strings.HasPrefix(line, "data: "):
+				_ = json.Unmarshal([]byte(line[6:]), &ev.env)
+			}
+		}
+	}()
+	return out
+}
+
+func next(t *testing.T, ch <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("stream cerrado")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout esperando evento")
+	}
+	return sseEvent{}
+}
+
+func TestAPIEvents_StreamAndResume(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	a := newApp(t)
+	srv := httptest.NewServer(a.Mux)
+	defer srv.Close()
+	send := func(text string) {
+		body, _ := json.Marshal(map[string]string{"text": text})
+		if code, _ := postClip(t, srv.URL+"/api/clips?device=ci", "application/json", body); code != http.StatusOK {
+			t.Fatalf("post %q: status=%d", text, code)
+		}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	events := openSSE(t, ctx, srv.URL+"/api/events?device=dash", "")
+	if a.WSS.MetricsSnapshot()["conns_current"] != 1 {
+		t.Fatal("el suscriptor SSE no cuenta como conectado")
+	}
+	send("uno")
+	first := next(t, events)
+	if first.event != "clip" || first.id == "" || string(first.env.Clip.Data) != "uno" || first.env.From != "ci" {
+		t.Fatalf("evento=%+v", first)
+	}
+	stop()
+	for range events {
+	}
+	for a.WSS.MetricsSnapshot()["conns_current"] != 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// mientras está desconectado llegan dos clips; al reanudar los recibe
+	send("dos")
+	send("tres")
+	ctx, stop = context.WithCancel(context.Background())
+	defer stop()
+	events = openSSE(t, ctx, srv.URL+"/api/events?device=dash", first.id)
+	for _, want := range []string{"dos", "tres"} {
+		if ev := next(t, events); string(ev.env.Clip.Data) != want {
+			t.Fatalf("reanudar: %q, want %q", ev.env.Clip.Data, want)
+		}
+	}
+	send("cuatro")
+	if ev := next(t, events); string(ev.env.Clip.Data) != "cuatro" {
+		t.Fatalf("en vivo tras reanudar: %q", ev.env.Clip.Data)
+	}
+}
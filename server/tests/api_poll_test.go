@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+type pollResp struct {
+	Session   string           `json:"session"`
+	Cursor    int64            `json:"cursor"`
+	Envelopes []types.Envelope `json:"envelopes"`
+}
+
+func doJSON(t *testing.T, method, url string, in, out any) int {
+	t.Helper()
+	b, _ := json.Marshal(in)
+	req, _ := http.NewRequest(method, url, bytes.NewReader(b))
+	req.Header.Set("Authorization", "Bearer u1")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		_ = json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode
+}
+
+func TestAPIPoll_QueueAckAndSend(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	a := newApp(t)
+	srv := httptest.NewServer(a.Mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close(websocket.StatusNormalClosure, "")
+	_ = wsjson.Write(ctx, c, types.Envelope{Type: "hello", Hello: &types.Hello{Token: "u1", UserID: "u1", DeviceID: "W"}})
+
+	// primer poll sin espera: abre la sesión del dispositivo P
+	var p pollResp
+	if code := doJSON(t, http.MethodPost, srv.URL+"/api/poll", map[string]any{"device_id": "P", "wait": 0}, &p); code != http.StatusOK || p.Session == "" {
+		t.Fatalf("abrir sesión: status=%d resp=%+v", code, p)
+	}
+
+	// el poll espera hasta que W manda algo
+	got := make(chan pollResp, 1)
+	go func() {
+		var r pollResp
+		doJSON(t, http.MethodPost, srv.URL+"/api/poll", map[string]any{"session": p.Session, "cursor": p.Cursor}, &r)
+		got <- r
+	}()
+	time.Sleep(50 * time.Millisecond)
+	_ = wsjson.Write(ctx, c, types.Envelope{Type: "clip", Clip: &types.Clip{MsgID: "m1", Mime: "text/plain", Size: 2, Data: []byte("hi")}})
+	var r pollResp
+	select {
+	case r = <-got:
+	case <-time.After(3 * time.Second):
+		t.Fatal("el long-poll no devolvió el clip")
+	}
+	if len(r.Envelopes) != 1 || r.Envelopes[0].Clip.MsgID != "m1" || r.Cursor <= p.Cursor {
+		t.Fatalf("poll=%+v", r)
+	}
+
+	// sin confirmar (cursor viejo) se vuelve a entregar; confirmado ya no
+	var again pollResp
+	doJSON(t, http.MethodPost, srv.URL+"/api/poll", map[string]any{"session": p.Session, "cursor": p.Cursor, "wait": 0}, &again)
+	if len(again.Envelopes) != 1 {
+		t.Fatalf("reentrega: %+v", again)
+	}
+	doJSON(t, http.MethodPost, srv.URL+"/api/poll", map[string]any{"session": p.Session, "cursor": r.Cursor, "wait": 0}, &again)
+	if len(again.Envelopes) != 0 {
+		t.Fatalf("tras confirmar: %+v", again)
+	}
+
+	// enviar desde la sesión: W lo recibe con From = P
+	env := types.Envelope{Type: "clip", Clip: &types.Clip{Mime: "text/plain", Size: 3, Data: []byte("ack")}}
+	var sent map[string]string
+	if code := doJSON(t, http.MethodPost, srv.URL+"/api/poll/send", map[string]any{"session": p.Session, "envelope": env}, &sent); code != http.StatusOK || sent["msg_id"] == "" {
+		t.Fatalf("send: status=%d resp=%v", code, sent)
+	}
+	var in types.Envelope
+	if err := wsjson.Read(ctx, c, &in); err != nil || in.From != "P" || string(in.Clip.Data) != "ack" {
+		t.Fatalf("W recibió %+v err=%v", in, err)
+	}
+
+	if a.WSS.MetricsSnapshot()["conns_current"] != 2 {
+		t.Fatal("la sesión de poll no cuenta como conectada")
+	}
+	if code := doJSON(t, http.MethodDelete, srv.URL+"/api/poll/"+p.Session, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("cerrar: status=%d", code)
+	}
+	if a.WSS.MetricsSnapshot()["conns_current"] != 1 {
+		t.Fatal("la sesión cerrada sigue conectada")
+	}
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+func asUser(t *testing.T, user, method, url string, in any) int {
+	t.Helper()
+	var body bytes.Buffer
+	if in != nil {
+		_ = json.NewEncoder(&body).Encode(in)
+	}
+	req, _ := http.NewRequest(method, url, &body)
+	req.Header.Set("Authorization", "Bearer "+user)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestChannels_ACLAndFanOut(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	srv := httptest.NewServer(newMux(t))
+	defer srv.Close()
+
+	api := srv.URL + "/api/channels"
+	if code := asUser(t, "u1", http.MethodPost, api, map[string]string{"name": "oncall"}); code != http.StatusCreated {
+		t.Fatalf("crear: %d", code)
+	}
+	for user, role := range map[string]string{"u2": "writer", "u3": "reader"} {
+		if code := asUser(t, "u1", http.MethodPut, api+"/oncall/members/"+user, map[string]string{"role": role}); code != http.StatusOK {
+			t.Fatalf("añadir %s: %d", user, code)
+		}
+	}
+	if code := asUser(t, "u2", http.MethodPut, api+"/oncall/members/u4", map[string]string{"role": "reader"}); code != http.StatusForbidden {
+		t.Fatalf("un writer añadió miembros: %d", code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	dial := func(user, dev string, channels ...string) *websocket.Conn {
+		c, _, err := websocket.Dial(ctx, wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = wsjson.Write(ctx, c, types.Envelope{Type: "hello", Hello: &types.Hello{
+			Token: user, UserID: user, DeviceID: dev, Channels: channels,
+		}})
+		t.Cleanup(func() { c.Close(websocket.StatusNormalClosure, "") })
+		return c
+	}
+	a := dial("u1", "A", "oncall")
+	b := dial("u2", "B", "oncall")
+	b2 := dial("u2", "B2") // sin suscribirse al canal
+	c := dial("u3", "C", "oncall")
+	d := dial("u4", "D", "oncall") // no es miembro
+	time.Sleep(50 * time.Millisecond)
+
+	read := func(conn *websocket.Conn) types.Envelope {
+		t.Helper()
+		var env types.Envelope
+		if err := wsjson.Read(ctx, conn, &env); err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+	silent := func(name string, conn *websocket.Conn) {
+		t.Helper()
+		short, cancel := context.WithTimeout(ctx, 150*time.Millisecond)
+		defer cancel()
+		var env types.Envelope
+		if err := wsjson.Read(short, conn, &env); err == nil {
+			t.Errorf("%s recibió %+v", name, env)
+		}
+	}
+
+	_ = wsjson.Write(ctx, a, types.Envelope{Type: "clip", Clip: &types.Clip{
+		MsgID: "c1", Mime: "text/plain", Size: 4, Data: []byte("page"), Channel: "oncall",
+	}})
+	for name, conn := range map[string]*websocket.Conn{"B": b, "C": c} {
+		if env := read(conn); env.Clip == nil || env.Clip.Channel != "oncall" || env.User != "u1" || env.From != "A" {
+			t.Fatalf("%s recibió %+v", name, env)
+		}
+	}
+
+	// un reader no escribe: por la API es un 403
+	body, _ := json.Marshal(map[string]string{"text": "no", "channel": "oncall"})
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/clips", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer u3")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("reader escribiendo: %d", resp.StatusCode)
+	}
+
+	// un writer no retira clips ajenos; el que lo mandó sí
+	_ = wsjson.Write(ctx, b, types.Envelope{Type: "recall", Recall: &types.Recall{MsgID: "c1", Channel: "oncall"}})
+	_ = wsjson.Write(ctx, a, types.Envelope{Type: "recall", Recall: &types.Recall{MsgID: "c1", Channel: "oncall"}})
+	if env := read(c); env.Type != "recall" || env.User != "u1" || env.Recall.Channel != "oncall" {
+		t.Fatalf("C esperaba el recall de u1: %+v", env)
+	}
+
+	silent("D (no miembro)", d)
+	silent("B2 (no suscrito)", b2)
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+)
+
+// Un relay llega en directo al CLI que escucha con --save-dir, sin que el
+// servidor guarde copia.
+func TestRelay_CLIReceiverJoinsLive(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compila el CLI")
+	}
+	bin := filepath.Join(t.TempDir(), "cli")
+	build := exec.Command("go", "build", "-o", bin, ".")
+	build.Dir = filepath.Join("..", "..", "clients", "cli")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build del CLI: %v\n%s", err, out)
+	}
+
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	t.Setenv("CLIPSYNC_RELAY_WAIT", "10")
+	a := newApp(t)
+	defer a.Shutdown(context.Background())
+	srv := httptest.NewServer(a.Mux)
+	defer srv.Close()
+
+	saveDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cli := exec.CommandContext(ctx, bin, "--addr", "ws"+strings.TrimPrefix(srv.URL, "http")+"/ws",
+		"--token", "u1", "--device", "B", "--mode", "listen", "--transport", "ws", "--save-dir", saveDir)
+	if err := cli.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cancel()
+		_ = cli.Wait()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Contains(a.WSS.Devices("u1"), "B") {
+		if time.Now().After(deadline) {
+			t.Fatal("el CLI no se conectó")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	do := func(method, url string, body []byte) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+url, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer u1")
+		req.Header.Set("Content-Type", "application/octet-stream")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp := do(http.MethodPost, "/relay", nil)
+	var rsv struct {
+		UploadURL string `json:"upload_url"`
+		RelayURL  string `json:"relay_url"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&rsv)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reserva: %d", resp.StatusCode)
+	}
+
+	body := make([]byte, 256<<10)
+	_, _ = rand.Read(body)
+	sum := sha256.Sum256(body)
+	clip := &types.Clip{MsgID: "relay-1", Mime: "application/pdf", Size: len(body),
+		UploadURL: rsv.UploadURL, SHA256: hex.EncodeToString(sum[:])}
+	if err := a.WSS.Submit("u1", "A", clip); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = do(http.MethodPut, rsv.RelayURL, body)
+	var done struct {
+		Relayed int  `json:"relayed"`
+		Stored  bool `json:"stored"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&done)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || done.Relayed != 1 || done.Stored {
+		t.Fatalf("relay: %d %+v, quiero 1 en directo y sin copia", resp.StatusCode, done)
+	}
+
+	path := filepath.Join(saveDir, "relay-1.pdf")
+	for deadline = time.Now().Add(5 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		if got, err := os.ReadFile(path); err == nil && bytes.Equal(got, body) {
+			break
+		}
+		if time.Now().After(deadline) {
+			ents, _ := os.ReadDir(saveDir)
+			t.Fatalf("el CLI no guardó el clip: %v", ents)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"testing"
 	"time"
 
-	"clip-sync/server/internal/app"
 	"clip-sync/server/pkg/types"
 
 	"github.com/coder/websocket"
@@ -16,7 +15,7 @@ import (
 )
 
 func TestGracefulShutdownClosesWS(t *testing.T) {
-	a := app.NewApp()
+	a := newApp(t)
 
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -70,7 +69,7 @@ func TestGracefulShutdownClosesWS(t *testing.T) {
 }
 
 func TestNewAppKeepsRoutes(t *testing.T) {
-	a := app.NewApp()
+	a := newApp(t)
 	h := a.Mux
 	if h == nil {
 		t.Fatal("mux nil")
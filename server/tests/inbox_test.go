@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"clip-sync/server/pkg/types"
+)
+
+func TestInbox_HTTPOfferAndAccept(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	t.Setenv("CLIPSYNC_INLINE_MAXBYTES", "8")
+	srv := httptest.NewServer(newMux(t))
+	defer srv.Close()
+
+	call := func(user, method, path string, body []byte, out any) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+user)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if out != nil {
+			_ = json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp.StatusCode
+	}
+
+	// solo se ofrece a usuarios que ya se conectaron
+	if code := call("u2", http.MethodPost, "/api/poll", []byte(`{"device_id":"P","wait":0}`), nil); code != http.StatusOK {
+		t.Fatalf("poll de u2: %d", code)
+	}
+
+	// más grande que el inline: el texto va como blob de u1
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/clips?to=u2", bytes.NewReader([]byte("para ti, u2")))
+	req.Header.Set("Authorization", "Bearer u1")
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("ofrecer: %d", resp.StatusCode)
+	}
+	var offers []types.Offer
+	call("u2", http.MethodGet, "/api/inbox", nil, &offers)
+	if len(offers) != 1 || offers[0].From != "u1" || offers[0].Clip.UploadURL != "" {
+		t.Fatalf("bandeja: %+v", offers)
+	}
+	var none []types.Offer
+	if call("u3", http.MethodGet, "/api/inbox", nil, &none); len(none) != 0 {
+		t.Fatalf("u3 ve la bandeja de u2: %+v", none)
+	}
+	if code := call("u3", http.MethodPost, "/api/inbox/"+offers[0].ID+"/accept", nil, nil); code != http.StatusNotFound {
+		t.Fatalf("u3 aceptó una oferta ajena: %d", code)
+	}
+
+	var env types.Envelope
+	if code := call("u2", http.MethodPost, "/api/inbox/"+offers[0].ID+"/accept?device=P", nil, &env); code != http.StatusOK || env.Clip == nil {
+		t.Fatalf("aceptar: %d %+v", code, env)
+	}
+	// la URL va firmada: u2 descarga un blob de u1 sin ser su dueño
+	resp, err = http.Get(srv.URL + env.Clip.UploadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("descarga: %d", resp.StatusCode)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"testing"
 	"time"
 
-	"clip-sync/server/internal/app"
 	"clip-sync/server/pkg/types"
 
 	"github.com/coder/websocket"
@@ -40,7 +39,7 @@ func hello(t *testing.T, ctx context.Context, c *websocket.Conn, dev string) {
 
 // Drop si len(Data) != Size
 func TestWSDropsMismatchedSize(t *testing.T) {
-	srv := httptest.NewServer(app.NewMux())
+	srv := httptest.NewServer(newMux(t))
 	defer srv.Close()
 	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
 
@@ -71,7 +70,7 @@ func TestWSDropsMismatchedSize(t *testing.T) {
 
 // Drop si falta Data y UploadURL
 func TestWSDropsEmptyClip(t *testing.T) {
-	srv := httptest.NewServer(app.NewMux())
+	srv := httptest.NewServer(newMux(t))
 	defer srv.Close()
 	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
 
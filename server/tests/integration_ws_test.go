@@ -2,6 +2,7 @@ package tests
 
 import (
 	"context"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
@@ -14,10 +15,25 @@ import (
 	"github.com/coder/websocket/wsjson"
 )
 
+// newApp arma la app con el entorno del test; una config inválida lo hace fallar.
+func newApp(t *testing.T) *app.App {
+	t.Helper()
+	a, err := app.NewApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func newMux(t *testing.T) http.Handler {
+	t.Helper()
+	return newApp(t).Mux
+}
+
 func TestWSBroadcastSmallClip(t *testing.T) {
 	t.Parallel()
 
-	srv := httptest.NewServer(app.NewMux())
+	srv := httptest.NewServer(newMux(t))
 	defer srv.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
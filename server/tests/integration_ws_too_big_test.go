@@ -6,7 +6,6 @@ import (
 	"testing"
 	"time"
 
-	"clip-sync/server/internal/app"
 	"clip-sync/server/pkg/types"
 	"net/http/httptest"
 
@@ -17,7 +16,7 @@ import (
 func TestWSDropsTooBigInlineClip(t *testing.T) {
 	t.Parallel()
 
-	srv := httptest.NewServer(app.NewMux())
+	srv := httptest.NewServer(newMux(t))
 	defer srv.Close()
 	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
 
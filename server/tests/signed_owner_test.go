@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// Un clip con la upload_url de un blob ajeno no debe volver firmado: la
+// firma saltaría el control de dueño de /d/{id}.
+func TestSignedURL_OnlyOwnBlobs(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	srv := httptest.NewServer(newMux(t))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/upload", bytes.NewReader([]byte("secreto de u1")))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer u1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up struct {
+		UploadURL string `json:"upload_url"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&up)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || up.UploadURL == "" {
+		t.Fatalf("upload status=%d resp=%+v", resp.StatusCode, up)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	dial := func(dev string) *websocket.Conn {
+		c, _, err := websocket.Dial(ctx, wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wsjson.Write(ctx, c, types.Envelope{
+			Type:  "hello",
+			Hello: &types.Hello{Token: "u2", UserID: "u2", DeviceID: dev},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	cA := dial("A")
+	defer cA.Close(websocket.StatusNormalClosure, "")
+	cB := dial("B")
+	defer cB.Close(websocket.StatusNormalClosure, "")
+	time.Sleep(50 * time.Millisecond)
+
+	if err := wsjson.Write(ctx, cA, types.Envelope{
+		Type: "clip",
+		Clip: &types.Clip{MsgID: "robo", Mime: "application/octet-stream", Size: 13, UploadURL: up.UploadURL},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var got types.Envelope
+	if err := wsjson.Read(ctx, cB, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Clip == nil || strings.Contains(got.Clip.UploadURL, "sig=") || got.Clip.ExpiresAt != 0 {
+		t.Fatalf("u2 obtuvo una URL firmada de un blob de u1: %+v", got.Clip)
+	}
+
+	dl, err := http.Get(srv.URL + got.Clip.UploadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dl.Body.Close()
+	if dl.StatusCode == http.StatusOK {
+		t.Fatalf("descarga sin credenciales: %d", dl.StatusCode)
+	}
+}
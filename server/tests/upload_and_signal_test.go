@@ -3,6 +3,8 @@ package tests
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -11,7 +13,6 @@ import (
 	"testing"
 	"time"
 
-	"clip-sync/server/internal/app"
 	"clip-sync/server/pkg/types"
 
 	"github.com/coder/websocket"
@@ -22,12 +23,15 @@ func TestUploadAndSignal(t *testing.T) {
 	t.Parallel()
 
 	// Server en memoria
-	srv := httptest.NewServer(app.NewMux())
+	srv := httptest.NewServer(newMux(t))
 	defer srv.Close()
 
 	// 1) Upload ~100 KB
 	body := bytes.Repeat([]byte("X"), 100_000)
-	resp, err := http.Post(srv.URL+"/upload", "application/octet-stream", bytes.NewReader(body))
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/upload", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer u1")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -100,7 +104,15 @@ func TestUploadAndSignal(t *testing.T) {
 	if got.Clip.Size != len(body) {
 		t.Fatalf("size esperado=%d got=%d", len(body), got.Clip.Size)
 	}
+	if !strings.Contains(got.Clip.UploadURL, "sig=") || got.Clip.ExpiresAt == 0 {
+		t.Fatalf("esperaba upload_url firmada, got=%+v", got.Clip)
+	}
+	// el server rellena el digest aunque el emisor no lo mande
+	if sum := sha256.Sum256(body); got.Clip.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("sha256=%q", got.Clip.SHA256)
+	}
 
+	// la URL firmada es credencial suficiente
 	dl, err := http.Get(srv.URL + got.Clip.UploadURL)
 	if err != nil {
 		t.Fatal(err)
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/internal/webhook"
+)
+
+func TestWebhooks_ClipDeviceUpload(t *testing.T) {
+	events := make(chan webhook.Event, 16)
+	recv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify("hook", r.Header.Get(webhook.HeaderTimestamp), body, r.Header.Get(webhook.HeaderSignature)) {
+			t.Errorf("firma inválida")
+		}
+		var ev webhook.Event
+		_ = json.Unmarshal(body, &ev)
+		events <- ev
+	}))
+	defer recv.Close()
+
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	t.Setenv("CLIPSYNC_WEBHOOK_URLS", recv.URL)
+	t.Setenv("CLIPSYNC_WEBHOOK_SECRET", "hook")
+	a := newApp(t)
+	defer a.Shutdown(context.Background())
+	srv := httptest.NewServer(a.Mux)
+	defer srv.Close()
+
+	next := func(typ string) webhook.Event {
+		t.Helper()
+		select {
+		case ev := <-events:
+			if ev.Type != typ {
+				t.Fatalf("evento %q, quiero %q", ev.Type, typ)
+			}
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no llegó %q", typ)
+		}
+		return webhook.Event{}
+	}
+
+	sub, err := a.WSS.Subscribe("u1", "phone", 0, "sse", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(webhook.EventDeviceJoin); ev.User != "u1" || ev.Device != "phone" {
+		t.Fatalf("join: %+v", ev)
+	}
+
+	if code := asUser(t, "u1", http.MethodPost, srv.URL+"/api/clips?device=ci", map[string]string{"text": "hola"}); code != http.StatusOK {
+		t.Fatalf("envío: %d", code)
+	}
+	ev := next(webhook.EventClip)
+	if clip, _ := ev.Data.(map[string]any); ev.Device != "ci" || clip["mime"] != "text/plain" || clip["data"] == nil {
+		t.Fatalf("clip: %+v", ev)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/upload", strings.NewReader("contenido"))
+	req.Header.Set("Authorization", "Bearer u1")
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload: %d", resp.StatusCode)
+	}
+	if up, _ := next(webhook.EventUpload).Data.(map[string]any); up["size"] != float64(len("contenido")) {
+		t.Fatalf("upload: %+v", up)
+	}
+
+	// un multipart que falla en la segunda parte no anuncia la primera
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	fw.Write([]byte("primera"))
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Disposition", `form-data; name="file"; filename="b.txt"`)
+	h.Set("Content-Digest", "sha-256=:"+strings.Repeat("A", 43)+"=:")
+	fw, _ = mw.CreatePart(h)
+	fw.Write([]byte("segunda"))
+	mw.Close()
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/upload", &body)
+	req.Header.Set("Authorization", "Bearer u1")
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("multipart: %d, quiero 400", resp.StatusCode)
+	}
+
+	sub.Close()
+	next(webhook.EventDeviceLeave)
+}
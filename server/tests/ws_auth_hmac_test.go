@@ -11,7 +11,6 @@ import (
     "testing"
     "time"
 
-    "clip-sync/server/internal/app"
     "clip-sync/server/pkg/types"
 
     "github.com/coder/websocket"
@@ -29,7 +28,7 @@ func makeHMACToken(uid string, exp time.Time, secret string) string {
 func TestWSAuthHMAC_AcceptsValidToken(t *testing.T) {
     t.Setenv("CLIPSYNC_HMAC_SECRET", "s3cr3t")
 
-    srv := httptest.NewServer(app.NewMux())
+    srv := httptest.NewServer(newMux(t))
     defer srv.Close()
 
     wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
@@ -66,7 +65,7 @@ func TestWSAuthHMAC_AcceptsValidToken(t *testing.T) {
 func TestWSAuthHMAC_RejectsBadMAC(t *testing.T) {
     t.Setenv("CLIPSYNC_HMAC_SECRET", "s3cr3t")
 
-    srv := httptest.NewServer(app.NewMux())
+    srv := httptest.NewServer(newMux(t))
     defer srv.Close()
 
     wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
@@ -100,7 +99,7 @@ func TestWSAuthHMAC_RejectsBadMAC(t *testing.T) {
 func TestWSAuthHMAC_RejectsExpired(t *testing.T) {
     t.Setenv("CLIPSYNC_HMAC_SECRET", "s3cr3t")
 
-    srv := httptest.NewServer(app.NewMux())
+    srv := httptest.NewServer(newMux(t))
     defer srv.Close()
 
     wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
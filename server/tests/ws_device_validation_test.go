@@ -7,7 +7,6 @@ import (
     "testing"
     "time"
 
-    "clip-sync/server/internal/app"
     "clip-sync/server/pkg/types"
 
     "github.com/coder/websocket"
@@ -15,7 +14,7 @@ import (
 )
 
 func TestWSRejectsInvalidDeviceID(t *testing.T) {
-    srv := httptest.NewServer(app.NewMux())
+    srv := httptest.NewServer(newMux(t))
     defer srv.Close()
 
     wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
@@ -7,7 +7,6 @@ import (
 	"testing"
 	"time"
 
-	"clip-sync/server/internal/app"
 	"clip-sync/server/pkg/types"
 
 	"github.com/coder/websocket"
@@ -17,7 +16,7 @@ import (
 func TestWSRateLimitPerDevice(t *testing.T) {
 	t.Setenv("CLIPSYNC_RATE_LPS", "1") // 1 clip/seg por device para un test estable
 
-	srv := httptest.NewServer(app.NewMux())
+	srv := httptest.NewServer(newMux(t))
 	defer srv.Close()
 
 	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"clip-sync/server/pkg/types"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+func TestRecall_FansOutAndDeletesBlob(t *testing.T) {
+	t.Setenv("CLIPSYNC_UPLOAD_DIR", t.TempDir())
+	srv := httptest.NewServer(newMux(t))
+	defer srv.Close()
+
+	body := bytes.Repeat([]byte("s3cr3t "), 20_000)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/upload", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", "Bearer u1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up struct {
+		UploadURL string `json:"upload_url"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&up)
+	resp.Body.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	dial := func(dev string) *websocket.Conn {
+		c, _, err := websocket.Dial(ctx, wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := wsjson.Write(ctx, c, types.Envelope{
+			Type:  "hello",
+			Hello: &types.Hello{Token: "u1", UserID: "u1", DeviceID: dev},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	cA, cB := dial("A"), dial("B")
+	defer cA.Close(websocket.StatusNormalClosure, "")
+	defer cB.Close(websocket.StatusNormalClosure, "")
+
+	_ = wsjson.Write(ctx, cA, types.Envelope{Type: "clip", Clip: &types.Clip{
+		MsgID: "oops", Mime: "text/plain", Size: len(body), UploadURL: up.UploadURL,
+	}})
+	var got types.Envelope
+	if err := wsjson.Read(ctx, cB, &got); err != nil || got.Type != "clip" {
+		t.Fatalf("esperaba clip: %+v err=%v", got, err)
+	}
+
+	_ = wsjson.Write(ctx, cA, types.Envelope{Type: "recall", Recall: &types.Recall{MsgID: "oops"}})
+	got = types.Envelope{}
+	if err := wsjson.Read(ctx, cB, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "recall" || got.Recall == nil || got.Recall.MsgID != "oops" || got.From != "A" {
+		t.Fatalf("esperaba recall de A: %+v", got)
+	}
+
+	dl, _ := http.NewRequest(http.MethodGet, srv.URL+up.UploadURL, nil)
+	dl.Header.Set("Authorization", "Bearer u1")
+	resp, err = http.DefaultClient.Do(dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("blob retirado: status=%d, want 404", resp.StatusCode)
+	}
+}